@@ -2,7 +2,7 @@ package broker
 
 import (
 	"github.com/shimmeringbee/unpi"
-	. "github.com/shimmeringbee/unpi/library"
+	"github.com/shimmeringbee/unpi/library"
 	"io"
 	"sync"
 )
@@ -17,22 +17,38 @@ type Broker struct {
 	FrameReader FrameReader
 	FrameWriter FrameWriter
 
-	sendingChannel chan outgoingFrame
-	sendingEnd     chan bool
+	sendingQueue *outboundQueue
+	sendingEnd   chan bool
+	pacer        *pacer
 
-	syncReceivingMutex *sync.Mutex
-	receivingEnd       chan bool
+	syncArbiter  *syncArbiter
+	receivingEnd chan bool
+	lastResponse *int64
 
 	listenMutex          *sync.Mutex
 	awaitMessageSequence *uint64
 	listenRequests       map[listenRequest]ResponseFunction
 
-	messageLibrary *Library
+	interceptMutex       *sync.Mutex
+	outboundInterceptors []OutboundInterceptor
+	inboundInterceptors  []InboundInterceptor
+
+	observeMutex    *sync.Mutex
+	observeSequence *uint64
+	observers       map[uint64]Observer
+
+	watchdog watchdog
+	resets   resetTracker
+
+	capabilities capabilityTracker
+
+	libraryMutex   *sync.Mutex
+	messageLibrary *library.Library
 }
 
 const PermittedQueuedRequests int = 50
 
-func NewBroker(reader io.Reader, writer io.Writer, ml *Library) *Broker {
+func NewBroker(reader io.Reader, writer io.Writer, ml *library.Library) *Broker {
 	z := &Broker{
 		reader: reader,
 		writer: writer,
@@ -40,23 +56,60 @@ func NewBroker(reader io.Reader, writer io.Writer, ml *Library) *Broker {
 		FrameReader: unpi.Read,
 		FrameWriter: unpi.Write,
 
-		sendingChannel: make(chan outgoingFrame, PermittedQueuedRequests),
-		sendingEnd:     make(chan bool),
+		sendingQueue: newOutboundQueue(PermittedQueuedRequests),
+		sendingEnd:   make(chan bool),
+		pacer:        newPacer(),
 
 		receivingEnd: make(chan bool, 1),
+		lastResponse: new(int64),
 
-		syncReceivingMutex: &sync.Mutex{},
+		syncArbiter: newSyncArbiter(),
 
 		listenMutex:          &sync.Mutex{},
 		awaitMessageSequence: new(uint64),
 		listenRequests:       map[listenRequest]ResponseFunction{},
 
+		interceptMutex: &sync.Mutex{},
+
+		observeMutex:    &sync.Mutex{},
+		observeSequence: new(uint64),
+		observers:       map[uint64]Observer{},
+
+		watchdog: watchdog{
+			mutex: &sync.Mutex{},
+		},
+
+		resets: newResetTracker(),
+
+		capabilities: capabilityTracker{
+			mutex: &sync.Mutex{},
+		},
+
+		libraryMutex:   &sync.Mutex{},
 		messageLibrary: ml,
 	}
 
+	z.listen(unpi.AREQ, unpi.SYS, SysResetIndCommandID, z.handleResetIndication)
+
 	return z
 }
 
+// SetLibrary replaces the message library used by the broker, for example once the firmware of the adapter
+// is known. Requests already in flight continue with the library they started with.
+func (b *Broker) SetLibrary(ml *library.Library) {
+	b.libraryMutex.Lock()
+	defer b.libraryMutex.Unlock()
+
+	b.messageLibrary = ml
+}
+
+func (b *Broker) currentLibrary() *library.Library {
+	b.libraryMutex.Lock()
+	defer b.libraryMutex.Unlock()
+
+	return b.messageLibrary
+}
+
 func (b *Broker) Start() {
 	go b.handleSending()
 	go b.handleReceiving()
@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/shimmeringbee/unpi"
+	"sync"
+)
+
+var ErrSubsystemUnsupported = errors.New("subsystem not supported by adapter")
+
+type capabilityTracker struct {
+	mutex        *sync.Mutex
+	known        bool
+	capabilities Capabilities
+}
+
+// SetCapabilities records the subsystems supported by the adapter, requests for subsystems which are not
+// supported will fail with ErrSubsystemUnsupported rather than being sent. Connect sets these from the
+// adapters SYS_PING response.
+func (b *Broker) SetCapabilities(c Capabilities) {
+	b.capabilities.mutex.Lock()
+	defer b.capabilities.mutex.Unlock()
+
+	b.capabilities.known = true
+	b.capabilities.capabilities = c
+}
+
+// Capabilities returns the capabilities of the adapter, and if they are known.
+func (b *Broker) Capabilities() (Capabilities, bool) {
+	b.capabilities.mutex.Lock()
+	defer b.capabilities.mutex.Unlock()
+
+	return b.capabilities.capabilities, b.capabilities.known
+}
+
+func (b *Broker) checkSupported(s Subsystem) error {
+	if c, known := b.Capabilities(); known && !c.Supports(s) {
+		return fmt.Errorf("%w: subsystem 0x%02x", ErrSubsystemUnsupported, byte(s))
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBroker_Capabilities(t *testing.T) {
+	t.Run("requests to subsystems missing from the adapter fail without being sent", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+		type Response struct{}
+
+		ml.Add(SREQ, APP_CNF, 0x05, Request{})
+		ml.Add(SRSP, APP_CNF, 0x05, Response{})
+		ml.Add(AREQ, APP_CNF, 0x06, Response{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		_, known := b.Capabilities()
+		assert.False(t, known)
+
+		b.SetCapabilities(MT_CAP_SYS | MT_CAP_AF | MT_CAP_ZDO)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := b.RequestResponse(ctx, Request{}, &Response{})
+		assert.True(t, errors.Is(err, ErrSubsystemUnsupported))
+
+		err = b.Request(Response{})
+		assert.True(t, errors.Is(err, ErrSubsystemUnsupported))
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("requests to subsystems present on the adapter are sent", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+
+		ml.Add(AREQ, APP_CNF, 0x06, Request{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		b.SetCapabilities(MT_CAP_SYS | MT_CAP_APP_CNF)
+
+		m.On(AREQ, APP_CNF, 0x06)
+
+		err := b.Request(Request{})
+		assert.NoError(t, err)
+
+		m.AssertCallsEventually(t, time.Second)
+	})
+}
@@ -0,0 +1,219 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"log"
+	"reflect"
+	"time"
+)
+
+var AcknowledgementRequired = errors.New("synchronous requests must provide an acknowledgement to collect")
+var CollectTargetNotSlicePointer = errors.New("collect target must be a pointer to a slice")
+
+// CollectOptions control when Collect stops gathering responses. Collection always stops when the
+// context is done, it will also stop once Count responses have been received, or once no response
+// has been received for QuietPeriod. A zero value disables that condition.
+type CollectOptions struct {
+	// Acknowledgement is the SRSP which is awaited before collection begins, it must be provided if the
+	// request is an SREQ.
+	Acknowledgement interface{}
+
+	Count       int
+	QuietPeriod time.Duration
+
+	// Stream, if provided, receives every response as it is collected, and a MalformedResponse for every
+	// frame which could not be decoded. It is closed when collection ends.
+	Stream chan<- interface{}
+}
+
+// MalformedResponse reports a frame received during collection which could not be decoded into the
+// prototype, it is skipped and collection continues.
+type MalformedResponse struct {
+	Frame Frame
+	Err   error
+}
+
+func (e MalformedResponse) Error() string {
+	return fmt.Sprintf("malformed response 0x%02x/0x%02x: %v", uint8(e.Frame.Subsystem), e.Frame.CommandID, e.Err)
+}
+
+func (e MalformedResponse) Unwrap() error {
+	return e.Err
+}
+
+// Collect sends a request and gathers every response that matches the prototype, such as replies from
+// many devices to a broadcast ZDO request. Responses are returned as new values of the prototypes type, the
+// prototype may be a struct or a pointer to a struct.
+// Reaching the end of the context is a normal end to collection and is not reported as an error, nor is a
+// response which cannot be decoded, which is logged and sent to the Stream as a MalformedResponse.
+func (b *Broker) Collect(ctx context.Context, req interface{}, respPrototype interface{}, opts CollectOptions) ([]interface{}, error) {
+	if opts.Stream != nil {
+		defer close(opts.Stream)
+	}
+
+	requestFrame, err := b.requestFrame(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	respIdentity, respFound := b.currentLibrary().GetByObject(respPrototype)
+
+	if !respFound {
+		return nil, ResponseMessageNotInLibrary
+	}
+
+	if requestFrame.MessageType == SREQ && opts.Acknowledgement == nil {
+		return nil, AcknowledgementRequired
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	ch := make(chan Frame, PermittedQueuedRequests)
+
+	cancelCollect := b.listen(respIdentity.MessageType, respIdentity.Subsystem, respIdentity.CommandID, func(f Frame) {
+		select {
+		case ch <- f:
+		case <-done:
+		}
+	})
+	defer cancelCollect()
+
+	if opts.Acknowledgement != nil {
+		if err := b.collectAcknowledged(ctx, requestFrame, opts.Acknowledgement); err != nil {
+			return nil, err
+		}
+	} else if err := b.writeFrame(b.priority(ctx, frameIdentity(requestFrame)), requestFrame); err != nil {
+		return nil, err
+	}
+
+	var quiet <-chan time.Time
+	resetQuiet := func() {}
+
+	if opts.QuietPeriod > 0 {
+		timer := time.NewTimer(opts.QuietPeriod)
+		defer timer.Stop()
+
+		quiet = timer.C
+		resetQuiet = func() {
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(opts.QuietPeriod)
+		}
+	}
+
+	return collectFrames(ctx, ch, reflect.TypeOf(respPrototype), opts, quiet, resetQuiet)
+}
+
+func collectFrames(ctx context.Context, ch chan Frame, respType reflect.Type, opts CollectOptions, quiet <-chan time.Time, resetQuiet func()) ([]interface{}, error) {
+	var responses []interface{}
+
+	isPtr := respType.Kind() == reflect.Ptr
+
+	if isPtr {
+		respType = respType.Elem()
+	}
+
+	for {
+		var f Frame
+
+		select {
+		case f = <-ch:
+		case <-quiet:
+			return responses, nil
+		case <-ctx.Done():
+			return responses, nil
+		}
+
+		respValue := reflect.New(respType)
+
+		var streamed interface{}
+
+		if err := bytecodec.Unmarshal(f.Payload, respValue.Interface()); err != nil {
+			malformed := MalformedResponse{Frame: f, Err: err}
+			log.Printf("unpi collect skipped %v", malformed)
+
+			streamed = malformed
+		} else {
+			resp := respValue.Interface()
+
+			if !isPtr {
+				resp = respValue.Elem().Interface()
+			}
+
+			streamed = resp
+			responses = append(responses, resp)
+			resetQuiet()
+		}
+
+		if opts.Stream != nil {
+			select {
+			case opts.Stream <- streamed:
+			case <-ctx.Done():
+				return responses, nil
+			}
+		}
+
+		if opts.Count > 0 && len(responses) >= opts.Count {
+			return responses, nil
+		}
+	}
+}
+
+func (b *Broker) collectAcknowledged(ctx context.Context, requestFrame Frame, ack interface{}) error {
+	ackIdentity, ackFound := b.currentLibrary().GetByObject(ack)
+
+	if !ackFound {
+		return ResponseMessageNotInLibrary
+	}
+
+	f, err := b.awaitResponse(ctx, requestFrame, ackIdentity)
+
+	if err != nil {
+		return err
+	}
+
+	if err := bytecodec.Unmarshal(f.Payload, ack); err != nil {
+		return err
+	}
+
+	return b.stageStatusError(frameIdentity(requestFrame), ackIdentity, ack)
+}
+
+// CollectInto behaves as Collect, but appends the responses to the slice pointed to by respSlice. The
+// slice element type is used as the response prototype and may be a struct or a pointer to a struct.
+func (b *Broker) CollectInto(ctx context.Context, req interface{}, respSlice interface{}, opts CollectOptions) error {
+	sliceValue := reflect.ValueOf(respSlice)
+
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return CollectTargetNotSlicePointer
+	}
+
+	sliceValue = sliceValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	responses, err := b.Collect(ctx, req, reflect.New(elemType).Interface(), opts)
+
+	for _, resp := range responses {
+		v := reflect.ValueOf(resp)
+
+		if !isPtr {
+			v = v.Elem()
+		}
+
+		sliceValue.Set(reflect.Append(sliceValue, v))
+	}
+
+	return err
+}
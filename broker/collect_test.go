@@ -0,0 +1,240 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type collectRequest struct{}
+
+type collectAcknowledgement struct {
+	Status uint8
+}
+
+type collectResponse struct {
+	Value uint8
+}
+
+func collectLibrary() *library.Library {
+	ml := library.NewLibrary()
+	ml.Add(SREQ, ZDO, 0x01, collectRequest{})
+	ml.Add(SRSP, ZDO, 0x01, collectAcknowledgement{})
+	ml.Add(AREQ, ZDO, 0x81, collectResponse{})
+	return ml
+}
+
+func collectMock(values ...uint8) *testunpi.MockAdapter {
+	m := testunpi.NewMockAdapter()
+
+	m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: 0x01, Payload: []byte{0x00}})
+
+	for _, v := range values {
+		m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0x81, Payload: []byte{v}})
+	}
+
+	return m
+}
+
+func TestBroker_Collect(t *testing.T) {
+	t.Run("collects responses until the count is reached", func(t *testing.T) {
+		m := collectMock(0x01, 0x02, 0x03)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses, err := b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}, Count: 3})
+
+		assert.NoError(t, err)
+		assert.Len(t, responses, 3)
+		assert.IsType(t, &collectResponse{}, responses[0])
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("collects struct values for a struct value prototype", func(t *testing.T) {
+		m := collectMock(0x01, 0x02)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses, err := b.Collect(ctx, collectRequest{}, collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}, Count: 2})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{collectResponse{Value: 0x01}, collectResponse{Value: 0x02}}, responses)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("collects responses until the responses go quiet", func(t *testing.T) {
+		m := collectMock(0x01, 0x02)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		responses, err := b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}, QuietPeriod: 50 * time.Millisecond})
+
+		assert.NoError(t, err)
+		assert.Len(t, responses, 2)
+		assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("collects responses until the context ends", func(t *testing.T) {
+		m := collectMock(0x01)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		responses, err := b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}})
+
+		assert.NoError(t, err)
+		assert.Len(t, responses, 1)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("streams responses over a channel and closes it", func(t *testing.T) {
+		m := collectMock(0x01, 0x02)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		stream := make(chan interface{})
+
+		go func() {
+			_, _ = b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}, Count: 2, Stream: stream})
+		}()
+
+		var streamed []interface{}
+
+		for resp := range stream {
+			streamed = append(streamed, resp)
+		}
+
+		assert.Len(t, streamed, 2)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("skips and streams responses which cannot be decoded", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: 0x01, Payload: []byte{0x00}})
+		m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0x81})
+		m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0x81, Payload: []byte{0x02}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		stream := make(chan interface{}, 2)
+
+		responses, err := b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}, QuietPeriod: 50 * time.Millisecond, Stream: stream})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{&collectResponse{Value: 0x02}}, responses)
+
+		var malformed []MalformedResponse
+
+		for v := range stream {
+			if m, ok := v.(MalformedResponse); ok {
+				malformed = append(malformed, m)
+			}
+		}
+
+		if assert.Len(t, malformed, 1) {
+			assert.Equal(t, uint8(0x81), malformed[0].Frame.CommandID)
+			assert.Error(t, malformed[0].Err)
+		}
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("collects into a typed slice", func(t *testing.T) {
+		m := collectMock(0x01, 0x02)
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var responses []collectResponse
+		err := b.CollectInto(ctx, collectRequest{}, &responses, CollectOptions{Acknowledgement: &collectAcknowledgement{}, Count: 2})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []collectResponse{{Value: 0x01}, {Value: 0x02}}, responses)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("errors if a synchronous request has no acknowledgement", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		_, err := b.Collect(context.Background(), collectRequest{}, &collectResponse{}, CollectOptions{})
+
+		assert.Equal(t, AcknowledgementRequired, err)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("returns a StatusError if the acknowledgement status is not success", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, collectLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, ZDO, 0x01).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: 0x01, Payload: []byte{0x02}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := b.Collect(ctx, collectRequest{}, &collectResponse{}, CollectOptions{Acknowledgement: &collectAcknowledgement{}})
+
+		assert.True(t, errors.Is(err, StageStatusNotSuccess))
+
+		statusErr := StatusError{}
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, uint8(0x02), statusErr.Code)
+		assert.Equal(t, library.Identity{MessageType: SREQ, Subsystem: ZDO, CommandID: 0x01}, statusErr.Identity)
+
+		m.AssertCalls(t)
+	})
+}
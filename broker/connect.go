@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"io"
+	"log"
+	"time"
+)
+
+// SkipBootloaderByte is written to the adapter to instruct the CC2530 and CC2652 serial bootloaders to
+// start the application image immediately.
+const SkipBootloaderByte byte = 0xef
+
+// SysVersionCommandID is the command ID of SYS_VERSION, sent as an SREQ and answered with an SRSP.
+const SysVersionCommandID byte = 0x02
+
+var VersionResponseTooShort = errors.New("version response too short")
+
+// Version is the SRSP payload of SYS_VERSION. Revision is only reported by newer firmware, it is zero if
+// it was absent.
+type Version struct {
+	TransportRev       uint8
+	Product            uint8
+	MajorRelease       uint8
+	MinorRelease       uint8
+	MaintenanceRelease uint8
+	Revision           uint32
+}
+
+func parseVersion(payload []byte) (Version, error) {
+	if len(payload) < 5 {
+		return Version{}, VersionResponseTooShort
+	}
+
+	v := Version{
+		TransportRev:       payload[0],
+		Product:            payload[1],
+		MajorRelease:       payload[2],
+		MinorRelease:       payload[3],
+		MaintenanceRelease: payload[4],
+	}
+
+	if len(payload) >= 9 {
+		v.Revision = binary.LittleEndian.Uint32(payload[5:9])
+	}
+
+	return v, nil
+}
+
+// ConnectOptions configure the start up sequence performed by Connect, zero values are replaced with
+// defaults.
+type ConnectOptions struct {
+	Library *library.Library
+	// LibraryForVersion selects the message library to use once the adapters version is known, replacing
+	// Library.
+	LibraryForVersion func(Version) *library.Library
+
+	SkipBootloader  bool
+	BootloaderDelay time.Duration
+	DrainPeriod     time.Duration
+
+	PingAttempts int
+	StepTimeout  time.Duration
+
+	Logf func(format string, v ...interface{})
+}
+
+func (o ConnectOptions) withDefaults() ConnectOptions {
+	if o.Library == nil {
+		o.Library = library.NewLibrary()
+	}
+
+	if o.BootloaderDelay <= 0 {
+		o.BootloaderDelay = time.Second
+	}
+
+	if o.DrainPeriod <= 0 {
+		o.DrainPeriod = 100 * time.Millisecond
+	}
+
+	if o.PingAttempts <= 0 {
+		o.PingAttempts = 5
+	}
+
+	if o.StepTimeout <= 0 {
+		o.StepTimeout = time.Second
+	}
+
+	if o.Logf == nil {
+		o.Logf = log.Printf
+	}
+
+	return o
+}
+
+// ConnectResult describes the adapter discovered by Connect.
+type ConnectResult struct {
+	Version      Version
+	Capabilities Capabilities
+	// CapabilitiesKnown is false if the adapters SYS_PING response was too short to carry capabilities, the
+	// broker then sends requests for every subsystem.
+	CapabilitiesKnown bool
+}
+
+// Connect runs the adapter start up sequence over the transport. It optionally sends the skip bootloader
+// byte, drains any output left by the adapter, pings the adapter until it answers and then queries its
+// version. The message library is then chosen by the adapters version with LibraryForVersion. A
+// started broker is returned if every step succeeded.
+func Connect(ctx context.Context, transport io.ReadWriter, opts ConnectOptions) (*Broker, ConnectResult, error) {
+	opts = opts.withDefaults()
+	result := ConnectResult{}
+
+	if opts.SkipBootloader {
+		err := connectStep(ctx, opts, "skip bootloader", func(ctx context.Context) error {
+			if _, err := transport.Write([]byte{SkipBootloaderByte}); err != nil {
+				return err
+			}
+
+			return sleepContext(ctx, opts.BootloaderDelay)
+		})
+
+		if err != nil {
+			return nil, result, err
+		}
+	}
+
+	b := NewBroker(transport, transport, opts.Library)
+	b.Start()
+
+	err := connectStep(ctx, opts, "drain", func(ctx context.Context) error {
+		return sleepContext(ctx, opts.DrainPeriod)
+	})
+
+	if err == nil {
+		err = connectStep(ctx, opts, "ping", func(ctx context.Context) error {
+			var err error
+
+			for attempt := 1; attempt <= opts.PingAttempts; attempt++ {
+				attemptCtx, cancel := context.WithTimeout(ctx, opts.StepTimeout)
+				f, pingErr := b.ping(attemptCtx)
+				cancel()
+
+				if pingErr == nil {
+					if len(f.Payload) >= 2 {
+						result.Capabilities = Capabilities(binary.LittleEndian.Uint16(f.Payload))
+						result.CapabilitiesKnown = true
+					}
+
+					return nil
+				}
+
+				err = pingErr
+				opts.Logf("unpi connect: ping attempt %d of %d failed: %v", attempt, opts.PingAttempts, pingErr)
+			}
+
+			return err
+		})
+	}
+
+	if err == nil {
+		err = connectStep(ctx, opts, "version", func(ctx context.Context) error {
+			stepCtx, cancel := context.WithTimeout(ctx, opts.StepTimeout)
+			defer cancel()
+
+			f, err := b.version(stepCtx)
+
+			if err != nil {
+				return err
+			}
+
+			result.Version, err = parseVersion(f.Payload)
+			return err
+		})
+	}
+
+	if err != nil {
+		b.Stop()
+		return nil, result, err
+	}
+
+	if result.CapabilitiesKnown {
+		b.SetCapabilities(result.Capabilities)
+	}
+
+	if opts.LibraryForVersion != nil {
+		if ml := opts.LibraryForVersion(result.Version); ml != nil {
+			b.SetLibrary(ml)
+		}
+	}
+
+	opts.Logf("unpi connect: adapter ready, version %+v, capabilities %v", result.Version, result.Capabilities)
+
+	return b, result, nil
+}
+
+func (b *Broker) version(ctx context.Context) (Frame, error) {
+	versionFrame := Frame{MessageType: SREQ, Subsystem: SYS, CommandID: SysVersionCommandID}
+	respIdentity := library.Identity{MessageType: SRSP, Subsystem: SYS, CommandID: SysVersionCommandID}
+
+	return b.awaitResponse(ctx, versionFrame, respIdentity)
+}
+
+func connectStep(ctx context.Context, opts ConnectOptions, name string, step func(context.Context) error) error {
+	start := time.Now()
+	opts.Logf("unpi connect: %s: starting", name)
+
+	if err := step(ctx); err != nil {
+		opts.Logf("unpi connect: %s: failed after %v: %v", name, time.Since(start), err)
+		return fmt.Errorf("connect %s: %w", name, err)
+	}
+
+	opts.Logf("unpi connect: %s: completed in %v", name, time.Since(start))
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ContextCancelled
+	}
+}
@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func quietConnectOptions() ConnectOptions {
+	return ConnectOptions{
+		SkipBootloader:  true,
+		BootloaderDelay: time.Millisecond,
+		DrainPeriod:     time.Millisecond,
+		PingAttempts:    2,
+		StepTimeout:     20 * time.Millisecond,
+		Logf:            func(string, ...interface{}) {},
+	}
+}
+
+func TestConnect(t *testing.T) {
+	t.Run("connects to an adapter and discovers its version and capabilities", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysPingCommandID, Payload: []byte{0x79, 0x07}})
+		m.On(SREQ, SYS, SysVersionCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysVersionCommandID, Payload: []byte{0x02, 0x01, 0x02, 0x07, 0x01, 0x04, 0x03, 0x02, 0x01}})
+
+		b, result, err := Connect(context.Background(), m, quietConnectOptions())
+
+		assert.NoError(t, err)
+		if assert.NotNil(t, b) {
+			capabilities, known := b.Capabilities()
+			assert.True(t, known)
+			assert.Equal(t, Capabilities(0x0779), capabilities)
+
+			b.Stop()
+		}
+
+		assert.Equal(t, Capabilities(0x0779), result.Capabilities)
+		assert.Equal(t, Version{
+			TransportRev:       0x02,
+			Product:            0x01,
+			MajorRelease:       0x02,
+			MinorRelease:       0x07,
+			MaintenanceRelease: 0x01,
+			Revision:           0x01020304,
+		}, result.Version)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("leaves capabilities unknown if the ping response carries none", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysPingCommandID})
+		m.On(SREQ, SYS, SysVersionCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysVersionCommandID, Payload: []byte{0x02, 0x01, 0x02, 0x07, 0x01}})
+
+		b, result, err := Connect(context.Background(), m, quietConnectOptions())
+
+		assert.NoError(t, err)
+		assert.False(t, result.CapabilitiesKnown)
+
+		if assert.NotNil(t, b) {
+			_, known := b.Capabilities()
+			assert.False(t, known)
+			assert.NoError(t, b.checkSupported(AF))
+
+			b.Stop()
+		}
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("selects the message library by the adapters version", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysPingCommandID, Payload: []byte{0x01, 0x00}})
+		m.On(SREQ, SYS, SysVersionCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysVersionCommandID, Payload: []byte{0x02, 0x02, 0x02, 0x07, 0x01}})
+
+		type VersionSpecific struct{}
+
+		ml := library.NewLibrary()
+		ml.Add(AREQ, SYS, 0x99, VersionSpecific{})
+
+		var selectedFor Version
+
+		opts := quietConnectOptions()
+		opts.LibraryForVersion = func(v Version) *library.Library {
+			selectedFor = v
+			return ml
+		}
+
+		b, result, err := Connect(context.Background(), m, opts)
+
+		assert.NoError(t, err)
+		assert.Equal(t, result.Version, selectedFor)
+
+		if assert.NotNil(t, b) {
+			_, found := b.currentLibrary().GetByObject(VersionSpecific{})
+			assert.True(t, found)
+
+			b.Stop()
+		}
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("fails if the adapter never answers a ping", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, SysPingCommandID).Times(2)
+
+		b, _, err := Connect(context.Background(), m, quietConnectOptions())
+
+		assert.Nil(t, b)
+		assert.True(t, errors.Is(err, ContextCancelled))
+		assert.Contains(t, err.Error(), "ping")
+
+		m.AssertCalls(t)
+	})
+}
+
+func TestParseVersion(t *testing.T) {
+	t.Run("parses a version without a revision", func(t *testing.T) {
+		v, err := parseVersion([]byte{0x02, 0x00, 0x02, 0x06, 0x03})
+
+		assert.NoError(t, err)
+		assert.Equal(t, Version{TransportRev: 0x02, MajorRelease: 0x02, MinorRelease: 0x06, MaintenanceRelease: 0x03}, v)
+	})
+
+	t.Run("errors if the payload is too short", func(t *testing.T) {
+		_, err := parseVersion([]byte{0x02})
+
+		assert.Equal(t, VersionResponseTooShort, err)
+	})
+}
@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"reflect"
+)
+
+// Intercepted is presented to interceptors for each frame passing through a chain. Value holds the
+// decoded message if the frames identity is present in the message library, otherwise it is nil.
+type Intercepted struct {
+	Frame    Frame
+	Identity library.Identity
+	Value    interface{}
+}
+
+// OutboundInterceptor is called for every frame being written to the adapter. It may modify the frame
+// before passing it to next, delay calling next, drop the frame by not calling next, or call next many
+// times to synthesise additional frames.
+type OutboundInterceptor func(i Intercepted, next func(Frame) error) error
+
+// InboundInterceptor is called for every frame read from the adapter, before it is offered to listeners.
+// It has the same abilities over the frame as an OutboundInterceptor.
+type InboundInterceptor func(i Intercepted, next func(Frame))
+
+// InterceptOutbound adds an interceptor to the outbound chain, interceptors are called in the order
+// they were added.
+func (b *Broker) InterceptOutbound(interceptor OutboundInterceptor) {
+	b.interceptMutex.Lock()
+	defer b.interceptMutex.Unlock()
+
+	b.outboundInterceptors = append(b.outboundInterceptors, interceptor)
+}
+
+// InterceptInbound adds an interceptor to the inbound chain, interceptors are called in the order
+// they were added.
+func (b *Broker) InterceptInbound(interceptor InboundInterceptor) {
+	b.interceptMutex.Lock()
+	defer b.interceptMutex.Unlock()
+
+	b.inboundInterceptors = append(b.inboundInterceptors, interceptor)
+}
+
+func (b *Broker) sendFrame(frame Frame) error {
+	b.interceptMutex.Lock()
+	interceptors := b.outboundInterceptors
+	b.interceptMutex.Unlock()
+
+	var next func(int, Frame) error
+
+	next = func(index int, f Frame) error {
+		if index >= len(interceptors) {
+			b.pacer.wait(len(f.Payload) + MinimumFrameSize)
+			return b.FrameWriter(b.writer, f)
+		}
+
+		return interceptors[index](b.intercepted(f), func(nf Frame) error {
+			return next(index+1, nf)
+		})
+	}
+
+	return next(0, frame)
+}
+
+func (b *Broker) receiveFrame(frame Frame) {
+	b.interceptMutex.Lock()
+	interceptors := b.inboundInterceptors
+	b.interceptMutex.Unlock()
+
+	var next func(int, Frame)
+
+	next = func(index int, f Frame) {
+		if index >= len(interceptors) {
+			b.handleListeners(f)
+			return
+		}
+
+		interceptors[index](b.intercepted(f), func(nf Frame) {
+			next(index+1, nf)
+		})
+	}
+
+	next(0, frame)
+}
+
+func (b *Broker) intercepted(frame Frame) Intercepted {
+	i := Intercepted{
+		Frame:    frame,
+		Identity: frameIdentity(frame),
+	}
+
+	if t, found := b.currentLibrary().GetByIdentifier(frame.MessageType, frame.Subsystem, frame.CommandID); found {
+		v := reflect.New(t).Interface()
+
+		if err := bytecodec.Unmarshal(frame.Payload, v); err == nil {
+			i.Value = v
+		}
+	}
+
+	return i
+}
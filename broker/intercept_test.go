@@ -0,0 +1,158 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBroker_InterceptOutbound(t *testing.T) {
+	t.Run("interceptor receives identity and decoded value, and may modify the frame", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct {
+			Value uint8
+		}
+
+		ml.Add(AREQ, SYS, 0x01, Request{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		var seen Intercepted
+
+		b.InterceptOutbound(func(i Intercepted, next func(Frame) error) error {
+			seen = i
+
+			f := i.Frame
+			f.Payload = []byte{0x99}
+
+			return next(f)
+		})
+
+		c := m.On(AREQ, SYS, 0x01)
+
+		err := b.Request(Request{Value: 0x42})
+		assert.NoError(t, err)
+
+		m.AssertCallsEventually(t, time.Second)
+
+		assert.Equal(t, library.Identity{MessageType: AREQ, Subsystem: SYS, CommandID: 0x01}, seen.Identity)
+		assert.Equal(t, &Request{Value: 0x42}, seen.Value)
+		assert.Equal(t, []byte{0x99}, c.CapturedCalls()[0].Frame.Payload)
+	})
+
+	t.Run("interceptor may drop a frame by not calling next", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+
+		ml.Add(AREQ, SYS, 0x01, Request{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		b.InterceptOutbound(func(i Intercepted, next func(Frame) error) error {
+			return nil
+		})
+
+		err := b.Request(Request{})
+		assert.NoError(t, err)
+
+		m.AssertNoFramesWithin(t, 10*time.Millisecond)
+	})
+}
+
+func TestBroker_InterceptInbound(t *testing.T) {
+	t.Run("interceptor may synthesise additional frames for listeners", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Message struct {
+			Value uint8
+		}
+
+		ml.Add(AREQ, SYS, 0x02, Message{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		b.InterceptInbound(func(i Intercepted, next func(Frame)) {
+			next(i.Frame)
+
+			if msg, ok := i.Value.(*Message); ok {
+				f := i.Frame
+				f.Payload = []byte{msg.Value + 1}
+				next(f)
+			}
+		})
+
+		values := make(chan uint8, 2)
+
+		err, cancel := b.Subscribe(&Message{}, func(v interface{}) {
+			values <- v.(*Message).Value
+		})
+		defer cancel()
+		assert.NoError(t, err)
+
+		m.InjectOutgoing(Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x02, Payload: []byte{0x10}})
+
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer ctxCancel()
+
+		var received []uint8
+
+		for len(received) < 2 {
+			select {
+			case v := <-values:
+				received = append(received, v)
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for frames")
+			}
+		}
+
+		assert.ElementsMatch(t, []uint8{0x10, 0x11}, received)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("interceptor may drop a frame before it reaches listeners", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Message struct {
+			Value uint8
+		}
+
+		ml.Add(AREQ, SYS, 0x02, Message{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		b.InterceptInbound(func(i Intercepted, next func(Frame)) {})
+
+		m.InjectOutgoing(Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x02, Payload: []byte{0x10}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := b.Await(ctx, &Message{})
+		assert.Equal(t, ContextCancelled, err)
+
+		m.AssertCalls(t)
+	})
+}
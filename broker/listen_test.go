@@ -5,6 +5,7 @@ import (
 	"github.com/shimmeringbee/unpi/library"
 	testunpi "github.com/shimmeringbee/unpi/testing"
 	"github.com/stretchr/testify/assert"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -18,15 +19,14 @@ func TestBroker_listen(t *testing.T) {
 		b.Start()
 		defer b.Stop()
 
-		awaitOneMatch := false
-		awaitTwoMatch := false
+		var awaitOneMatch, awaitTwoMatch int32
 
 		b.listen(SREQ, SYS, 0x02, func(frame Frame) {
-			awaitOneMatch = true
+			atomic.StoreInt32(&awaitOneMatch, 1)
 		})
 
 		b.listen(SREQ, SYS, 0x02, func(frame Frame) {
-			awaitTwoMatch = true
+			atomic.StoreInt32(&awaitTwoMatch, 1)
 		})
 
 		m.InjectOutgoing(Frame{
@@ -36,10 +36,9 @@ func TestBroker_listen(t *testing.T) {
 			Payload:     nil,
 		})
 
-		time.Sleep(10 * time.Millisecond)
-
-		assert.True(t, awaitOneMatch)
-		assert.True(t, awaitTwoMatch)
+		eventually(t, func() bool {
+			return atomic.LoadInt32(&awaitOneMatch) == 1 && atomic.LoadInt32(&awaitTwoMatch) == 1
+		}, 100*time.Millisecond)
 	})
 
 	t.Run("listen ignores unrelated frames", func(t *testing.T) {
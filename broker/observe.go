@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"sync/atomic"
+)
+
+// Event is published to observers of the broker, the types of event published are defined alongside
+// the features which publish them.
+type Event interface{}
+
+// Observer is called synchronously for each event published, it should return promptly.
+type Observer func(Event)
+
+// Observe registers an observer for events published by the broker, the function returned removes it.
+func (b *Broker) Observe(observer Observer) func() {
+	b.observeMutex.Lock()
+	defer b.observeMutex.Unlock()
+
+	sequence := atomic.AddUint64(b.observeSequence, 1)
+	b.observers[sequence] = observer
+
+	return func() {
+		b.observeMutex.Lock()
+		defer b.observeMutex.Unlock()
+		delete(b.observers, sequence)
+	}
+}
+
+func (b *Broker) publish(e Event) {
+	b.observeMutex.Lock()
+	observers := make([]Observer, 0, len(b.observers))
+
+	for _, observer := range b.observers {
+		observers = append(observers, observer)
+	}
+	b.observeMutex.Unlock()
+
+	for _, observer := range observers {
+		observer(e)
+	}
+}
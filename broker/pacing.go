@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"sync"
+	"time"
+)
+
+// Pacing limits how quickly frames are written to the adapter, a zero value in a field disables that
+// limit. FramesPerSecond and Burst configure a token bucket, BaudRate limits the bytes written to what
+// the serial line can carry, and MinimumGap is enforced between the end of one frame and the next.
+type Pacing struct {
+	FramesPerSecond float64
+	Burst           int
+	BaudRate        int
+	MinimumGap      time.Duration
+}
+
+// PacingStatistics report the delay that pacing has added to the outbound frames.
+type PacingStatistics struct {
+	Frames        uint64
+	DelayedFrames uint64
+	TotalDelay    time.Duration
+	MaximumDelay  time.Duration
+}
+
+// BitsPerByte is the number of bits on the wire for each byte with 8N1 framing, one start bit, eight
+// data bits and one stop bit.
+const BitsPerByte = 10
+
+type pacer struct {
+	mutex *sync.Mutex
+
+	config Pacing
+	stats  PacingStatistics
+
+	tokens        float64
+	lastRefill    time.Time
+	nextPermitted time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newPacer() *pacer {
+	return &pacer{
+		mutex: &sync.Mutex{},
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+}
+
+func (p *pacer) configure(config Pacing) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.config = config
+	p.tokens = float64(p.burst())
+	p.lastRefill = p.now()
+}
+
+func (p *pacer) statistics() PacingStatistics {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.stats
+}
+
+func (p *pacer) burst() int {
+	if p.config.Burst < 1 {
+		return 1
+	}
+
+	return p.config.Burst
+}
+
+func (p *pacer) refill(now time.Time) {
+	if p.config.FramesPerSecond <= 0 {
+		return
+	}
+
+	p.tokens += now.Sub(p.lastRefill).Seconds() * p.config.FramesPerSecond
+	p.lastRefill = now
+
+	if max := float64(p.burst()); p.tokens > max {
+		p.tokens = max
+	}
+}
+
+// wait blocks until a frame of frameSize bytes may be written. The slot for the frame is reserved before
+// sleeping, so statistics remain available while the sender is delayed.
+func (p *pacer) wait(frameSize int) {
+	p.sleep(p.reserve(frameSize))
+}
+
+func (p *pacer) reserve(frameSize int) time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	var delay time.Duration
+
+	if p.nextPermitted.After(now) {
+		delay = p.nextPermitted.Sub(now)
+	}
+
+	if p.config.FramesPerSecond > 0 {
+		p.refill(now)
+
+		if p.tokens < 1 {
+			tokenDelay := time.Duration((1 - p.tokens) / p.config.FramesPerSecond * float64(time.Second))
+
+			if tokenDelay > delay {
+				delay = tokenDelay
+			}
+		}
+	}
+
+	if delay > 0 {
+		now = now.Add(delay)
+
+		p.stats.DelayedFrames++
+		p.stats.TotalDelay += delay
+
+		if delay > p.stats.MaximumDelay {
+			p.stats.MaximumDelay = delay
+		}
+	}
+
+	p.stats.Frames++
+
+	if p.config.FramesPerSecond > 0 {
+		p.refill(now)
+		p.tokens--
+	}
+
+	var transmission time.Duration
+
+	if p.config.BaudRate > 0 {
+		transmission = time.Duration(frameSize*BitsPerByte) * time.Second / time.Duration(p.config.BaudRate)
+	}
+
+	p.nextPermitted = now.Add(transmission + p.config.MinimumGap)
+
+	return delay
+}
+
+// SetPacing configures the pacing applied to outbound frames, it may be called at any time.
+func (b *Broker) SetPacing(pacing Pacing) {
+	b.pacer.configure(pacing)
+}
+
+// PacingStatistics returns the delay which pacing has added to outbound frames so far.
+func (b *Broker) PacingStatistics() PacingStatistics {
+	return b.pacer.statistics()
+}
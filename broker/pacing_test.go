@@ -0,0 +1,111 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func fakeClockPacer(config Pacing) (*pacer, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	p := newPacer()
+	p.now = func() time.Time { return now }
+	p.sleep = func(d time.Duration) { now = now.Add(d) }
+	p.configure(config)
+
+	return p, &now
+}
+
+func TestPacer(t *testing.T) {
+	t.Run("no delay is added without configuration", func(t *testing.T) {
+		p, _ := fakeClockPacer(Pacing{})
+
+		assert.Equal(t, time.Duration(0), p.reserve(10))
+		assert.Equal(t, time.Duration(0), p.reserve(10))
+	})
+
+	t.Run("minimum gap is enforced between frames", func(t *testing.T) {
+		p, _ := fakeClockPacer(Pacing{MinimumGap: 5 * time.Millisecond})
+
+		assert.Equal(t, time.Duration(0), p.reserve(10))
+		assert.Equal(t, 5*time.Millisecond, p.reserve(10))
+	})
+
+	t.Run("byte budget is computed from the baud rate", func(t *testing.T) {
+		p, _ := fakeClockPacer(Pacing{BaudRate: 9600})
+
+		assert.Equal(t, time.Duration(0), p.reserve(96))
+		assert.Equal(t, 100*time.Millisecond, p.reserve(10))
+	})
+
+	t.Run("token bucket permits a burst then delays", func(t *testing.T) {
+		p, now := fakeClockPacer(Pacing{FramesPerSecond: 10, Burst: 2})
+
+		p.wait(10)
+		p.wait(10)
+
+		assert.Equal(t, 100*time.Millisecond, p.reserve(10))
+
+		*now = now.Add(time.Second)
+
+		assert.Equal(t, time.Duration(0), p.reserve(10))
+	})
+
+	t.Run("statistics record added delay", func(t *testing.T) {
+		p, _ := fakeClockPacer(Pacing{MinimumGap: 5 * time.Millisecond})
+
+		p.wait(10)
+		p.wait(10)
+		p.wait(10)
+
+		stats := p.statistics()
+
+		assert.Equal(t, uint64(3), stats.Frames)
+		assert.Equal(t, uint64(2), stats.DelayedFrames)
+		assert.Equal(t, 10*time.Millisecond, stats.TotalDelay)
+		assert.Equal(t, 5*time.Millisecond, stats.MaximumDelay)
+	})
+}
+
+func TestBroker_SetPacing(t *testing.T) {
+	t.Run("sender delays frames according to pacing", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+
+		ml.Add(AREQ, SYS, 0x01, Request{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.SetPacing(Pacing{MinimumGap: 10 * time.Millisecond})
+		b.Start()
+		defer b.Stop()
+
+		m.On(AREQ, SYS, 0x01).Times(3)
+
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, b.Request(Request{}))
+		}
+
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(20*time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.NoError(t, m.WaitForFrames(ctx, 3))
+
+		stats := b.PacingStatistics()
+		assert.Equal(t, uint64(3), stats.Frames)
+		assert.Equal(t, uint64(2), stats.DelayedFrames)
+
+		m.AssertCalls(t)
+	})
+}
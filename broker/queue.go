@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"context"
+	"github.com/shimmeringbee/unpi/library"
+	"sync"
+	"time"
+)
+
+// PriorityStarvationLimit is the longest a frame may wait behind higher priority traffic, once exceeded
+// the oldest starved frame is sent next regardless of its priority.
+const PriorityStarvationLimit = 250 * time.Millisecond
+
+type priorityContextKey struct{}
+
+// WithPriority returns a context which causes requests made with it to be queued at the provided
+// priority, overriding the default for the message in the library.
+func WithPriority(ctx context.Context, p library.Priority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, p)
+}
+
+func (b *Broker) priority(ctx context.Context, identity library.Identity) library.Priority {
+	if p, ok := ctx.Value(priorityContextKey{}).(library.Priority); ok {
+		return p
+	}
+
+	return b.currentLibrary().Priority(identity)
+}
+
+type queuedFrame struct {
+	outgoing outgoingFrame
+	enqueued time.Time
+}
+
+type outboundQueue struct {
+	mutex *sync.Mutex
+	lanes [library.PriorityCount][]queuedFrame
+
+	available chan struct{}
+	slots     chan struct{}
+
+	starvationLimit time.Duration
+	now             func() time.Time
+}
+
+func newOutboundQueue(capacity int) *outboundQueue {
+	return &outboundQueue{
+		mutex:           &sync.Mutex{},
+		available:       make(chan struct{}, 1),
+		slots:           make(chan struct{}, capacity),
+		starvationLimit: PriorityStarvationLimit,
+		now:             time.Now,
+	}
+}
+
+// push adds a frame to the lane for its priority, blocking while the queue is at capacity.
+func (q *outboundQueue) push(p library.Priority, outgoing outgoingFrame) {
+	if int(p) >= library.PriorityCount {
+		p = library.PriorityCritical
+	}
+
+	q.slots <- struct{}{}
+
+	q.mutex.Lock()
+	q.lanes[p] = append(q.lanes[p], queuedFrame{outgoing: outgoing, enqueued: q.now()})
+	q.mutex.Unlock()
+
+	select {
+	case q.available <- struct{}{}:
+	default:
+	}
+}
+
+// pop removes the next frame to send, this is the head of the highest priority lane unless a lower
+// lane has been starved for longer than the starvation limit.
+func (q *outboundQueue) pop() (outgoingFrame, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lane := nextLane(q.now(), q.starvationLimit, func(i int) (time.Time, bool) {
+		if len(q.lanes[i]) == 0 {
+			return time.Time{}, false
+		}
+
+		return q.lanes[i][0].enqueued, true
+	})
+
+	if lane == -1 {
+		return outgoingFrame{}, false
+	}
+
+	queued := q.lanes[lane][0]
+	q.lanes[lane] = q.lanes[lane][1:]
+	<-q.slots
+
+	return queued.outgoing, true
+}
+
+// nextLane selects the lane to serve next given the enqueued time of the head of each lane, this is the
+// oldest head starved for longer than limit, otherwise the highest priority lane which is not empty. It
+// returns -1 if every lane is empty.
+func nextLane(now time.Time, limit time.Duration, head func(lane int) (time.Time, bool)) int {
+	lane := -1
+	var oldest time.Time
+
+	for i := 0; i < library.PriorityCount-1; i++ {
+		enqueued, found := head(i)
+
+		if !found || now.Sub(enqueued) < limit {
+			continue
+		}
+
+		if lane == -1 || enqueued.Before(oldest) {
+			lane = i
+			oldest = enqueued
+		}
+	}
+
+	for i := library.PriorityCount - 1; lane == -1 && i >= 0; i-- {
+		if _, found := head(i); found {
+			lane = i
+		}
+	}
+
+	return lane
+}
+
+type syncWaiter struct {
+	granted  chan struct{}
+	enqueued time.Time
+}
+
+// syncArbiter grants the single synchronous slot, only one SREQ may await its SRSP at a time. Waiting
+// requests are granted the slot by priority, subject to the same starvation limit as the outbound queue.
+type syncArbiter struct {
+	mutex   *sync.Mutex
+	held    bool
+	waiters [library.PriorityCount][]*syncWaiter
+
+	starvationLimit time.Duration
+	now             func() time.Time
+}
+
+func newSyncArbiter() *syncArbiter {
+	return &syncArbiter{
+		mutex:           &sync.Mutex{},
+		starvationLimit: PriorityStarvationLimit,
+		now:             time.Now,
+	}
+}
+
+// acquire waits until the synchronous slot is granted, returning ContextCancelled if ctx is done first.
+func (a *syncArbiter) acquire(ctx context.Context, p library.Priority) error {
+	if int(p) >= library.PriorityCount {
+		p = library.PriorityCritical
+	}
+
+	a.mutex.Lock()
+
+	if !a.held {
+		a.held = true
+		a.mutex.Unlock()
+		return nil
+	}
+
+	w := &syncWaiter{granted: make(chan struct{}), enqueued: a.now()}
+	a.waiters[p] = append(a.waiters[p], w)
+	a.mutex.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	a.mutex.Lock()
+
+	for i, waiting := range a.waiters[p] {
+		if waiting == w {
+			a.waiters[p] = append(a.waiters[p][:i], a.waiters[p][i+1:]...)
+			a.mutex.Unlock()
+			return ContextCancelled
+		}
+	}
+
+	a.mutex.Unlock()
+
+	// The slot was granted as ctx was done, so pass it on.
+	a.release()
+	return ContextCancelled
+}
+
+// release passes the synchronous slot to the next waiting request, or frees it if there are none.
+func (a *syncArbiter) release() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	lane := nextLane(a.now(), a.starvationLimit, func(i int) (time.Time, bool) {
+		if len(a.waiters[i]) == 0 {
+			return time.Time{}, false
+		}
+
+		return a.waiters[i][0].enqueued, true
+	})
+
+	if lane == -1 {
+		a.held = false
+		return
+	}
+
+	w := a.waiters[lane][0]
+	a.waiters[lane] = a.waiters[lane][1:]
+	close(w.granted)
+}
+
+// waiting returns the number of requests waiting for the synchronous slot.
+func (a *syncArbiter) waiting() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	n := 0
+
+	for _, lane := range a.waiters {
+		n += len(lane)
+	}
+
+	return n
+}
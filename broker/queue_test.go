@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func queuedCommand(commandID byte) outgoingFrame {
+	return outgoingFrame{Frame: Frame{MessageType: AREQ, Subsystem: SYS, CommandID: commandID}}
+}
+
+func TestOutboundQueue(t *testing.T) {
+	t.Run("pop returns nothing from an empty queue", func(t *testing.T) {
+		q := newOutboundQueue(10)
+
+		_, found := q.pop()
+		assert.False(t, found)
+	})
+
+	t.Run("frames are popped highest priority first, in order within a lane", func(t *testing.T) {
+		q := newOutboundQueue(10)
+
+		q.push(library.PriorityLow, queuedCommand(0x01))
+		q.push(library.PriorityNormal, queuedCommand(0x02))
+		q.push(library.PriorityCritical, queuedCommand(0x03))
+		q.push(library.PriorityNormal, queuedCommand(0x04))
+
+		var order []byte
+
+		for {
+			outgoing, found := q.pop()
+			if !found {
+				break
+			}
+
+			order = append(order, outgoing.Frame.CommandID)
+		}
+
+		assert.Equal(t, []byte{0x03, 0x02, 0x04, 0x01}, order)
+	})
+
+	t.Run("starved low priority frames are sent ahead of higher priorities", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		q := newOutboundQueue(10)
+		q.now = func() time.Time { return now }
+
+		q.push(library.PriorityLow, queuedCommand(0x01))
+
+		now = now.Add(PriorityStarvationLimit)
+
+		q.push(library.PriorityHigh, queuedCommand(0x02))
+
+		outgoing, _ := q.pop()
+		assert.Equal(t, byte(0x01), outgoing.Frame.CommandID)
+
+		outgoing, _ = q.pop()
+		assert.Equal(t, byte(0x02), outgoing.Frame.CommandID)
+	})
+}
+
+func TestSyncArbiter(t *testing.T) {
+	t.Run("the slot is granted immediately when free", func(t *testing.T) {
+		a := newSyncArbiter()
+
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+		a.release()
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+	})
+
+	t.Run("waiting requests are granted the slot highest priority first", func(t *testing.T) {
+		a := newSyncArbiter()
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+
+		granted := make(chan library.Priority, 2)
+
+		for i, p := range []library.Priority{library.PriorityLow, library.PriorityCritical} {
+			go func(p library.Priority) {
+				_ = a.acquire(context.Background(), p)
+				granted <- p
+			}(p)
+
+			waiting := i + 1
+			eventually(t, func() bool { return a.waiting() == waiting }, time.Second)
+		}
+
+		a.release()
+		assert.Equal(t, library.PriorityCritical, <-granted)
+
+		a.release()
+		assert.Equal(t, library.PriorityLow, <-granted)
+	})
+
+	t.Run("starved requests are granted the slot ahead of higher priorities", func(t *testing.T) {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		a := newSyncArbiter()
+		a.now = func() time.Time { return now }
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+
+		granted := make(chan library.Priority, 2)
+
+		go func() {
+			_ = a.acquire(context.Background(), library.PriorityLow)
+			granted <- library.PriorityLow
+		}()
+
+		eventually(t, func() bool { return a.waiting() == 1 }, time.Second)
+		now = now.Add(PriorityStarvationLimit)
+
+		go func() {
+			_ = a.acquire(context.Background(), library.PriorityHigh)
+			granted <- library.PriorityHigh
+		}()
+
+		eventually(t, func() bool { return a.waiting() == 2 }, time.Second)
+
+		a.release()
+		assert.Equal(t, library.PriorityLow, <-granted)
+	})
+
+	t.Run("waiting stops when the context is done", func(t *testing.T) {
+		a := newSyncArbiter()
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Equal(t, ContextCancelled, a.acquire(ctx, library.PriorityCritical))
+		assert.Equal(t, 0, a.waiting())
+
+		a.release()
+		assert.NoError(t, a.acquire(context.Background(), library.PriorityNormal))
+	})
+}
+
+func TestBroker_priority(t *testing.T) {
+	t.Run("priority defaults to the library, and may be overridden by context", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Ping struct{}
+
+		ml.Add(SREQ, SYS, 0x01, Ping{}, library.WithPriority(library.PriorityHigh))
+
+		b := NewBroker(nil, nil, ml)
+		identity, _ := ml.GetByObject(Ping{})
+
+		assert.Equal(t, library.PriorityHigh, b.priority(context.Background(), identity))
+		assert.Equal(t, library.PriorityLow, b.priority(WithPriority(context.Background(), library.PriorityLow), identity))
+	})
+}
@@ -2,8 +2,11 @@ package broker
 
 import (
 	"errors"
+	"github.com/shimmeringbee/unpi"
 	"log"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 func (b *Broker) handleReceiving() {
@@ -15,10 +18,19 @@ func (b *Broker) handleReceiving() {
 				continue
 			}
 
+			if errors.Is(err, unpi.FrameChecksumFailed) || errors.Is(err, unpi.FrameTooShort) {
+				log.Printf("unpi discarded malformed frame: %v\n", err)
+				continue
+			}
+
 			log.Printf("unpi read failed: %v\n", err)
 			return
 		} else {
-			b.handleListeners(frame)
+			if frame.MessageType == unpi.SRSP {
+				atomic.StoreInt64(b.lastResponse, time.Now().UnixNano())
+			}
+
+			b.receiveFrame(frame)
 		}
 
 		select {
@@ -0,0 +1,39 @@
+package broker
+
+import (
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBroker_handleReceiving(t *testing.T) {
+	t.Run("malformed frames are discarded and receiving continues", func(t *testing.T) {
+		b := NewBroker(nil, nil, library.NewLibrary())
+
+		reads := []error{FrameChecksumFailed, FrameTooShort, nil, io.EOF}
+
+		b.FrameReader = func(r io.Reader) (Frame, error) {
+			err := reads[0]
+			reads = reads[1:]
+
+			return Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x01}, err
+		}
+
+		received := make(chan Frame, 1)
+
+		b.listen(AREQ, SYS, 0x01, func(f Frame) {
+			received <- f
+		})
+
+		go b.handleReceiving()
+
+		select {
+		case <-received:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("frame after malformed frames was not received")
+		}
+
+	})
+}
@@ -1,34 +1,28 @@
 package broker
 
 import (
+	"context"
 	"errors"
-	"github.com/shimmeringbee/bytecodec"
 	. "github.com/shimmeringbee/unpi"
 )
 
+// Request sends an asynchronous request, at the priority the library provides for it.
 func (b *Broker) Request(req interface{}) error {
-	reqIdentity, reqFound := b.messageLibrary.GetByObject(req)
-
-	if !reqFound {
-		return errors.New("request message was not in message library")
-	}
-
-	if reqIdentity.MessageType == SREQ {
-		return errors.New("synchronous messages cannot be sent one shot")
-	}
+	return b.RequestContext(context.Background(), req)
+}
 
-	requestPayload, err := bytecodec.Marshal(req)
+// RequestContext sends an asynchronous request, queued at the priority set on ctx with WithPriority if
+// there is one.
+func (b *Broker) RequestContext(ctx context.Context, req interface{}) error {
+	requestFrame, err := b.requestFrame(req)
 
 	if err != nil {
 		return err
 	}
 
-	requestFrame := Frame{
-		MessageType: reqIdentity.MessageType,
-		Subsystem:   reqIdentity.Subsystem,
-		CommandID:   reqIdentity.CommandID,
-		Payload:     requestPayload,
+	if requestFrame.MessageType == SREQ {
+		return errors.New("synchronous messages cannot be sent one shot")
 	}
 
-	return b.writeFrame(requestFrame)
+	return b.writeFrame(b.priority(ctx, frameIdentity(requestFrame)), requestFrame)
 }
@@ -1,6 +1,7 @@
 package broker
 
 import (
+	"context"
 	. "github.com/shimmeringbee/unpi"
 	"github.com/shimmeringbee/unpi/library"
 	testunpi "github.com/shimmeringbee/unpi/testing"
@@ -28,11 +29,42 @@ func TestRequest(t *testing.T) {
 		request := Request{}
 		err := b.Request(request)
 
-		time.Sleep(10 * time.Millisecond)
-
 		assert.NoError(t, err)
 
-		m.AssertCalls(t)
+		m.AssertCallsEventually(t, time.Second)
+	})
+
+	t.Run("sends asynchronous request at the priority of the context", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+
+		ml.Add(AREQ, SYS, 0x01, Request{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+
+		m.On(AREQ, SYS, 0x01)
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- b.RequestContext(WithPriority(context.Background(), library.PriorityCritical), Request{})
+		}()
+
+		eventually(t, func() bool {
+			b.sendingQueue.mutex.Lock()
+			defer b.sendingQueue.mutex.Unlock()
+
+			return len(b.sendingQueue.lanes[library.PriorityCritical]) == 1
+		}, time.Second)
+
+		b.Start()
+		defer b.Stop()
+
+		assert.NoError(t, <-done)
+		m.AssertCallsEventually(t, time.Second)
 	})
 
 	t.Run("synchronous request return an error", func(t *testing.T) {
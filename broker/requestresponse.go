@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/shimmeringbee/bytecodec"
 	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
 	"log"
 	"reflect"
 	"sync"
@@ -15,34 +16,51 @@ var ContextCancelled = errors.New("context cancelled")
 var RequestMessageNotInLibrary = errors.New("request message was not in message library")
 var ResponseMessageNotInLibrary = errors.New("response message was not in message library")
 
+// RequestResponse sends a request and waits for the response, which is unmarshalled into resp. If the
+// response carries a status which is not success a StatusError is returned.
 func (b *Broker) RequestResponse(ctx context.Context, req interface{}, resp interface{}) error {
-	reqIdentity, reqFound := b.messageLibrary.GetByObject(req)
-	respIdentity, respFound := b.messageLibrary.GetByObject(resp)
+	requestFrame, err := b.requestFrame(req)
 
-	if !reqFound {
-		return RequestMessageNotInLibrary
+	if err != nil {
+		return err
 	}
 
+	respIdentity, respFound := b.currentLibrary().GetByObject(resp)
+
 	if !respFound {
 		return ResponseMessageNotInLibrary
 	}
 
-	requestPayload, err := bytecodec.Marshal(req)
+	return b.withRetries(ctx, frameIdentity(requestFrame), func(ctx context.Context) error {
+		return b.requestResponseAttempt(ctx, requestFrame, respIdentity, resp)
+	})
+}
+
+func (b *Broker) requestResponseAttempt(ctx context.Context, requestFrame Frame, respIdentity library.Identity, resp interface{}) error {
+	f, err := b.awaitResponse(ctx, requestFrame, respIdentity)
 
 	if err != nil {
 		return err
 	}
 
-	requestFrame := Frame{
-		MessageType: reqIdentity.MessageType,
-		Subsystem:   reqIdentity.Subsystem,
-		CommandID:   reqIdentity.CommandID,
-		Payload:     requestPayload,
+	if err := bytecodec.Unmarshal(f.Payload, resp); err != nil {
+		return err
 	}
 
-	if reqIdentity.MessageType == SREQ {
-		b.syncReceivingMutex.Lock()
-		defer b.syncReceivingMutex.Unlock()
+	return b.statusError(frameIdentity(requestFrame), respIdentity, resp)
+}
+
+// awaitResponse writes a frame and waits for the first frame matching the response identity, holding the
+// synchronous slot if the request is an SREQ.
+func (b *Broker) awaitResponse(ctx context.Context, requestFrame Frame, respIdentity library.Identity) (Frame, error) {
+	priority := b.priority(ctx, frameIdentity(requestFrame))
+
+	if requestFrame.MessageType == SREQ {
+		if err := b.syncArbiter.acquire(ctx, priority); err != nil {
+			return Frame{}, err
+		}
+
+		defer b.syncArbiter.release()
 	}
 
 	ch := make(chan Frame, 1)
@@ -63,29 +81,87 @@ func (b *Broker) RequestResponse(ctx context.Context, req interface{}, resp inte
 		close(ch)
 	}()
 
-	if err := b.writeFrame(requestFrame); err != nil {
-		return err
-	}
+	rpcErrors, cancelRPCErrors := b.listenRPCError(requestFrame)
+	defer cancelRPCErrors()
 
-	var f Frame
+	reset := b.resets.current()
+
+	if err := b.writeFrame(priority, requestFrame); err != nil {
+		return Frame{}, err
+	}
 
 	select {
-	case f = <-ch:
+	case f := <-ch:
+		return f, nil
+	case err := <-rpcErrors:
+		return Frame{}, err
+	case <-reset:
+		return Frame{}, ErrAdapterReset
 	case <-ctx.Done():
-		return ContextCancelled
+		return Frame{}, ContextCancelled
+	}
+}
+
+// listenRPCError returns a channel which receives the RPCError sent by the adapter in place of the SRSP if it
+// could not process the synchronous request. The channel is nil for other requests.
+func (b *Broker) listenRPCError(requestFrame Frame) (<-chan error, func()) {
+	if requestFrame.MessageType != SREQ {
+		return nil, func() {}
 	}
 
-	err = bytecodec.Unmarshal(f.Payload, resp)
+	ch := make(chan error, 1)
+	once := &sync.Once{}
+
+	cancel := b.listen(SRSP, RES0, RPCErrorCommandID, func(f Frame) {
+		rpcErr := RPCError{}
+
+		if err := bytecodec.Unmarshal(f.Payload, &rpcErr); err != nil || !rpcErr.Answers(requestFrame) {
+			return
+		}
+
+		once.Do(func() {
+			ch <- rpcErr
+		})
+	})
+
+	return ch, cancel
+}
+
+func (b *Broker) requestFrame(req interface{}) (Frame, error) {
+	reqIdentity, reqFound := b.currentLibrary().GetByObject(req)
+
+	if !reqFound {
+		return Frame{}, RequestMessageNotInLibrary
+	}
+
+	if err := b.checkSupported(reqIdentity.Subsystem); err != nil {
+		return Frame{}, err
+	}
+
+	requestPayload, err := bytecodec.Marshal(req)
 
 	if err != nil {
-		return err
+		return Frame{}, err
 	}
 
-	return nil
+	return Frame{
+		MessageType: reqIdentity.MessageType,
+		Subsystem:   reqIdentity.Subsystem,
+		CommandID:   reqIdentity.CommandID,
+		Payload:     requestPayload,
+	}, nil
+}
+
+func frameIdentity(f Frame) library.Identity {
+	return library.Identity{
+		MessageType: f.MessageType,
+		Subsystem:   f.Subsystem,
+		CommandID:   f.CommandID,
+	}
 }
 
 func (b *Broker) Await(ctx context.Context, resp interface{}) error {
-	respIdentity, respFound := b.messageLibrary.GetByObject(resp)
+	respIdentity, respFound := b.currentLibrary().GetByObject(resp)
 
 	if !respFound {
 		return ResponseMessageNotInLibrary
@@ -127,7 +203,7 @@ func (b *Broker) Await(ctx context.Context, resp interface{}) error {
 }
 
 func (b *Broker) Subscribe(message interface{}, callback func(v interface{})) (error, func()) {
-	msgIdentity, msgFound := b.messageLibrary.GetByObject(message)
+	msgIdentity, msgFound := b.currentLibrary().GetByObject(message)
 
 	if !msgFound {
 		return ResponseMessageNotInLibrary, func() {}
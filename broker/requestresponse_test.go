@@ -7,6 +7,7 @@ import (
 	"github.com/shimmeringbee/unpi/library"
 	testunpi "github.com/shimmeringbee/unpi/testing"
 	"github.com/stretchr/testify/assert"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -98,6 +99,44 @@ func TestRequestResponse(t *testing.T) {
 		m.AssertCalls(t)
 	})
 
+	t.Run("fails with the rpc error sent in place of the response", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+
+		type Response struct {
+			Value uint8
+		}
+
+		ml.Add(SREQ, SYS, 0x01, Request{})
+		ml.Add(SRSP, SYS, 0x01, Response{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, SYS, 0x01).Return(
+			Frame{MessageType: SRSP, Subsystem: RES0, CommandID: RPCErrorCommandID, Payload: []byte{0x02, 0x21, 0x02}},
+			Frame{MessageType: SRSP, Subsystem: RES0, CommandID: RPCErrorCommandID, Payload: []byte{0x02, 0x21, 0x01}},
+		).Times(2)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := b.RequestResponse(ctx, Request{}, &Response{})
+		assert.Equal(t, ContextCancelled, err, "rpc errors for other requests are ignored")
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err = b.RequestResponse(ctx, Request{}, &Response{})
+		assert.Equal(t, RPCError{ErrorCode: RPCErrorUnsupportedCommand, Cmd0: 0x21, Cmd1: 0x01}, err)
+
+		m.AssertCalls(t)
+	})
+
 	t.Run("sends request with no response, context deadline takes effect", func(t *testing.T) {
 		ml := library.NewLibrary()
 
@@ -261,13 +300,13 @@ func TestBroker_Subscribe(t *testing.T) {
 		b.Start()
 		defer b.Stop()
 
-		called := 0
+		var called int32
 
 		err, subCancel := b.Subscribe(&Message{}, func(v interface{}) {
 			msg := v.(*Message)
 
 			assert.Equal(t, uint8(0x55), msg.Value)
-			called += 1
+			atomic.AddInt32(&called, 1)
 		})
 		defer subCancel()
 
@@ -278,11 +317,62 @@ func TestBroker_Subscribe(t *testing.T) {
 			Payload:     []byte{0x55},
 		})
 
-		time.Sleep(10 * time.Millisecond)
-
 		assert.NoError(t, err)
-		assert.Equal(t, 1, called)
+		eventually(t, func() bool {
+			return atomic.LoadInt32(&called) == 1
+		}, 100*time.Millisecond)
 
 		m.AssertCalls(t)
 	})
+
+	t.Run("synchronous requests waiting for the adapter are sent highest priority first", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct {
+			Value uint8
+		}
+
+		type Response struct{}
+
+		ml.Add(SREQ, SYS, 0x01, Request{})
+		ml.Add(SRSP, SYS, 0x01, Response{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, SYS, 0x01).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x01}).After(20 * time.Millisecond).UnlimitedTimes()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		done := make(chan error, 4)
+
+		send := func(ctx context.Context, value uint8, waiting int) {
+			go func() {
+				done <- b.RequestResponse(ctx, Request{Value: value}, &Response{})
+			}()
+
+			eventually(t, func() bool { return len(m.ReceivedFrames()) == 1 && b.syncArbiter.waiting() == waiting }, time.Second)
+		}
+
+		send(ctx, 0, 0)
+		send(WithPriority(ctx, library.PriorityLow), 1, 1)
+		send(WithPriority(ctx, library.PriorityLow), 2, 2)
+		send(WithPriority(ctx, library.PriorityCritical), 3, 3)
+
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, <-done)
+		}
+
+		var order []byte
+
+		for _, f := range m.ReceivedFrames() {
+			order = append(order, f.Payload[0])
+		}
+
+		assert.Equal(t, []byte{0, 3, 1, 2}, order)
+	})
 }
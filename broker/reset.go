@@ -0,0 +1,147 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"log"
+	"sync"
+)
+
+var ErrAdapterReset = errors.New("adapter reset while request in flight")
+
+// SYS_RESET_REQ and SYS_RESET_IND are decoded by the broker itself, so that it can follow resets whatever
+// library it is using.
+const (
+	SysResetReqCommandID byte = 0x00
+	SysResetIndCommandID byte = 0x80
+)
+
+type ResetReason uint8
+
+const (
+	ResetPowerUp  ResetReason = 0x00
+	ResetExternal ResetReason = 0x01
+	ResetWatchdog ResetReason = 0x02
+)
+
+func (r ResetReason) String() string {
+	switch r {
+	case ResetPowerUp:
+		return "power up"
+	case ResetExternal:
+		return "external"
+	case ResetWatchdog:
+		return "watchdog"
+	default:
+		return "unknown"
+	}
+}
+
+// ResetIndication is the payload of SYS_RESET_IND, sent by the adapter whenever it has reset.
+type ResetIndication struct {
+	Reason           ResetReason
+	TransportRev     uint8
+	ProductID        uint8
+	MajorRelease     uint8
+	MinorRelease     uint8
+	HardwareRevision uint8
+}
+
+// AdapterReset is published to observers when the adapter indicates that it has reset.
+type AdapterReset struct {
+	Indication ResetIndication
+}
+
+type resetRequest struct {
+	Type uint8
+}
+
+const (
+	resetTypeHard uint8 = 0x00
+	resetTypeSoft uint8 = 0x01
+)
+
+type resetTracker struct {
+	mutex  *sync.Mutex
+	signal chan struct{}
+}
+
+func newResetTracker() resetTracker {
+	return resetTracker{
+		mutex:  &sync.Mutex{},
+		signal: make(chan struct{}),
+	}
+}
+
+// current returns a channel which is closed on the next adapter reset.
+func (r *resetTracker) current() <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.signal
+}
+
+func (r *resetTracker) trigger() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	close(r.signal)
+	r.signal = make(chan struct{})
+}
+
+func (b *Broker) handleResetIndication(f Frame) {
+	indication := ResetIndication{}
+
+	if err := bytecodec.Unmarshal(f.Payload, &indication); err != nil {
+		log.Printf("failed to unmarshal reset indication: %+v", err)
+	}
+
+	b.resets.trigger()
+	b.publish(AdapterReset{Indication: indication})
+}
+
+// ResetAndWait sends SYS_RESET_REQ to the adapter and waits for the SYS_RESET_IND it sends once it has
+// restarted. A hard reset restarts the device, a soft reset restarts only the stack.
+func (b *Broker) ResetAndWait(ctx context.Context, hard bool) (ResetIndication, error) {
+	request := resetRequest{Type: resetTypeSoft}
+
+	if hard {
+		request.Type = resetTypeHard
+	}
+
+	payload, err := bytecodec.Marshal(request)
+
+	if err != nil {
+		return ResetIndication{}, err
+	}
+
+	ch := make(chan Frame, 1)
+	once := sync.Once{}
+
+	cancelAwait := b.listen(AREQ, SYS, SysResetIndCommandID, func(f Frame) {
+		once.Do(func() {
+			ch <- f
+		})
+	})
+
+	defer func() {
+		once.Do(func() {})
+		cancelAwait()
+	}()
+
+	resetFrame := Frame{MessageType: AREQ, Subsystem: SYS, CommandID: SysResetReqCommandID, Payload: payload}
+
+	if err := b.writeFrame(b.priority(ctx, frameIdentity(resetFrame)), resetFrame); err != nil {
+		return ResetIndication{}, err
+	}
+
+	select {
+	case f := <-ch:
+		indication := ResetIndication{}
+		return indication, bytecodec.Unmarshal(f.Payload, &indication)
+	case <-ctx.Done():
+		return ResetIndication{}, ContextCancelled
+	}
+}
@@ -0,0 +1,124 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var resetIndicationFrame = Frame{
+	MessageType: AREQ,
+	Subsystem:   SYS,
+	CommandID:   SysResetIndCommandID,
+	Payload:     []byte{0x02, 0x02, 0x01, 0x02, 0x07, 0x01},
+}
+
+func TestBroker_ResetIndication(t *testing.T) {
+	t.Run("in flight synchronous requests fail when the adapter resets", func(t *testing.T) {
+		ml := library.NewLibrary()
+
+		type Request struct{}
+		type Response struct{}
+
+		ml.Add(SREQ, SYS, 0x02, Request{})
+		ml.Add(SRSP, SYS, 0x02, Response{})
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, ml)
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, SYS, 0x02).Return(resetIndicationFrame)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := b.RequestResponse(ctx, Request{}, &Response{})
+		assert.Equal(t, ErrAdapterReset, err)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("observers are notified with the decoded reset indication", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		events := make(chan AdapterReset, 1)
+
+		b.Observe(func(e Event) {
+			if reset, ok := e.(AdapterReset); ok {
+				events <- reset
+			}
+		})
+
+		m.InjectOutgoing(resetIndicationFrame)
+
+		select {
+		case reset := <-events:
+			assert.Equal(t, ResetIndication{
+				Reason:           ResetWatchdog,
+				TransportRev:     0x02,
+				ProductID:        0x01,
+				MajorRelease:     0x02,
+				MinorRelease:     0x07,
+				HardwareRevision: 0x01,
+			}, reset.Indication)
+			assert.Equal(t, "watchdog", reset.Indication.Reason.String())
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("reset was not observed")
+		}
+
+		m.AssertCalls(t)
+	})
+}
+
+func TestBroker_ResetAndWait(t *testing.T) {
+	t.Run("sends a hard reset and waits for the indication", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		c := m.On(AREQ, SYS, SysResetReqCommandID).Return(resetIndicationFrame)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		indication, err := b.ResetAndWait(ctx, true)
+
+		assert.NoError(t, err)
+		assert.Equal(t, ResetWatchdog, indication.Reason)
+		assert.Equal(t, []byte{0x00}, c.CapturedCalls()[0].Frame.Payload)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("sends a soft reset and times out without an indication", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		c := m.On(AREQ, SYS, SysResetReqCommandID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := b.ResetAndWait(ctx, false)
+
+		assert.Equal(t, ContextCancelled, err)
+		assert.Equal(t, []byte{0x01}, c.CapturedCalls()[0].Frame.Payload)
+
+		m.AssertCalls(t)
+	})
+}
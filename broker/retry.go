@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/unpi/library"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var AttemptTimedOut = errors.New("request attempt timed out")
+
+// RequestAttempt is published to observers after every attempt of a RequestResponse.
+type RequestAttempt struct {
+	Identity  library.Identity
+	Attempt   int
+	Duration  time.Duration
+	Err       error
+	WillRetry bool
+}
+
+type retryPolicyContextKey struct{}
+
+// WithRetryPolicy returns a context which causes requests made with it to use the provided retry policy,
+// overriding any policy for the message in the library.
+func WithRetryPolicy(ctx context.Context, p library.RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyContextKey{}, p)
+}
+
+func (b *Broker) retryPolicy(ctx context.Context, identity library.Identity) library.RetryPolicy {
+	if p, ok := ctx.Value(retryPolicyContextKey{}).(library.RetryPolicy); ok {
+		return p
+	}
+
+	if p, found := b.currentLibrary().RetryPolicy(identity); found {
+		return p
+	}
+
+	return library.RetryPolicy{MaxAttempts: 1}
+}
+
+// DefaultRetryable is used when a retry policy does not specify which errors are retryable, only attempts
+// which timed out are retried.
+func DefaultRetryable(err error) bool {
+	return errors.Is(err, AttemptTimedOut)
+}
+
+func retryable(policy library.RetryPolicy, err error) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+
+	return DefaultRetryable(err)
+}
+
+func backoff(policy library.RetryPolicy, attempt int) time.Duration {
+	if policy.Backoff <= 0 {
+		return 0
+	}
+
+	multiplier := policy.Multiplier
+
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(policy.Backoff) * math.Pow(multiplier, float64(attempt-1))
+
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		delay += delay * policy.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// withRetries calls attemptFn until it succeeds, the policy is exhausted or the context ends. Each attempt
+// is given its own context bounded by the policies AttemptTimeout and is reported to observers.
+func (b *Broker) withRetries(ctx context.Context, identity library.Identity, attemptFn func(context.Context) error) error {
+	policy := b.retryPolicy(ctx, identity)
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+
+		if policy.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+
+		start := time.Now()
+		err := attemptFn(attemptCtx)
+		cancel()
+
+		if err == ContextCancelled && ctx.Err() == nil {
+			err = AttemptTimedOut
+		}
+
+		willRetry := err != nil && attempt < policy.MaxAttempts && ctx.Err() == nil && retryable(policy, err)
+
+		b.publish(RequestAttempt{
+			Identity:  identity,
+			Attempt:   attempt,
+			Duration:  time.Since(start),
+			Err:       err,
+			WillRetry: willRetry,
+		})
+
+		if !willRetry {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff(policy, attempt)):
+		case <-ctx.Done():
+			return ContextCancelled
+		}
+	}
+}
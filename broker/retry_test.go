@@ -0,0 +1,157 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type retryRequest struct{}
+
+type retryResponse struct {
+	Value uint8
+}
+
+func retryBroker(t *testing.T, opts ...library.Option) (*Broker, *testunpi.MockAdapter, *[]RequestAttempt) {
+	ml := library.NewLibrary()
+	ml.Add(SREQ, SYS, 0x01, retryRequest{}, opts...)
+	ml.Add(SRSP, SYS, 0x01, retryResponse{})
+
+	m := testunpi.NewMockAdapter()
+	b := NewBroker(m, m, ml)
+
+	attempts := &[]RequestAttempt{}
+	mutex := &sync.Mutex{}
+
+	b.Observe(func(e Event) {
+		if attempt, ok := e.(RequestAttempt); ok {
+			mutex.Lock()
+			*attempts = append(*attempts, attempt)
+			mutex.Unlock()
+		}
+	})
+
+	b.Start()
+
+	t.Cleanup(func() {
+		b.Stop()
+		m.Stop()
+	})
+
+	return b, m, attempts
+}
+
+func dropFirstResponses(b *Broker, count int) {
+	mutex := &sync.Mutex{}
+
+	b.InterceptInbound(func(i Intercepted, next func(Frame)) {
+		mutex.Lock()
+		drop := count > 0
+		count--
+		mutex.Unlock()
+
+		if !drop {
+			next(i.Frame)
+		}
+	})
+}
+
+func TestBroker_RequestResponse_Retries(t *testing.T) {
+	t.Run("retries an unanswered request after the attempt timeout", func(t *testing.T) {
+		b, m, attempts := retryBroker(t)
+		dropFirstResponses(b, 1)
+
+		m.On(SREQ, SYS, 0x01).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x01, Payload: []byte{0x42}}).Times(2)
+
+		ctx := WithRetryPolicy(context.Background(), library.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 20 * time.Millisecond})
+
+		resp := retryResponse{}
+		err := b.RequestResponse(ctx, retryRequest{}, &resp)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0x42), resp.Value)
+
+		assert.Len(t, *attempts, 2)
+		assert.Equal(t, AttemptTimedOut, (*attempts)[0].Err)
+		assert.True(t, (*attempts)[0].WillRetry)
+		assert.NoError(t, (*attempts)[1].Err)
+		assert.Equal(t, 2, (*attempts)[1].Attempt)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("uses the retry policy from the library", func(t *testing.T) {
+		b, m, attempts := retryBroker(t, library.WithRetryPolicy(library.RetryPolicy{MaxAttempts: 2, AttemptTimeout: 20 * time.Millisecond}))
+		dropFirstResponses(b, 1)
+
+		m.On(SREQ, SYS, 0x01).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x01, Payload: []byte{0x42}}).Times(2)
+
+		err := b.RequestResponse(context.Background(), retryRequest{}, &retryResponse{})
+
+		assert.NoError(t, err)
+		assert.Len(t, *attempts, 2)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("gives up once max attempts is reached", func(t *testing.T) {
+		b, m, attempts := retryBroker(t)
+
+		m.On(SREQ, SYS, 0x01).Times(3)
+
+		ctx := WithRetryPolicy(context.Background(), library.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 10 * time.Millisecond, Backoff: time.Millisecond})
+
+		err := b.RequestResponse(ctx, retryRequest{}, &retryResponse{})
+
+		assert.Equal(t, AttemptTimedOut, err)
+		assert.Len(t, *attempts, 3)
+		assert.False(t, (*attempts)[2].WillRetry)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("does not retry errors which are not retryable", func(t *testing.T) {
+		b, m, attempts := retryBroker(t)
+
+		m.On(SREQ, SYS, 0x01)
+
+		ctx := WithRetryPolicy(context.Background(), library.RetryPolicy{
+			MaxAttempts:    3,
+			AttemptTimeout: 10 * time.Millisecond,
+			Retryable:      func(error) bool { return false },
+		})
+
+		err := b.RequestResponse(ctx, retryRequest{}, &retryResponse{})
+
+		assert.Equal(t, AttemptTimedOut, err)
+		assert.Len(t, *attempts, 1)
+
+		m.AssertCalls(t)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	t.Run("backoff grows by the multiplier and is capped", func(t *testing.T) {
+		policy := library.RetryPolicy{Backoff: 10 * time.Millisecond, Multiplier: 2, MaxBackoff: 30 * time.Millisecond}
+
+		assert.Equal(t, 10*time.Millisecond, backoff(policy, 1))
+		assert.Equal(t, 20*time.Millisecond, backoff(policy, 2))
+		assert.Equal(t, 30*time.Millisecond, backoff(policy, 3))
+	})
+
+	t.Run("jitter keeps backoff within bounds", func(t *testing.T) {
+		policy := library.RetryPolicy{Backoff: 100 * time.Millisecond, Jitter: 0.5}
+
+		for i := 0; i < 100; i++ {
+			delay := backoff(policy, 1)
+
+			assert.GreaterOrEqual(t, int64(delay), int64(50*time.Millisecond))
+			assert.LessOrEqual(t, int64(delay), int64(150*time.Millisecond))
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package broker
 
-import . "github.com/shimmeringbee/unpi"
+import (
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+)
 
 type outgoingFrame struct {
 	Frame        Frame
@@ -10,21 +13,31 @@ type outgoingFrame struct {
 func (b *Broker) handleSending() {
 	for {
 		select {
-		case outgoing := <-b.sendingChannel:
-			outgoing.ErrorChannel <- b.FrameWriter(b.writer, outgoing.Frame)
+		case <-b.sendingEnd:
+			return
+		default:
+		}
+
+		if outgoing, found := b.sendingQueue.pop(); found {
+			outgoing.ErrorChannel <- b.sendFrame(outgoing.Frame)
+			continue
+		}
+
+		select {
+		case <-b.sendingQueue.available:
 		case <-b.sendingEnd:
 			return
 		}
 	}
 }
 
-func (b *Broker) writeFrame(frame Frame) error {
+func (b *Broker) writeFrame(priority library.Priority, frame Frame) error {
 	errCh := make(chan error)
 
-	b.sendingChannel <- outgoingFrame{
+	b.sendingQueue.push(priority, outgoingFrame{
 		Frame:        frame,
 		ErrorChannel: errCh,
-	}
+	})
 
 	return <-errCh
 }
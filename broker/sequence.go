@@ -0,0 +1,169 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"reflect"
+	"sync"
+)
+
+var NoStagesProvided = errors.New("no stages provided for sequence")
+var StageStatusNotSuccess = errors.New("stage response status was not success")
+var CorrelationFieldNotFound = errors.New("correlation field not found in message")
+
+// Stage describes one message expected in response to a request. Stages after the first are usually
+// AREQ confirmations, CorrelateBy names a field present in both the request and the response (such as
+// a transaction ID) which must be equal for a frame to be accepted for the stage.
+type Stage struct {
+	Response    interface{}
+	CorrelateBy string
+}
+
+// RequestResponseSequence sends a request and waits for every stage in order. Listeners for all stages
+// are registered before the request is written, so a confirmation arriving before its SRSP is not lost.
+// If the first stage is an SRSP with a Status field that is not success, no further stages are awaited.
+func (b *Broker) RequestResponseSequence(ctx context.Context, req interface{}, stages ...Stage) error {
+	if len(stages) == 0 {
+		return NoStagesProvided
+	}
+
+	requestFrame, err := b.requestFrame(req)
+
+	if err != nil {
+		return err
+	}
+
+	var stageChannels []chan Frame
+
+	for _, stage := range stages {
+		respIdentity, respFound := b.currentLibrary().GetByObject(stage.Response)
+
+		if !respFound {
+			return ResponseMessageNotInLibrary
+		}
+
+		var correlationValue reflect.Value
+
+		if stage.CorrelateBy != "" {
+			if correlationValue, err = fieldByName(req, stage.CorrelateBy); err != nil {
+				return err
+			}
+		}
+
+		ch := make(chan Frame, 1)
+		stageChannels = append(stageChannels, ch)
+
+		once := &sync.Once{}
+		prototype := stage.Response
+		correlateBy := stage.CorrelateBy
+
+		cancelAwait := b.listen(respIdentity.MessageType, respIdentity.Subsystem, respIdentity.CommandID, func(f Frame) {
+			if correlateBy != "" && !frameCorrelates(f, prototype, correlateBy, correlationValue) {
+				return
+			}
+
+			once.Do(func() {
+				ch <- f
+			})
+		})
+
+		defer func() {
+			once.Do(func() {})
+			cancelAwait()
+		}()
+	}
+
+	syncUnlock := func() {}
+	priority := b.priority(ctx, frameIdentity(requestFrame))
+
+	if requestFrame.MessageType == SREQ {
+		if err := b.syncArbiter.acquire(ctx, priority); err != nil {
+			return err
+		}
+
+		unlockOnce := &sync.Once{}
+		syncUnlock = func() {
+			unlockOnce.Do(b.syncArbiter.release)
+		}
+
+		defer syncUnlock()
+	}
+
+	rpcErrors, cancelRPCErrors := b.listenRPCError(requestFrame)
+	defer cancelRPCErrors()
+
+	reset := b.resets.current()
+
+	if err := b.writeFrame(priority, requestFrame); err != nil {
+		return err
+	}
+
+	for i, stage := range stages {
+		var f Frame
+
+		select {
+		case f = <-stageChannels[i]:
+		case err := <-rpcErrors:
+			return err
+		case <-reset:
+			return ErrAdapterReset
+		case <-ctx.Done():
+			return ContextCancelled
+		}
+
+		if err := bytecodec.Unmarshal(f.Payload, stage.Response); err != nil {
+			return err
+		}
+
+		if i == 0 && f.MessageType == SRSP {
+			syncUnlock()
+			cancelRPCErrors()
+			rpcErrors = nil
+
+			if err := b.stageStatusError(frameIdentity(requestFrame), frameIdentity(f), stage.Response); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func frameCorrelates(f Frame, prototype interface{}, correlateBy string, expected reflect.Value) bool {
+	candidate, err := copyInterface(prototype)
+
+	if err != nil {
+		return false
+	}
+
+	if err := bytecodec.Unmarshal(f.Payload, candidate); err != nil {
+		return false
+	}
+
+	actual, err := fieldByName(candidate, correlateBy)
+
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(expected.Interface(), actual.Interface())
+}
+
+func fieldByName(v interface{}, name string) (reflect.Value, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%w: %s", CorrelationFieldNotFound, name)
+	}
+
+	field := value.FieldByName(name)
+
+	if !field.IsValid() {
+		return reflect.Value{}, fmt.Errorf("%w: %s", CorrelationFieldNotFound, name)
+	}
+
+	return field, nil
+}
@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type sequenceRequest struct {
+	TransactionID uint8
+}
+
+type sequenceResponse struct {
+	Status uint8
+}
+
+type sequenceConfirm struct {
+	Status        uint8
+	Endpoint      uint8
+	TransactionID uint8
+}
+
+func sequenceLibrary() *library.Library {
+	ml := library.NewLibrary()
+	ml.Add(SREQ, AF, 0x01, sequenceRequest{})
+	ml.Add(SRSP, AF, 0x01, sequenceResponse{})
+	ml.Add(AREQ, AF, 0x80, sequenceConfirm{})
+	return ml
+}
+
+func sequenceConfirmFrame(transactionID uint8) Frame {
+	data, _ := bytecodec.Marshal(sequenceConfirm{Endpoint: 0x01, TransactionID: transactionID})
+	return Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x80, Payload: data}
+}
+
+func TestBroker_RequestResponseSequence(t *testing.T) {
+	t.Run("returns all stages when SRSP is followed by a correlated AREQ", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, sequenceLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, AF, 0x01).Return(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}})
+		m.On(SREQ, AF, 0x01).Return(sequenceConfirmFrame(0x20))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		resp := sequenceResponse{}
+		confirm := sequenceConfirm{}
+
+		err := b.RequestResponseSequence(ctx, sequenceRequest{TransactionID: 0x20},
+			Stage{Response: &resp},
+			Stage{Response: &confirm, CorrelateBy: "TransactionID"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, sequenceConfirm{Endpoint: 0x01, TransactionID: 0x20}, confirm)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("accepts an AREQ which arrives before the SRSP", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, sequenceLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, AF, 0x01).Return(sequenceConfirmFrame(0x20))
+		m.On(SREQ, AF, 0x01).Return(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		confirm := sequenceConfirm{}
+
+		err := b.RequestResponseSequence(ctx, sequenceRequest{TransactionID: 0x20},
+			Stage{Response: &sequenceResponse{}},
+			Stage{Response: &confirm, CorrelateBy: "TransactionID"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0x20), confirm.TransactionID)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("ignores AREQs which do not correlate with the request", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, sequenceLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, AF, 0x01).Return(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}})
+		m.On(SREQ, AF, 0x01).Return(sequenceConfirmFrame(0x21))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := b.RequestResponseSequence(ctx, sequenceRequest{TransactionID: 0x20},
+			Stage{Response: &sequenceResponse{}},
+			Stage{Response: &sequenceConfirm{}, CorrelateBy: "TransactionID"})
+
+		assert.Equal(t, ContextCancelled, err)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("fails early if the SRSP status is not success", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, sequenceLibrary())
+		b.Start()
+		defer b.Stop()
+
+		m.On(SREQ, AF, 0x01).Return(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x01}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		resp := sequenceResponse{}
+
+		err := b.RequestResponseSequence(ctx, sequenceRequest{TransactionID: 0x20},
+			Stage{Response: &resp},
+			Stage{Response: &sequenceConfirm{}, CorrelateBy: "TransactionID"})
+
+		assert.True(t, errors.Is(err, StageStatusNotSuccess))
+		assert.Equal(t, uint8(0x01), resp.Status)
+
+		statusErr := StatusError{}
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, uint8(0x01), statusErr.Code)
+		assert.Equal(t, library.Identity{MessageType: SREQ, Subsystem: AF, CommandID: 0x01}, statusErr.Identity)
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("errors if the correlation field is missing from the request", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, sequenceLibrary())
+		b.Start()
+		defer b.Stop()
+
+		err := b.RequestResponseSequence(context.Background(), sequenceRequest{},
+			Stage{Response: &sequenceResponse{}},
+			Stage{Response: &sequenceConfirm{}, CorrelateBy: "Missing"})
+
+		assert.True(t, errors.Is(err, CorrelationFieldNotFound))
+
+		m.AssertCalls(t)
+	})
+}
@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/unpi/library"
+	"reflect"
+)
+
+// StatusError is returned by RequestResponse when the response is marked as carrying a status and that
+// status is not success. The response is still populated. Sequences and collections also return it, wrapping
+// StageStatusNotSuccess.
+type StatusError struct {
+	Code     uint8
+	Name     string
+	Identity library.Identity
+	Err      error
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("request 0x%02x/0x%02x/0x%02x failed with status %s (0x%02x)", uint8(e.Identity.MessageType), uint8(e.Identity.Subsystem), e.Identity.CommandID, e.Name, e.Code)
+}
+
+func (e StatusError) Unwrap() error {
+	return e.Err
+}
+
+// statusError returns a StatusError if the response reports a status which is not success.
+func (b *Broker) statusError(reqIdentity library.Identity, respIdentity library.Identity, resp interface{}) error {
+	code, name, found := b.markedStatus(respIdentity, resp)
+
+	if !found || code == 0 {
+		return nil
+	}
+
+	return StatusError{Code: code, Name: name, Identity: reqIdentity}
+}
+
+// markedStatus returns the status of a response which implements library.StatusCarrier, or which was
+// added to the library with a leading status.
+func (b *Broker) markedStatus(identity library.Identity, v interface{}) (uint8, string, bool) {
+	if carrier, ok := v.(library.StatusCarrier); ok {
+		code, name := carrier.ResponseStatus()
+		return code, name, true
+	}
+
+	if !b.currentLibrary().LeadingStatus(identity) {
+		return 0, "", false
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(v))
+
+	if value.Kind() != reflect.Struct || value.NumField() == 0 || value.Field(0).Kind() != reflect.Uint8 {
+		return 0, "", false
+	}
+
+	field := value.Field(0)
+	code := uint8(field.Uint())
+
+	if stringer, ok := field.Interface().(fmt.Stringer); ok {
+		return code, stringer.String(), true
+	}
+
+	return code, fmt.Sprintf("0x%02x", code), true
+}
+
+// stageStatusError returns a StatusError wrapping StageStatusNotSuccess if a stage response reports a status
+// which is not success.
+func (b *Broker) stageStatusError(reqIdentity library.Identity, respIdentity library.Identity, resp interface{}) error {
+	code, name, found := b.stageStatus(respIdentity, resp)
+
+	if !found || code == 0 {
+		return nil
+	}
+
+	return StatusError{Code: code, Name: name, Identity: reqIdentity, Err: StageStatusNotSuccess}
+}
+
+// stageStatus returns the status of a response in a sequence or collection, responses which are not marked
+// fall back to a uint8 field named Status.
+func (b *Broker) stageStatus(identity library.Identity, v interface{}) (uint8, string, bool) {
+	if code, name, found := b.markedStatus(identity, v); found {
+		return code, name, true
+	}
+
+	field, err := fieldByName(v, "Status")
+
+	if err != nil || field.Kind() != reflect.Uint8 {
+		return 0, "", false
+	}
+
+	code := uint8(field.Uint())
+	return code, fmt.Sprintf("0x%02x", code), true
+}
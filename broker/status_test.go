@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type namedStatus uint8
+
+func (s namedStatus) String() string {
+	return fmt.Sprintf("NAMED_%d", uint8(s))
+}
+
+type carriedStatusResponse struct {
+	Value  uint8
+	Result uint8
+}
+
+func (r carriedStatusResponse) ResponseStatus() (uint8, string) {
+	return r.Result, "CARRIED"
+}
+
+func TestStatusError(t *testing.T) {
+	type Request struct{}
+
+	type Response struct {
+		Status namedStatus
+		Value  uint8
+	}
+
+	setup := func(t *testing.T, respond []byte, opts ...library.Option) *Broker {
+		ml := library.NewLibrary()
+		ml.Add(SREQ, SYS, 0x01, Request{})
+		ml.Add(SRSP, SYS, 0x01, Response{}, opts...)
+		ml.Add(SREQ, SYS, 0x02, struct{}{})
+		ml.Add(SRSP, SYS, 0x02, carriedStatusResponse{})
+
+		m := testunpi.NewMockAdapter()
+		m.On(SREQ, SYS, 0x01).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x01, Payload: respond})
+		m.On(SREQ, SYS, 0x02).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x02, Payload: respond})
+
+		b := NewBroker(m, m, ml)
+		b.Start()
+
+		t.Cleanup(func() {
+			b.Stop()
+			m.Stop()
+		})
+
+		return b
+	}
+
+	t.Run("returns a StatusError for a failed leading status and still fills the response", func(t *testing.T) {
+		b := setup(t, []byte{0x02, 0x2a}, library.WithLeadingStatus())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		resp := Response{}
+		err := b.RequestResponse(ctx, Request{}, &resp)
+
+		statusErr := StatusError{}
+		if assert.True(t, errors.As(err, &statusErr)) {
+			assert.Equal(t, uint8(0x02), statusErr.Code)
+			assert.Equal(t, "NAMED_2", statusErr.Name)
+			assert.Equal(t, library.Identity{MessageType: SREQ, Subsystem: SYS, CommandID: 0x01}, statusErr.Identity)
+		}
+
+		assert.Equal(t, Response{Status: 0x02, Value: 0x2a}, resp)
+	})
+
+	t.Run("returns no error for a successful leading status", func(t *testing.T) {
+		b := setup(t, []byte{0x00, 0x2a}, library.WithLeadingStatus())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		resp := Response{}
+		err := b.RequestResponse(ctx, Request{}, &resp)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0x2a), resp.Value)
+	})
+
+	t.Run("ignores the status of unmarked responses", func(t *testing.T) {
+		b := setup(t, []byte{0x02, 0x2a})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		resp := Response{}
+		err := b.RequestResponse(ctx, Request{}, &resp)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("uses the status reported by a StatusCarrier", func(t *testing.T) {
+		b := setup(t, []byte{0x2a, 0x05})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		resp := carriedStatusResponse{}
+		err := b.RequestResponse(ctx, struct{}{}, &resp)
+
+		statusErr := StatusError{}
+		if assert.True(t, errors.As(err, &statusErr)) {
+			assert.Equal(t, uint8(0x05), statusErr.Code)
+			assert.Equal(t, "CARRIED", statusErr.Name)
+		}
+
+		assert.Equal(t, uint8(0x2a), resp.Value)
+	})
+}
@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SysPingCommandID is the command ID of SYS_PING, sent as an SREQ and answered with an SRSP.
+const SysPingCommandID byte = 0x01
+
+type Health uint8
+
+const (
+	HealthUnknown Health = iota
+	Healthy
+	Degraded
+	Dead
+)
+
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	case Dead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthChanged is published to observers when the watchdog changes its view of the adapters health.
+type HealthChanged struct {
+	From                Health
+	To                  Health
+	ConsecutiveFailures int
+	Err                 error
+}
+
+// WatchdogOptions configure the watchdog. The adapter is pinged once it has not answered a synchronous
+// request for Interval, each ping must be answered within Timeout including any wait for another synchronous
+// request to finish. After DegradedAfter consecutive failures the adapter is
+// considered degraded, and after DeadAfter it is considered dead.
+type WatchdogOptions struct {
+	Interval      time.Duration
+	Timeout       time.Duration
+	DegradedAfter int
+	DeadAfter     int
+}
+
+func (o WatchdogOptions) withDefaults() WatchdogOptions {
+	if o.Interval <= 0 {
+		o.Interval = 30 * time.Second
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second
+	}
+
+	if o.DegradedAfter <= 0 {
+		o.DegradedAfter = 1
+	}
+
+	if o.DeadAfter < o.DegradedAfter {
+		o.DeadAfter = o.DegradedAfter + 2
+	}
+
+	return o
+}
+
+type watchdog struct {
+	mutex    *sync.Mutex
+	health   Health
+	failures int
+}
+
+// Health returns the adapters health as last determined by the watchdog, HealthUnknown if the watchdog
+// has not run.
+func (b *Broker) Health() Health {
+	b.watchdog.mutex.Lock()
+	defer b.watchdog.mutex.Unlock()
+
+	return b.watchdog.health
+}
+
+// StartWatchdog starts periodically pinging the adapter with SYS_PING whenever it has not recently sent an
+// SRSP, asynchronous frames alone are not taken as proof that the adapter is able to answer requests. Health
+// transitions are published to observers as HealthChanged events. The function returned stops the watchdog.
+func (b *Broker) StartWatchdog(opts WatchdogOptions) func() {
+	opts = opts.withDefaults()
+
+	end := make(chan struct{})
+	once := &sync.Once{}
+
+	go func() {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.watchdogCheck(opts)
+			case <-end:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			close(end)
+		})
+	}
+}
+
+func (b *Broker) watchdogCheck(opts WatchdogOptions) {
+	lastResponse := time.Unix(0, atomic.LoadInt64(b.lastResponse))
+
+	if time.Since(lastResponse) < opts.Interval {
+		b.recordHealth(opts, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	_, err := b.ping(ctx)
+	b.recordHealth(opts, err)
+}
+
+func (b *Broker) ping(ctx context.Context) (Frame, error) {
+	pingFrame := Frame{MessageType: SREQ, Subsystem: SYS, CommandID: SysPingCommandID}
+	respIdentity := library.Identity{MessageType: SRSP, Subsystem: SYS, CommandID: SysPingCommandID}
+
+	return b.awaitResponse(WithPriority(ctx, library.PriorityCritical), pingFrame, respIdentity)
+}
+
+func (b *Broker) recordHealth(opts WatchdogOptions, err error) {
+	b.watchdog.mutex.Lock()
+
+	from := b.watchdog.health
+
+	if err == nil {
+		b.watchdog.failures = 0
+		b.watchdog.health = Healthy
+	} else {
+		b.watchdog.failures++
+
+		if b.watchdog.failures >= opts.DeadAfter {
+			b.watchdog.health = Dead
+		} else if b.watchdog.failures >= opts.DegradedAfter {
+			b.watchdog.health = Degraded
+		}
+	}
+
+	event := HealthChanged{
+		From:                from,
+		To:                  b.watchdog.health,
+		ConsecutiveFailures: b.watchdog.failures,
+		Err:                 err,
+	}
+
+	b.watchdog.mutex.Unlock()
+
+	if event.From != event.To {
+		b.publish(event)
+	}
+}
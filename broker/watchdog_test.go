@@ -0,0 +1,200 @@
+package broker
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func healthEvents(b *Broker) func() []HealthChanged {
+	mutex := &sync.Mutex{}
+	var events []HealthChanged
+
+	b.Observe(func(e Event) {
+		if changed, ok := e.(HealthChanged); ok {
+			mutex.Lock()
+			events = append(events, changed)
+			mutex.Unlock()
+		}
+	})
+
+	return func() []HealthChanged {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return append([]HealthChanged{}, events...)
+	}
+}
+
+// eventually polls condition until it is true, failing the test if timeout passes first. It is used in place
+// of assert.Eventually, which in testify 1.4.0 checks the condition from a new goroutine on each tick and
+// panics if one of them completes after it has returned.
+func eventually(t *testing.T, condition func() bool, timeout time.Duration) bool {
+	t.Helper()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	for !condition() {
+		select {
+		case <-timer.C:
+			t.Errorf("condition not satisfied within %v", timeout)
+			return false
+		case <-ticker.C:
+		}
+	}
+
+	return true
+}
+
+func TestBroker_Watchdog(t *testing.T) {
+	t.Run("adapter answering pings is healthy", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		events := healthEvents(b)
+
+		m.On(SREQ, SYS, SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysPingCommandID, Payload: []byte{0x79, 0x01}}).UnlimitedTimes()
+
+		assert.Equal(t, HealthUnknown, b.Health())
+
+		stop := b.StartWatchdog(WatchdogOptions{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond})
+		eventually(t, func() bool {
+			return b.Health() == Healthy
+		}, time.Second)
+		stop()
+
+		assert.Equal(t, []HealthChanged{{From: HealthUnknown, To: Healthy}}, events())
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("adapter not answering pings becomes degraded and then dead", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		events := healthEvents(b)
+
+		m.On(SREQ, SYS, SysPingCommandID).UnlimitedTimes()
+
+		stop := b.StartWatchdog(WatchdogOptions{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond, DegradedAfter: 1, DeadAfter: 2})
+		eventually(t, func() bool {
+			return b.Health() == Dead
+		}, time.Second)
+		stop()
+
+		seen := events()
+		if assert.Len(t, seen, 2) {
+			assert.Equal(t, Degraded, seen[0].To)
+			assert.Equal(t, ContextCancelled, seen[0].Err)
+			assert.Equal(t, Degraded, seen[1].From)
+			assert.Equal(t, Dead, seen[1].To)
+		}
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("adapter is not pinged while it answers requests", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(2 * time.Millisecond):
+					m.InjectOutgoing(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}})
+				}
+			}
+		}()
+
+		stop := b.StartWatchdog(WatchdogOptions{Interval: 20 * time.Millisecond, Timeout: 5 * time.Millisecond})
+		defer stop()
+
+		eventually(t, func() bool {
+			return b.Health() == Healthy
+		}, time.Second)
+
+		m.AssertNoFramesWithin(t, 50*time.Millisecond)
+		assert.Equal(t, Healthy, b.Health())
+	})
+
+	t.Run("asynchronous frames do not prove the adapter is healthy", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(2 * time.Millisecond):
+					m.InjectOutgoing(Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0xc0})
+				}
+			}
+		}()
+
+		m.On(SREQ, SYS, SysPingCommandID).UnlimitedTimes()
+
+		stop := b.StartWatchdog(WatchdogOptions{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond, DegradedAfter: 1, DeadAfter: 10})
+		defer stop()
+
+		eventually(t, func() bool {
+			return b.Health() == Degraded
+		}, time.Second)
+	})
+
+	t.Run("pings waiting for another synchronous request fail once the timeout passes", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+		b := NewBroker(m, m, library.NewLibrary())
+		b.Start()
+		defer b.Stop()
+
+		assert.NoError(t, b.syncArbiter.acquire(context.Background(), library.PriorityNormal))
+		defer b.syncArbiter.release()
+
+		opts := WatchdogOptions{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond}.withDefaults()
+
+		start := time.Now()
+		b.watchdogCheck(opts)
+
+		assert.Less(t, int64(time.Since(start)), int64(100*time.Millisecond))
+		assert.Equal(t, Degraded, b.Health())
+		assert.Empty(t, m.ReceivedFrames())
+	})
+}
+
+func TestHealth_String(t *testing.T) {
+	assert.Equal(t, "healthy", Healthy.String())
+	assert.Equal(t, "degraded", Degraded.String())
+	assert.Equal(t, "dead", Dead.String())
+	assert.Equal(t, "unknown", HealthUnknown.String())
+}
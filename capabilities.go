@@ -0,0 +1,95 @@
+package unpi
+
+import "strings"
+
+// Capabilities is the bitmask of MT subsystems compiled into the adapters firmware, as reported in the
+// SRSP of SYS_PING.
+type Capabilities uint16
+
+const (
+	MT_CAP_SYS     Capabilities = 0x0001
+	MT_CAP_MAC     Capabilities = 0x0002
+	MT_CAP_NWK     Capabilities = 0x0004
+	MT_CAP_AF      Capabilities = 0x0008
+	MT_CAP_ZDO     Capabilities = 0x0010
+	MT_CAP_SAPI    Capabilities = 0x0020
+	MT_CAP_UTIL    Capabilities = 0x0040
+	MT_CAP_DEBUG   Capabilities = 0x0080
+	MT_CAP_APP     Capabilities = 0x0100
+	MT_CAP_GP      Capabilities = 0x0200
+	MT_CAP_APP_CNF Capabilities = 0x0800
+	MT_CAP_ZOAD    Capabilities = 0x1000
+)
+
+var capabilityNames = []struct {
+	capability Capabilities
+	name       string
+}{
+	{MT_CAP_SYS, "SYS"},
+	{MT_CAP_MAC, "MAC"},
+	{MT_CAP_NWK, "NWK"},
+	{MT_CAP_AF, "AF"},
+	{MT_CAP_ZDO, "ZDO"},
+	{MT_CAP_SAPI, "SAPI"},
+	{MT_CAP_UTIL, "UTIL"},
+	{MT_CAP_DEBUG, "DEBUG"},
+	{MT_CAP_APP, "APP"},
+	{MT_CAP_GP, "GP"},
+	{MT_CAP_APP_CNF, "APP_CNF"},
+	{MT_CAP_ZOAD, "ZOAD"},
+}
+
+var subsystemCapabilities = map[Subsystem]Capabilities{
+	SYS:     MT_CAP_SYS,
+	MAC:     MT_CAP_MAC,
+	NWK:     MT_CAP_NWK,
+	AF:      MT_CAP_AF,
+	ZDO:     MT_CAP_ZDO,
+	SAPI:    MT_CAP_SAPI,
+	UTIL:    MT_CAP_UTIL,
+	DBG:     MT_CAP_DEBUG,
+	APP:     MT_CAP_APP,
+	APP_CNF: MT_CAP_APP_CNF,
+}
+
+// Has returns true if every capability in other is present.
+func (c Capabilities) Has(other Capabilities) bool {
+	return c&other == other
+}
+
+// Supports returns true if the subsystem was reported as present. Subsystems which have no capability bit
+// can not be reported on, and are assumed to be supported.
+func (c Capabilities) Supports(s Subsystem) bool {
+	capability, found := subsystemCapabilities[s]
+
+	if !found {
+		return true
+	}
+
+	return c.Has(capability)
+}
+
+// Subsystems returns every subsystem with a capability bit that is present.
+func (c Capabilities) Subsystems() []Subsystem {
+	var subsystems []Subsystem
+
+	for s := RES0; s <= SRV_CTR; s++ {
+		if capability, found := subsystemCapabilities[s]; found && c.Has(capability) {
+			subsystems = append(subsystems, s)
+		}
+	}
+
+	return subsystems
+}
+
+func (c Capabilities) String() string {
+	var names []string
+
+	for _, cn := range capabilityNames {
+		if c.Has(cn.capability) {
+			names = append(names, cn.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,44 @@
+package unpi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	t.Run("reports subsystems present in the bitmask as supported", func(t *testing.T) {
+		c := Capabilities(0x0179)
+
+		assert.True(t, c.Supports(SYS))
+		assert.True(t, c.Supports(AF))
+		assert.True(t, c.Supports(ZDO))
+		assert.True(t, c.Supports(SAPI))
+		assert.True(t, c.Supports(UTIL))
+		assert.True(t, c.Supports(APP))
+
+		assert.False(t, c.Supports(MAC))
+		assert.False(t, c.Supports(NWK))
+		assert.False(t, c.Supports(APP_CNF))
+	})
+
+	t.Run("assumes subsystems without a capability bit are supported", func(t *testing.T) {
+		c := Capabilities(0)
+
+		assert.True(t, c.Supports(BOOT))
+		assert.True(t, c.Supports(RES0))
+	})
+
+	t.Run("lists the subsystems present", func(t *testing.T) {
+		c := MT_CAP_SYS | MT_CAP_AF | MT_CAP_APP_CNF
+
+		assert.Equal(t, []Subsystem{SYS, AF, APP_CNF}, c.Subsystems())
+	})
+
+	t.Run("formats as a list of capability names", func(t *testing.T) {
+		c := MT_CAP_SYS | MT_CAP_ZDO | MT_CAP_ZOAD
+
+		assert.Equal(t, "SYS|ZDO|ZOAD", c.String())
+		assert.True(t, c.Has(MT_CAP_SYS|MT_CAP_ZDO))
+		assert.False(t, c.Has(MT_CAP_SYS|MT_CAP_AF))
+	})
+}
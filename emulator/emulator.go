@@ -0,0 +1,312 @@
+// Package emulator plays the network co-processor side of a UNPI transport, so that adapters can be
+// simulated in Go for integration tests and demos.
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+)
+
+var MessageNotInLibrary = errors.New("message was not in message library")
+var MessageNotRequest = errors.New("handled messages must be SREQ or AREQ")
+var MessageNotAsynchronous = errors.New("only AREQ messages may be emitted")
+var InvalidResponse = errors.New("handler response breaks unpi rules")
+var UnexpectedFrame = errors.New("host sent a frame which is not a request")
+
+// Handler is called with a pointer to the decoded request. For an SREQ it must return the SRSP of the same
+// subsystem and command, for an AREQ it may return nil or an AREQ to emit. Returning an RPCErrorCode as the
+// error replies to an SREQ with an RPCError.
+type Handler func(req interface{}) (interface{}, error)
+
+type Emulator struct {
+	reader io.Reader
+	writer io.Writer
+
+	FrameReader func(r io.Reader) (unpi.Frame, error)
+	FrameWriter func(w io.Writer, frame unpi.Frame) error
+
+	// OnError is called with errors encountered while serving requests, by default they are logged.
+	OnError func(err error)
+
+	messageLibrary *library.Library
+
+	handlerMutex *sync.Mutex
+	handlers     map[library.Identity]Handler
+
+	// writeMutex guards writing, AREQs emitted while an SREQ is being answered are deferred until the SRSP
+	// has been written.
+	writeMutex  *sync.Mutex
+	answering   bool
+	deferred    []unpi.Frame
+	receivedEnd chan bool
+}
+
+func NewEmulator(reader io.Reader, writer io.Writer, ml *library.Library) *Emulator {
+	return &Emulator{
+		reader: reader,
+		writer: writer,
+
+		FrameReader: unpi.Read,
+		FrameWriter: unpi.Write,
+
+		OnError: func(err error) {
+			log.Printf("unpi emulator: %v\n", err)
+		},
+
+		messageLibrary: ml,
+
+		handlerMutex: &sync.Mutex{},
+		handlers:     map[library.Identity]Handler{},
+
+		writeMutex:  &sync.Mutex{},
+		receivedEnd: make(chan bool, 1),
+	}
+}
+
+// Handle registers the handler for the request type of req, replacing any existing handler.
+func (e *Emulator) Handle(req interface{}, h Handler) error {
+	identity, found := e.messageLibrary.GetByObject(req)
+	if !found {
+		return fmt.Errorf("%w: %T", MessageNotInLibrary, req)
+	}
+
+	if identity.MessageType != unpi.SREQ && identity.MessageType != unpi.AREQ {
+		return fmt.Errorf("%w: %T", MessageNotRequest, req)
+	}
+
+	e.handlerMutex.Lock()
+	defer e.handlerMutex.Unlock()
+
+	e.handlers[identity] = h
+
+	return nil
+}
+
+// Emit sends an AREQ to the host, it is safe to call from any goroutine.
+func (e *Emulator) Emit(v interface{}) error {
+	frame, err := e.frame(v)
+	if err != nil {
+		return err
+	}
+
+	if frame.MessageType != unpi.AREQ {
+		return fmt.Errorf("%w: %T", MessageNotAsynchronous, v)
+	}
+
+	return e.write(frame)
+}
+
+func (e *Emulator) Start() {
+	go e.handleReceiving()
+}
+
+func (e *Emulator) Stop() {
+	e.receivedEnd <- true
+}
+
+func (e *Emulator) handleReceiving() {
+	for {
+		frame, err := e.FrameReader(e.reader)
+
+		if err != nil {
+			if errors.Is(err, unpi.FrameChecksumFailed) || errors.Is(err, unpi.FrameTooShort) {
+				e.OnError(err)
+				continue
+			}
+
+			return
+		}
+
+		e.serve(frame)
+
+		select {
+		case <-e.receivedEnd:
+			return
+		default:
+		}
+	}
+}
+
+func (e *Emulator) serve(frame unpi.Frame) {
+	switch frame.MessageType {
+	case unpi.SREQ:
+		e.serveSynchronous(frame)
+	case unpi.AREQ:
+		e.serveAsynchronous(frame)
+	default:
+		e.OnError(fmt.Errorf("%w: type %d subsystem 0x%02x command 0x%02x", UnexpectedFrame, frame.MessageType, frame.Subsystem, frame.CommandID))
+	}
+}
+
+func (e *Emulator) serveSynchronous(frame unpi.Frame) {
+	e.writeMutex.Lock()
+	e.answering = true
+	e.writeMutex.Unlock()
+
+	e.writeAnswer(e.answer(frame))
+}
+
+// answer produces the SRSP for a synchronous request, or an RPCError if it cannot be produced.
+func (e *Emulator) answer(frame unpi.Frame) unpi.Frame {
+	h, found, subsystemFound := e.handler(frame)
+
+	if !found {
+		if subsystemFound {
+			return rpcErrorFrame(RPCErrorUnsupportedCommand, frame)
+		}
+
+		return rpcErrorFrame(RPCErrorUnsupportedSubsystem, frame)
+	}
+
+	req, err := e.decode(frame)
+	if err != nil {
+		return rpcErrorFrame(RPCErrorInvalidLength, frame)
+	}
+
+	resp, err := h(req)
+	if err != nil {
+		var code RPCErrorCode
+
+		if !errors.As(err, &code) {
+			e.OnError(fmt.Errorf("handler for 0x%02x/0x%02x: %w", frame.Subsystem, frame.CommandID, err))
+			code = RPCErrorInvalidParameter
+		}
+
+		return rpcErrorFrame(code, frame)
+	}
+
+	if resp == nil {
+		e.OnError(fmt.Errorf("%w: SREQ 0x%02x/0x%02x answered with nothing", InvalidResponse, frame.Subsystem, frame.CommandID))
+		return rpcErrorFrame(RPCErrorInvalidParameter, frame)
+	}
+
+	srsp, err := e.frame(resp)
+	if err != nil {
+		e.OnError(err)
+		return rpcErrorFrame(RPCErrorInvalidParameter, frame)
+	}
+
+	if srsp.MessageType != unpi.SRSP || srsp.Subsystem != frame.Subsystem || srsp.CommandID != frame.CommandID {
+		e.OnError(fmt.Errorf("%w: SREQ 0x%02x/0x%02x answered with %T", InvalidResponse, frame.Subsystem, frame.CommandID, resp))
+		return rpcErrorFrame(RPCErrorInvalidParameter, frame)
+	}
+
+	return srsp
+}
+
+func (e *Emulator) serveAsynchronous(frame unpi.Frame) {
+	h, found, _ := e.handler(frame)
+	if !found {
+		return
+	}
+
+	req, err := e.decode(frame)
+	if err != nil {
+		e.OnError(err)
+		return
+	}
+
+	resp, err := h(req)
+	if err != nil {
+		e.OnError(fmt.Errorf("handler for 0x%02x/0x%02x: %w", frame.Subsystem, frame.CommandID, err))
+		return
+	}
+
+	if resp == nil {
+		return
+	}
+
+	if err := e.Emit(resp); err != nil {
+		e.OnError(fmt.Errorf("%w: AREQ 0x%02x/0x%02x answered with %T: %v", InvalidResponse, frame.Subsystem, frame.CommandID, resp, err))
+	}
+}
+
+func (e *Emulator) handler(frame unpi.Frame) (Handler, bool, bool) {
+	e.handlerMutex.Lock()
+	defer e.handlerMutex.Unlock()
+
+	identity := library.Identity{MessageType: frame.MessageType, Subsystem: frame.Subsystem, CommandID: frame.CommandID}
+
+	if h, found := e.handlers[identity]; found {
+		return h, true, true
+	}
+
+	for other := range e.handlers {
+		if other.Subsystem == frame.Subsystem {
+			return nil, false, true
+		}
+	}
+
+	return nil, false, false
+}
+
+func (e *Emulator) decode(frame unpi.Frame) (interface{}, error) {
+	t, found := e.messageLibrary.GetByIdentifier(frame.MessageType, frame.Subsystem, frame.CommandID)
+	if !found {
+		return nil, MessageNotInLibrary
+	}
+
+	v := reflect.New(t).Interface()
+
+	if err := bytecodec.Unmarshal(frame.Payload, v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (e *Emulator) frame(v interface{}) (unpi.Frame, error) {
+	identity, found := e.messageLibrary.GetByObject(v)
+	if !found {
+		return unpi.Frame{}, fmt.Errorf("%w: %T", MessageNotInLibrary, v)
+	}
+
+	payload, err := bytecodec.Marshal(v)
+	if err != nil {
+		return unpi.Frame{}, err
+	}
+
+	return unpi.Frame{
+		MessageType: identity.MessageType,
+		Subsystem:   identity.Subsystem,
+		CommandID:   identity.CommandID,
+		Payload:     payload,
+	}, nil
+}
+
+func (e *Emulator) write(frame unpi.Frame) error {
+	e.writeMutex.Lock()
+	defer e.writeMutex.Unlock()
+
+	if e.answering {
+		e.deferred = append(e.deferred, frame)
+		return nil
+	}
+
+	return e.FrameWriter(e.writer, frame)
+}
+
+// writeAnswer writes the SRSP, followed by any AREQs emitted while it was being produced.
+func (e *Emulator) writeAnswer(srsp unpi.Frame) {
+	e.writeMutex.Lock()
+	defer e.writeMutex.Unlock()
+
+	e.answering = false
+
+	frames := append([]unpi.Frame{srsp}, e.deferred...)
+	e.deferred = nil
+
+	for _, f := range frames {
+		if err := e.FrameWriter(e.writer, f); err != nil {
+			e.OnError(err)
+			return
+		}
+	}
+}
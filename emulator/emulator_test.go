@@ -0,0 +1,307 @@
+package emulator
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type versionReq struct{}
+
+type versionReply struct {
+	Transport uint8
+	Product   uint8
+}
+
+type resetReq struct {
+	ResetType uint8
+}
+
+type resetInd struct {
+	Reason uint8
+}
+
+type permitJoinReq struct {
+	Duration uint8
+}
+
+type permitJoinReply struct {
+	Status uint8
+}
+
+type stateChangeInd struct {
+	State uint8
+}
+
+func testLibrary() *library.Library {
+	ml := library.NewLibrary()
+	ml.Add(unpi.SREQ, unpi.SYS, 0x02, versionReq{})
+	ml.Add(unpi.SRSP, unpi.SYS, 0x02, versionReply{})
+	ml.Add(unpi.AREQ, unpi.SYS, 0x00, resetReq{})
+	ml.Add(unpi.AREQ, unpi.SYS, 0x80, resetInd{})
+	ml.Add(unpi.SREQ, unpi.ZDO, 0x36, permitJoinReq{})
+	ml.Add(unpi.SRSP, unpi.ZDO, 0x36, permitJoinReply{})
+	ml.Add(unpi.AREQ, unpi.ZDO, 0xc0, stateChangeInd{})
+	Register(ml)
+	return ml
+}
+
+// host is the other end of the emulator's transport.
+type host struct {
+	io.Reader
+	io.Writer
+}
+
+func newEmulator(t *testing.T) (*Emulator, host) {
+	toEmulatorReader, toEmulatorWriter := io.Pipe()
+	toHostReader, toHostWriter := io.Pipe()
+
+	e := NewEmulator(toEmulatorReader, toHostWriter, testLibrary())
+	e.Start()
+
+	t.Cleanup(func() {
+		e.Stop()
+		_ = toEmulatorWriter.Close()
+		_ = toHostWriter.Close()
+	})
+
+	return e, host{Reader: toHostReader, Writer: toEmulatorWriter}
+}
+
+func TestEmulator_Synchronous(t *testing.T) {
+	t.Run("answers a synchronous request from its handler", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		assert.NoError(t, e.Handle(&versionReq{}, func(req interface{}) (interface{}, error) {
+			return versionReply{Transport: 2, Product: 1}, nil
+		}))
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.SYS, CommandID: 0x02})
+		frame, err := unpi.Read(h)
+
+		assert.NoError(t, err)
+		assert.Equal(t, unpi.Frame{MessageType: unpi.SRSP, Subsystem: unpi.SYS, CommandID: 0x02, Payload: []byte{0x02, 0x01}}, frame)
+	})
+
+	t.Run("passes the decoded request to the handler", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		var received *permitJoinReq
+
+		_ = e.Handle(permitJoinReq{}, func(req interface{}) (interface{}, error) {
+			received = req.(*permitJoinReq)
+			return permitJoinReply{}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.ZDO, CommandID: 0x36, Payload: []byte{0xfe}})
+		_, _ = unpi.Read(h)
+
+		assert.Equal(t, &permitJoinReq{Duration: 0xfe}, received)
+	})
+
+	t.Run("replies with an rpc error for unknown commands and subsystems", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		_ = e.Handle(versionReq{}, func(req interface{}) (interface{}, error) {
+			return versionReply{}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.SYS, CommandID: 0x09})
+		frame, err := unpi.Read(h)
+
+		assert.NoError(t, err)
+		assert.Equal(t, unpi.Frame{MessageType: unpi.SRSP, Subsystem: unpi.RES0, CommandID: 0x00, Payload: []byte{0x02, 0x21, 0x09}}, frame)
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.AF, CommandID: 0x01})
+		frame, err = unpi.Read(h)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x24, 0x01}, frame.Payload)
+	})
+
+	t.Run("replies with the rpc error returned by a handler", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		_ = e.Handle(permitJoinReq{}, func(req interface{}) (interface{}, error) {
+			return nil, RPCErrorInvalidParameter
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.ZDO, CommandID: 0x36, Payload: []byte{0x00}})
+		frame, _ := unpi.Read(h)
+
+		assert.Equal(t, []byte{0x03, 0x25, 0x36}, frame.Payload)
+	})
+
+	t.Run("replies with a length error if the request cannot be decoded", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		_ = e.Handle(permitJoinReq{}, func(req interface{}) (interface{}, error) {
+			return permitJoinReply{}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.ZDO, CommandID: 0x36})
+		frame, _ := unpi.Read(h)
+
+		assert.Equal(t, uint8(RPCErrorInvalidLength), frame.Payload[0])
+	})
+
+	t.Run("reports handlers which answer with the wrong response", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		var reported error
+		e.OnError = func(err error) {
+			reported = err
+		}
+
+		_ = e.Handle(versionReq{}, func(req interface{}) (interface{}, error) {
+			return permitJoinReply{}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.SYS, CommandID: 0x02})
+		frame, _ := unpi.Read(h)
+
+		assert.Equal(t, unpi.RES0, frame.Subsystem)
+		assert.True(t, errors.Is(reported, InvalidResponse))
+	})
+
+	t.Run("writes asynchronous messages emitted while answering after the response", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		_ = e.Handle(permitJoinReq{}, func(req interface{}) (interface{}, error) {
+			assert.NoError(t, e.Emit(stateChangeInd{State: 0x09}))
+			return permitJoinReply{}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.SREQ, Subsystem: unpi.ZDO, CommandID: 0x36, Payload: []byte{0x00}})
+
+		first, _ := unpi.Read(h)
+		second, _ := unpi.Read(h)
+
+		assert.Equal(t, unpi.SRSP, first.MessageType)
+		assert.Equal(t, unpi.Frame{MessageType: unpi.AREQ, Subsystem: unpi.ZDO, CommandID: 0xc0, Payload: []byte{0x09}}, second)
+	})
+}
+
+func TestEmulator_Asynchronous(t *testing.T) {
+	t.Run("emits the asynchronous message returned by a handler", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		_ = e.Handle(resetReq{}, func(req interface{}) (interface{}, error) {
+			return resetInd{Reason: 0x02}, nil
+		})
+
+		_ = unpi.Write(h, unpi.Frame{MessageType: unpi.AREQ, Subsystem: unpi.SYS, CommandID: 0x00, Payload: []byte{0x01}})
+		frame, err := unpi.Read(h)
+
+		assert.NoError(t, err)
+		assert.Equal(t, unpi.Frame{MessageType: unpi.AREQ, Subsystem: unpi.SYS, CommandID: 0x80, Payload: []byte{0x02}}, frame)
+	})
+
+	t.Run("emits from many goroutines", func(t *testing.T) {
+		e, h := newEmulator(t)
+
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, e.Emit(&stateChangeInd{State: uint8(i)}))
+			}(i)
+		}
+
+		seen := map[uint8]bool{}
+
+		for i := 0; i < 10; i++ {
+			frame, err := unpi.Read(h)
+			assert.NoError(t, err)
+
+			seen[frame.Payload[0]] = true
+		}
+
+		wg.Wait()
+		assert.Len(t, seen, 10)
+	})
+
+	t.Run("only asynchronous messages in the library can be emitted", func(t *testing.T) {
+		e, _ := newEmulator(t)
+
+		assert.True(t, errors.Is(e.Emit(versionReply{}), MessageNotAsynchronous))
+		assert.True(t, errors.Is(e.Emit(struct{}{}), MessageNotInLibrary))
+	})
+
+	t.Run("only requests in the library can be handled", func(t *testing.T) {
+		e, _ := newEmulator(t)
+		h := func(req interface{}) (interface{}, error) { return nil, nil }
+
+		assert.True(t, errors.Is(e.Handle(versionReply{}, h), MessageNotRequest))
+		assert.True(t, errors.Is(e.Handle(struct{}{}, h), MessageNotInLibrary))
+	})
+}
+
+func TestEmulator_Broker(t *testing.T) {
+	t.Run("serves a broker", func(t *testing.T) {
+		toEmulatorReader, toEmulatorWriter := io.Pipe()
+		toHostReader, toHostWriter := io.Pipe()
+		defer toEmulatorWriter.Close()
+		defer toHostWriter.Close()
+
+		ml := testLibrary()
+
+		e := NewEmulator(toEmulatorReader, toHostWriter, ml)
+		e.Start()
+		defer e.Stop()
+
+		_ = e.Handle(versionReq{}, func(req interface{}) (interface{}, error) {
+			return versionReply{Transport: 2, Product: 1}, nil
+		})
+
+		b := broker.NewBroker(toHostReader, toEmulatorWriter, ml)
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		reply := versionReply{}
+		err := b.RequestResponse(ctx, versionReq{}, &reply)
+
+		assert.NoError(t, err)
+		assert.Equal(t, versionReply{Transport: 2, Product: 1}, reply)
+	})
+
+	t.Run("broker requests the emulator cannot answer fail with the rpc error", func(t *testing.T) {
+		toEmulatorReader, toEmulatorWriter := io.Pipe()
+		toHostReader, toHostWriter := io.Pipe()
+		defer toEmulatorWriter.Close()
+		defer toHostWriter.Close()
+
+		ml := testLibrary()
+
+		e := NewEmulator(toEmulatorReader, toHostWriter, ml)
+		e.Start()
+		defer e.Stop()
+
+		b := broker.NewBroker(toHostReader, toEmulatorWriter, ml)
+		b.Start()
+		defer b.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		err := b.RequestResponse(ctx, permitJoinReq{Duration: 0xfe}, &permitJoinReply{})
+
+		assert.True(t, errors.Is(err, RPCErrorUnsupportedSubsystem))
+		assert.True(t, errors.As(err, &RPCError{}))
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+}
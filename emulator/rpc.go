@@ -0,0 +1,37 @@
+package emulator
+
+import (
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+)
+
+// RPCErrorCode is returned by an adapter in an RPCError when it cannot process a synchronous request, a
+// Handler may return one as its error to reply with it.
+type RPCErrorCode = unpi.RPCErrorCode
+
+const (
+	RPCErrorUnsupportedSubsystem = unpi.RPCErrorUnsupportedSubsystem
+	RPCErrorUnsupportedCommand   = unpi.RPCErrorUnsupportedCommand
+	RPCErrorInvalidParameter     = unpi.RPCErrorInvalidParameter
+	RPCErrorInvalidLength        = unpi.RPCErrorInvalidLength
+)
+
+// RPCError is sent as an SRSP in the RES0 subsystem in place of the response to a synchronous request which
+// could not be processed.
+type RPCError = unpi.RPCError
+
+// Register adds RPCError to a message library, so that hosts can decode it.
+func Register(ml *library.Library) {
+	ml.Add(unpi.SRSP, unpi.RES0, unpi.RPCErrorCommandID, RPCError{})
+}
+
+func rpcErrorFrame(code RPCErrorCode, req unpi.Frame) unpi.Frame {
+	rpcErr := unpi.NewRPCError(code, req)
+
+	return unpi.Frame{
+		MessageType: unpi.SRSP,
+		Subsystem:   unpi.RES0,
+		CommandID:   unpi.RPCErrorCommandID,
+		Payload:     []byte{uint8(rpcErr.ErrorCode), rpcErr.Cmd0, rpcErr.Cmd1},
+	}
+}
@@ -0,0 +1,302 @@
+// Package zstack emulates a Texas Instruments Z-Stack coordinator on top of the emulator package, keeping
+// NV items, forming networks through BDB commissioning or ZDO_STARTUP_FROM_APP, registering AF endpoints
+// and simulating devices which join the network and send messages to the host.
+package zstack
+
+import (
+	"errors"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/emulator"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/shimmeringbee/unpi/nv"
+	"github.com/shimmeringbee/unpi/znp"
+	"io"
+	"sync"
+	"time"
+)
+
+// Config describes the coordinator to emulate, zero values are replaced with defaults.
+type Config struct {
+	// Firmware selects the messages served and the layout of SYS_VERSION, the zero value is ZStack12.
+	Firmware znp.Firmware
+
+	// IEEEAddress is stored in ZCD_NV_EXTADDR when the coordinator is created.
+	IEEEAddress uint64
+
+	MajorRelease       uint8
+	MinorRelease       uint8
+	MaintenanceRelease uint8
+	Revision           uint32
+
+	// PanID and ExtendedPanID are used when a network is formed, unless already configured in NV.
+	PanID         uint16
+	ExtendedPanID uint64
+
+	// Channels is the channel mask networks are formed on, unless configured by the host.
+	Channels uint32
+
+	// CommissioningDelay is the time between each step of forming or restoring a network.
+	CommissioningDelay time.Duration
+}
+
+const defaultIEEEAddress uint64 = 0x00124b0012345678
+const defaultPanID uint16 = 0x1a62
+const defaultChannels uint32 = 0x00000800
+const defaultCommissioningDelay = 10 * time.Millisecond
+
+func (c Config) withDefaults() Config {
+	if c.IEEEAddress == 0 {
+		c.IEEEAddress = defaultIEEEAddress
+	}
+
+	if c.MajorRelease == 0 {
+		c.MajorRelease = 2
+
+		switch c.Firmware {
+		case znp.ZStack12:
+			c.MinorRelease, c.MaintenanceRelease, c.Revision = 6, 3, 20190608
+		case znp.ZStack30x:
+			c.MinorRelease, c.MaintenanceRelease, c.Revision = 7, 2, 20190425
+		default:
+			c.MinorRelease, c.MaintenanceRelease, c.Revision = 7, 1, 20210120
+		}
+	}
+
+	if c.PanID == 0 {
+		c.PanID = defaultPanID
+	}
+
+	if c.ExtendedPanID == 0 {
+		c.ExtendedPanID = c.IEEEAddress
+	}
+
+	if c.Channels == 0 {
+		c.Channels = defaultChannels
+	}
+
+	if c.CommissioningDelay <= 0 {
+		c.CommissioningDelay = defaultCommissioningDelay
+	}
+
+	return c
+}
+
+const transportRevision uint8 = 2
+
+// deviceTypeCoordinator is reported by UTIL_GET_DEVICE_INFO, coordinator firmware may act as a
+// coordinator, router or end device.
+const deviceTypeCoordinator uint8 = 0x07
+
+// Coordinator is an emulated Z-Stack coordinator. NV items survive resets, while the device state,
+// registered endpoints and permit join are lost as they would be on an adapter.
+type Coordinator struct {
+	*emulator.Emulator
+
+	config   Config
+	messages *library.Library
+
+	// OnDataRequest, if set, is called with each AF_DATA_REQUEST sent to a joined device after it has been
+	// confirmed, it may call Deliver to answer it. It must be set before the host sends data.
+	OnDataRequest func(device Device, req znp.AfDataRequest)
+
+	mutex *sync.Mutex
+
+	osal     map[uint16][]byte
+	extended map[nv.ExtendedKey][]byte
+
+	created time.Time
+
+	state             znp.DeviceState
+	channel           uint8
+	primaryChannels   uint32
+	secondaryChannels uint32
+	endpoints         map[uint8]znp.AfRegister
+	permitJoinUntil   time.Time
+	devices           map[uint64]Device
+	transaction       uint8
+
+	// generation is incremented by each reset, commissioning started before a reset is abandoned.
+	generation int
+	stop       chan struct{}
+	stopOnce   *sync.Once
+}
+
+// NewCoordinator creates a coordinator serving the host over reader and writer, the message library used
+// is that of the configured firmware. Commands which the firmware does not support are answered with an
+// RPC error.
+func NewCoordinator(reader io.Reader, writer io.Writer, config Config) *Coordinator {
+	config = config.withDefaults()
+
+	ml := znp.LibraryFor(config.Firmware)
+	emulator.Register(ml)
+
+	c := &Coordinator{
+		Emulator: emulator.NewEmulator(reader, writer, ml),
+		config:   config,
+		messages: ml,
+
+		mutex:   &sync.Mutex{},
+		created: time.Now(),
+
+		osal:     map[uint16][]byte{},
+		extended: map[nv.ExtendedKey][]byte{},
+
+		endpoints: map[uint8]znp.AfRegister{},
+		devices:   map[uint64]Device{},
+
+		stop:     make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}
+
+	c.osal[nv.ZCD_NV_EXTADDR] = littleEndian(config.IEEEAddress, 8)
+	c.osal[nv.ZCD_NV_CHANLIST] = littleEndian(uint64(config.Channels), 4)
+	c.osal[startupOptionItem] = []byte{0x00}
+
+	c.handle(&znp.SysPing{}, c.ping)
+	c.handle(&znp.SysVersion{}, c.version)
+	c.handle(&znp.SysResetReq{}, c.reset)
+	c.handle(&znp.SysGetExtAddr{}, c.getExtAddr)
+	c.handle(&znp.SysSetExtAddr{}, c.setExtAddr)
+	c.handle(&znp.UtilGetDeviceInfo{}, c.getDeviceInfo)
+
+	c.handleNV()
+	c.handleNetwork()
+
+	return c
+}
+
+// Stop stops serving the host and abandons any commissioning in progress.
+func (c *Coordinator) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	c.Emulator.Stop()
+}
+
+// State returns the current device state of the coordinator.
+func (c *Coordinator) State() znp.DeviceState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.state
+}
+
+// handle registers h for req, requests which are not in the firmware's message library are not served.
+func (c *Coordinator) handle(req interface{}, h emulator.Handler) {
+	if err := c.Handle(req, h); err != nil && !errors.Is(err, emulator.MessageNotInLibrary) {
+		panic(err)
+	}
+}
+
+// supports returns true if v is in the message library of the emulated firmware.
+func (c *Coordinator) supports(v interface{}) bool {
+	_, found := c.messages.GetByObject(v)
+	return found
+}
+
+func (c *Coordinator) ping(req interface{}) (interface{}, error) {
+	capabilities := unpi.MT_CAP_SYS | unpi.MT_CAP_AF | unpi.MT_CAP_ZDO | unpi.MT_CAP_SAPI | unpi.MT_CAP_UTIL | unpi.MT_CAP_APP
+
+	if c.supports(znp.AppCnfBdbStartCommissioning{}) {
+		capabilities |= unpi.MT_CAP_APP_CNF
+	}
+
+	return znp.SysPingReply{Capabilities: capabilities}, nil
+}
+
+func (c *Coordinator) version(req interface{}) (interface{}, error) {
+	return znp.SysVersionRevisionReply{
+		TransportRev:       transportRevision,
+		Product:            uint8(c.config.Firmware),
+		MajorRelease:       c.config.MajorRelease,
+		MinorRelease:       c.config.MinorRelease,
+		MaintenanceRelease: c.config.MaintenanceRelease,
+		Revision:           c.config.Revision,
+	}, nil
+}
+
+// reset restarts the coordinator, honouring ZCD_NV_STARTUP_OPTION, and announces it with SYS_RESET_IND.
+func (c *Coordinator) reset(req interface{}) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.state = znp.DeviceStateHold
+	c.endpoints = map[uint8]znp.AfRegister{}
+	c.permitJoinUntil = time.Time{}
+
+	c.applyStartupOption()
+
+	return znp.SysResetInd{
+		Reason:       znp.ResetReasonExternal,
+		TransportRev: transportRevision,
+		ProductID:    uint8(c.config.Firmware),
+		MajorRelease: c.config.MajorRelease,
+		MinorRelease: c.config.MinorRelease,
+	}, nil
+}
+
+func (c *Coordinator) getExtAddr(req interface{}) (interface{}, error) {
+	return znp.SysGetExtAddrReply{ExtAddress: c.ieeeAddress()}, nil
+}
+
+func (c *Coordinator) setExtAddr(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysSetExtAddr)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.osal[nv.ZCD_NV_EXTADDR] = littleEndian(r.ExtAddress, 8)
+
+	return znp.SysSetExtAddrReply{Status: znp.StatusSuccess}, nil
+}
+
+func (c *Coordinator) getDeviceInfo(req interface{}) (interface{}, error) {
+	ieeeAddress := c.ieeeAddress()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	networkAddress := uint16(0xfffe)
+	if c.state == znp.DeviceStateCoordinator {
+		networkAddress = 0x0000
+	}
+
+	return znp.UtilGetDeviceInfoReply{
+		Status:       znp.StatusSuccess,
+		IEEEAddress:  ieeeAddress,
+		NetworkAddr:  networkAddress,
+		DeviceType:   deviceTypeCoordinator,
+		DeviceState:  c.state,
+		AssocDevices: c.networkAddresses(),
+	}, nil
+}
+
+// ieeeAddress returns the address stored in ZCD_NV_EXTADDR, which the host may have changed.
+func (c *Coordinator) ieeeAddress() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return fromLittleEndian(c.osal[nv.ZCD_NV_EXTADDR])
+}
+
+func littleEndian(v uint64, size int) []byte {
+	data := make([]byte, size)
+
+	for i := range data {
+		data[i] = byte(v >> (8 * i))
+	}
+
+	return data
+}
+
+func fromLittleEndian(data []byte) uint64 {
+	var v uint64
+
+	for i := len(data) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+
+	return v
+}
@@ -0,0 +1,203 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/emulator"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+// transport is the host end of the coordinator's pipes.
+type transport struct {
+	io.Reader
+	io.Writer
+}
+
+func newTransport(t *testing.T, config Config) (*Coordinator, transport) {
+	toCoordinatorReader, toCoordinatorWriter := io.Pipe()
+	toHostReader, toHostWriter := io.Pipe()
+
+	c := NewCoordinator(toCoordinatorReader, toHostWriter, config)
+	c.Start()
+
+	t.Cleanup(func() {
+		c.Stop()
+		_ = toCoordinatorWriter.Close()
+		_ = toHostWriter.Close()
+	})
+
+	return c, transport{Reader: toHostReader, Writer: toCoordinatorWriter}
+}
+
+func hostLibrary(f znp.Firmware) *library.Library {
+	ml := znp.LibraryFor(f)
+	emulator.Register(ml)
+	return ml
+}
+
+func newCoordinator(t *testing.T, config Config) (*Coordinator, *broker.Broker) {
+	c, h := newTransport(t, config)
+
+	b := broker.NewBroker(h, h, hostLibrary(config.Firmware))
+	b.Start()
+
+	t.Cleanup(b.Stop)
+
+	return c, b
+}
+
+// subscribe collects the messages of the type of prototype, which must be a pointer, received by the host.
+func subscribe(t *testing.T, b *broker.Broker, prototype interface{}) chan interface{} {
+	ch := make(chan interface{}, 16)
+
+	err, cancel := b.Subscribe(prototype, func(v interface{}) {
+		ch <- v
+	})
+
+	assert.NoError(t, err)
+	t.Cleanup(cancel)
+
+	return ch
+}
+
+func receive(t *testing.T, ch chan interface{}) interface{} {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+// reset resets the coordinator, waiting until the broker has seen the reset so that it does not fail
+// later requests.
+func reset(t *testing.T, b *broker.Broker) broker.ResetIndication {
+	ch := make(chan broker.ResetIndication, 1)
+
+	cancel := b.Observe(func(e broker.Event) {
+		if reset, ok := e.(broker.AdapterReset); ok {
+			select {
+			case ch <- reset.Indication:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	assert.NoError(t, b.Request(znp.SysResetReq{ResetType: znp.ResetSoft}))
+
+	select {
+	case indication := <-ch:
+		return indication
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for reset")
+		return broker.ResetIndication{}
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestCoordinator_Connect(t *testing.T) {
+	t.Run("connects as Z-Stack 3.x.0", func(t *testing.T) {
+		_, h := newTransport(t, Config{Firmware: znp.ZStack3x0})
+
+		b, result, err := broker.Connect(testContext(t), h, broker.ConnectOptions{
+			Library:     hostLibrary(znp.ZStack3x0),
+			DrainPeriod: time.Millisecond,
+		})
+
+		assert.NoError(t, err)
+		defer b.Stop()
+
+		assert.Equal(t, uint8(znp.ZStack3x0), result.Version.Product)
+		assert.Equal(t, uint32(20210120), result.Version.Revision)
+		assert.True(t, result.Capabilities&unpi.MT_CAP_APP_CNF != 0)
+	})
+
+	t.Run("connects as Z-Stack Home 1.2 without APP_CNF", func(t *testing.T) {
+		_, h := newTransport(t, Config{Firmware: znp.ZStack12})
+
+		b, result, err := broker.Connect(testContext(t), h, broker.ConnectOptions{
+			Library:     hostLibrary(znp.ZStack12),
+			DrainPeriod: time.Millisecond,
+		})
+
+		assert.NoError(t, err)
+		defer b.Stop()
+
+		assert.Equal(t, broker.Version{TransportRev: 2, Product: uint8(znp.ZStack12), MajorRelease: 2, MinorRelease: 6, MaintenanceRelease: 3, Revision: 20190608}, result.Version)
+		assert.True(t, result.Capabilities&unpi.MT_CAP_APP_CNF == 0)
+	})
+
+	t.Run("connects and forms a network over a serial like pipe", func(t *testing.T) {
+		host, adapter := testunpi.Pipe(
+			testunpi.WithLatency(2*time.Millisecond),
+			testunpi.WithBandwidth(11520),
+			testunpi.WithPipeFaults(1, 0.5, testunpi.FaultGarbage, testunpi.FaultSplitReads),
+		)
+		defer host.Close()
+		defer adapter.Close()
+
+		c := NewCoordinator(adapter, adapter, Config{Firmware: znp.ZStack3x0})
+		c.Start()
+		defer c.Stop()
+
+		b, _, err := broker.Connect(testContext(t), host, broker.ConnectOptions{
+			Library:     hostLibrary(znp.ZStack3x0),
+			DrainPeriod: time.Millisecond,
+		})
+
+		assert.NoError(t, err)
+		defer b.Stop()
+
+		form(t, b)
+		assert.Equal(t, znp.DeviceStateCoordinator, c.State())
+	})
+}
+
+func TestCoordinator_Reset(t *testing.T) {
+	t.Run("announces resets and loses registered endpoints", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AfRegister{Endpoint: 1}, &znp.AfRegisterReply{}))
+		assert.Len(t, c.Endpoints(), 1)
+
+		ind := reset(t, b)
+		assert.Equal(t, broker.ResetExternal, ind.Reason)
+		assert.Equal(t, uint8(znp.ZStack3x0), ind.ProductID)
+
+		assert.Empty(t, c.Endpoints())
+		assert.Equal(t, znp.DeviceStateHold, c.State())
+	})
+}
+
+func TestCoordinator_DeviceInfo(t *testing.T) {
+	t.Run("reports the ieee address from NV, which the host may change", func(t *testing.T) {
+		_, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0, IEEEAddress: 0x00124b0001020304})
+
+		info := znp.UtilGetDeviceInfoReply{}
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.UtilGetDeviceInfo{}, &info))
+
+		assert.Equal(t, uint64(0x00124b0001020304), info.IEEEAddress)
+		assert.Equal(t, uint16(0xfffe), info.NetworkAddr)
+		assert.Equal(t, znp.DeviceStateHold, info.DeviceState)
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.SysSetExtAddr{ExtAddress: 0x1122334455667788}, &znp.SysSetExtAddrReply{}))
+
+		addr := znp.SysGetExtAddrReply{}
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.SysGetExtAddr{}, &addr))
+		assert.Equal(t, uint64(0x1122334455667788), addr.ExtAddress)
+	})
+}
@@ -0,0 +1,522 @@
+package zstack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/unpi/nv"
+	"github.com/shimmeringbee/unpi/znp"
+	"sort"
+	"time"
+)
+
+var NetworkNotFormed = errors.New("coordinator is not running a network")
+var JoiningNotPermitted = errors.New("joining is not permitted")
+var DeviceNotJoined = errors.New("device has not joined the network")
+var EndpointNotRegistered = errors.New("endpoint has not been registered")
+
+// Device is a device simulated as joined to the coordinator's network.
+type Device struct {
+	IEEEAddress uint64
+	// NetworkAddress is assigned when the device joins, if it is zero.
+	NetworkAddress uint16
+	// Capabilities are the MAC capability flags announced by the device.
+	Capabilities uint8
+}
+
+// Incoming is a message sent by a joined device to an endpoint of the coordinator.
+type Incoming struct {
+	GroupID             uint16
+	ClusterID           uint16
+	SourceEndpoint      uint8
+	DestinationEndpoint uint8
+	LinkQuality         uint8
+	Data                []byte
+}
+
+// nibSize is the length of ZCD_NV_NIB, its content is not modelled, the item existing marks a formed
+// network.
+const nibSize = 116
+
+const coordinatorAddress uint16 = 0x0000
+const invalidAddress uint16 = 0xfffe
+const broadcastAddresses uint16 = 0xfff8
+
+const permitJoinForever uint8 = 0xff
+
+// steeringPermitDuration is the time joining is permitted for by BDB network steering, in seconds.
+const steeringPermitDuration uint8 = 180
+
+// step is one step of commissioning, it is run under the mutex and returns the messages to emit.
+type step func() []interface{}
+
+func (c *Coordinator) handleNetwork() {
+	c.handle(&znp.ZdoStartupFromApp{}, c.startupFromApp)
+	c.handle(&znp.AppCnfBdbStartCommissioning{}, c.startCommissioning)
+	c.handle(&znp.AppCnfBdbSetChannel{}, c.setChannel)
+	c.handle(&znp.ZdoMgmtPermitJoinReq{}, c.permitJoinRequest)
+	c.handle(&znp.ZdoExtNwkInfo{}, c.extNwkInfo)
+	c.handle(&znp.AfRegister{}, c.register)
+	c.handle(&znp.AfDataRequest{}, c.dataRequest)
+}
+
+// Join simulates a device joining the network, announcing it to the host with ZDO_TC_DEV_IND and
+// ZDO_END_DEVICE_ANNCE_IND. Joining must be permitted, a device which has already joined rejoins with its
+// existing network address. The device is returned with its network address.
+func (c *Coordinator) Join(device Device) (Device, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.running() {
+		return Device{}, NetworkNotFormed
+	}
+
+	if !c.joiningPermitted() {
+		return Device{}, JoiningNotPermitted
+	}
+
+	if existing, found := c.devices[device.IEEEAddress]; found {
+		device.NetworkAddress = existing.NetworkAddress
+	} else if device.NetworkAddress == 0 || !c.addressFree(device.NetworkAddress) {
+		device.NetworkAddress = c.assignAddress(device.IEEEAddress)
+	}
+
+	c.devices[device.IEEEAddress] = device
+
+	if err := c.Emit(znp.ZdoTCDevInd{NetworkAddress: device.NetworkAddress, IEEEAddress: device.IEEEAddress, ParentAddress: coordinatorAddress}); err != nil {
+		return Device{}, err
+	}
+
+	announce := znp.ZdoEndDeviceAnnceInd{
+		SourceAddress:  device.NetworkAddress,
+		NetworkAddress: device.NetworkAddress,
+		IEEEAddress:    device.IEEEAddress,
+		Capabilities:   device.Capabilities,
+	}
+
+	return device, c.Emit(announce)
+}
+
+// Leave simulates a joined device leaving the network, announcing it to the host with ZDO_LEAVE_IND.
+func (c *Coordinator) Leave(ieeeAddress uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	device, found := c.devices[ieeeAddress]
+	if !found {
+		return fmt.Errorf("%w: 0x%016x", DeviceNotJoined, ieeeAddress)
+	}
+
+	delete(c.devices, ieeeAddress)
+
+	return c.Emit(znp.ZdoLeaveInd{SourceAddress: device.NetworkAddress, IEEEAddress: ieeeAddress})
+}
+
+// Deliver simulates a joined device sending a message to a registered endpoint of the coordinator, it is
+// sent to the host as AF_INCOMING_MSG.
+func (c *Coordinator) Deliver(ieeeAddress uint64, msg Incoming) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	device, found := c.devices[ieeeAddress]
+	if !found {
+		return fmt.Errorf("%w: 0x%016x", DeviceNotJoined, ieeeAddress)
+	}
+
+	if _, found := c.endpoints[msg.DestinationEndpoint]; !found {
+		return fmt.Errorf("%w: %d", EndpointNotRegistered, msg.DestinationEndpoint)
+	}
+
+	c.transaction++
+
+	return c.Emit(znp.AfIncomingMsg{
+		GroupID:             msg.GroupID,
+		ClusterID:           msg.ClusterID,
+		SourceAddress:       device.NetworkAddress,
+		SourceEndpoint:      msg.SourceEndpoint,
+		DestinationEndpoint: msg.DestinationEndpoint,
+		LinkQuality:         msg.LinkQuality,
+		Timestamp:           uint32(time.Since(c.created) / time.Millisecond),
+		TransactionSequence: c.transaction,
+		Data:                msg.Data,
+	})
+}
+
+// Devices returns the devices joined to the network, ordered by IEEE address.
+func (c *Coordinator) Devices() []Device {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var devices []Device
+
+	for _, device := range c.devices {
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].IEEEAddress < devices[j].IEEEAddress
+	})
+
+	return devices
+}
+
+// Endpoints returns the AF endpoints registered by the host since the last reset.
+func (c *Coordinator) Endpoints() []znp.AfRegister {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var endpoints []znp.AfRegister
+
+	for _, endpoint := range c.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Endpoint < endpoints[j].Endpoint
+	})
+
+	return endpoints
+}
+
+// startupFromApp starts the network on Z-Stack Home 1.2, restoring it from NV or forming a new network.
+func (c *Coordinator) startupFromApp(req interface{}) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.running() {
+		return znp.ZdoStartupFromAppReply{StartupStatus: znp.StartupRestoredNetworkState}, nil
+	}
+
+	if c.formed() {
+		c.run(c.stateStep(znp.DeviceStateCoordStarting), c.stateStep(znp.DeviceStateCoordinator))
+		return znp.ZdoStartupFromAppReply{StartupStatus: znp.StartupRestoredNetworkState}, nil
+	}
+
+	c.run(c.stateStep(znp.DeviceStateCoordStarting), c.formStep())
+	return znp.ZdoStartupFromAppReply{StartupStatus: znp.StartupNewNetworkState}, nil
+}
+
+// startCommissioning runs BDB commissioning, reporting progress with APP_CNF_BDB_COMMISSIONING_NOTIFICATION.
+// Initialisation restores a network from NV, formation forms a network if none exists and steering
+// permits joining. Touchlink and finding and binding are reported as failed.
+func (c *Coordinator) startCommissioning(req interface{}) (interface{}, error) {
+	r := req.(*znp.AppCnfBdbStartCommissioning)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var steps []step
+
+	if r.Mode == znp.CommissioningModeInitialisation {
+		switch {
+		case c.running():
+			steps = append(steps, c.notifyStep(znp.CommissioningSuccess, znp.CommissioningModeInitialisation, 0))
+		case c.formed():
+			steps = append(steps, c.stateStep(znp.DeviceStateCoordStarting), c.stateStep(znp.DeviceStateCoordinator),
+				c.notifyStep(znp.CommissioningNetworkRestored, znp.CommissioningModeInitialisation, 0))
+		default:
+			steps = append(steps, c.notifyStep(znp.CommissioningNoNetwork, znp.CommissioningModeInitialisation, 0))
+		}
+	}
+
+	remaining := r.Mode
+
+	for _, mode := range []uint8{znp.CommissioningModeTouchlink, znp.CommissioningModeFormation, znp.CommissioningModeSteering, znp.CommissioningModeFindingBinding} {
+		if r.Mode&mode == 0 {
+			continue
+		}
+
+		remaining &^= mode
+
+		switch mode {
+		case znp.CommissioningModeTouchlink:
+			steps = append(steps, c.notifyStep(znp.CommissioningTLNotPermitted, mode, remaining))
+		case znp.CommissioningModeFormation:
+			if c.formed() {
+				steps = append(steps, c.notifyStep(znp.CommissioningSuccess, mode, remaining))
+			} else {
+				steps = append(steps, c.notifyStep(znp.CommissioningInProgress, mode, remaining),
+					c.stateStep(znp.DeviceStateCoordStarting), c.formStep(), c.notifyStep(znp.CommissioningSuccess, mode, remaining))
+			}
+		case znp.CommissioningModeSteering:
+			steps = append(steps, c.steeringStep(remaining))
+		case znp.CommissioningModeFindingBinding:
+			steps = append(steps, c.notifyStep(znp.CommissioningFBNoIdentifyQueryResponse, mode, remaining))
+		}
+	}
+
+	c.run(steps...)
+
+	return znp.AppCnfBdbStartCommissioningReply{Status: znp.StatusSuccess}, nil
+}
+
+func (c *Coordinator) setChannel(req interface{}) (interface{}, error) {
+	r := req.(*znp.AppCnfBdbSetChannel)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if r.IsPrimary != 0 {
+		c.primaryChannels = r.Channels
+	} else {
+		c.secondaryChannels = r.Channels
+	}
+
+	return znp.AppCnfBdbSetChannelReply{Status: znp.StatusSuccess}, nil
+}
+
+func (c *Coordinator) permitJoinRequest(req interface{}) (interface{}, error) {
+	r := req.(*znp.ZdoMgmtPermitJoinReq)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.running() {
+		return znp.ZdoMgmtPermitJoinReqReply{Status: znp.StatusZDONotActive}, nil
+	}
+
+	source := r.DestinationAddress
+	if source >= broadcastAddresses {
+		source = coordinatorAddress
+	}
+
+	c.permitJoin(r.Duration)
+
+	c.emit(znp.ZdoMgmtPermitJoinRsp{SourceAddress: source, Status: znp.StatusSuccess})
+	c.emit(znp.ZdoPermitJoinInd{Duration: r.Duration})
+
+	return znp.ZdoMgmtPermitJoinReqReply{Status: znp.StatusSuccess}, nil
+}
+
+func (c *Coordinator) extNwkInfo(req interface{}) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	reply := znp.ZdoExtNwkInfoReply{
+		NetworkAddress: invalidAddress,
+		DeviceState:    c.state,
+		PanID:          0xffff,
+		ParentAddress:  invalidAddress,
+	}
+
+	if c.running() {
+		reply.NetworkAddress = coordinatorAddress
+		reply.PanID = uint16(fromLittleEndian(c.osal[nv.ZCD_NV_PANID]))
+		reply.ExtendedPanID = fromLittleEndian(c.osal[nv.ZCD_NV_EXTENDED_PAN_ID])
+		reply.LogicalChannel = c.channel
+	}
+
+	return reply, nil
+}
+
+func (c *Coordinator) register(req interface{}) (interface{}, error) {
+	r := req.(*znp.AfRegister)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.endpoints[r.Endpoint]; found {
+		return znp.AfRegisterReply{Status: znp.StatusAPSDuplicateEntry}, nil
+	}
+
+	c.endpoints[r.Endpoint] = *r
+
+	return znp.AfRegisterReply{Status: znp.StatusSuccess}, nil
+}
+
+// dataRequest accepts data for a joined device or a broadcast, and confirms it with AF_DATA_CONFIRM. Data
+// for any other address is confirmed with a MAC no ack.
+func (c *Coordinator) dataRequest(req interface{}) (interface{}, error) {
+	r := req.(*znp.AfDataRequest)
+
+	c.mutex.Lock()
+
+	if _, found := c.endpoints[r.SourceEndpoint]; !found || !c.running() {
+		c.mutex.Unlock()
+		return znp.AfDataRequestReply{Status: znp.StatusInvalidParameter}, nil
+	}
+
+	device, joined := c.device(r.DestinationAddress)
+
+	status := znp.StatusMACNoAck
+	if joined || r.DestinationAddress >= broadcastAddresses {
+		status = znp.StatusSuccess
+	}
+
+	c.emit(znp.AfDataConfirm{Status: status, Endpoint: r.SourceEndpoint, TransactionID: r.TransactionID})
+	c.mutex.Unlock()
+
+	if joined && c.OnDataRequest != nil {
+		c.OnDataRequest(device, *r)
+	}
+
+	return znp.AfDataRequestReply{Status: znp.StatusSuccess}, nil
+}
+
+// run performs the steps of commissioning in order, separated by the commissioning delay. Commissioning
+// is abandoned if the coordinator is reset or stopped. The mutex must be held.
+func (c *Coordinator) run(steps ...step) {
+	generation := c.generation
+
+	go func() {
+		for _, s := range steps {
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(c.config.CommissioningDelay):
+			}
+
+			c.mutex.Lock()
+
+			if c.generation != generation {
+				c.mutex.Unlock()
+				return
+			}
+
+			for _, msg := range s() {
+				c.emit(msg)
+			}
+
+			c.mutex.Unlock()
+		}
+	}()
+}
+
+func (c *Coordinator) stateStep(state znp.DeviceState) step {
+	return func() []interface{} {
+		c.state = state
+		return []interface{}{znp.ZdoStateChangeInd{State: state}}
+	}
+}
+
+func (c *Coordinator) notifyStep(status znp.CommissioningStatus, mode uint8, remaining uint8) step {
+	return func() []interface{} {
+		return []interface{}{znp.AppCnfBdbCommissioningNotification{Status: status, CommissioningMode: mode, RemainingCommissioningModes: remaining}}
+	}
+}
+
+// formStep forms a network, storing it in NV and becoming the coordinator of it.
+func (c *Coordinator) formStep() step {
+	return func() []interface{} {
+		if fromLittleEndian(c.osal[nv.ZCD_NV_PANID]) == 0 || fromLittleEndian(c.osal[nv.ZCD_NV_PANID]) == 0xffff {
+			c.osal[nv.ZCD_NV_PANID] = littleEndian(uint64(c.config.PanID), 2)
+		}
+
+		if fromLittleEndian(c.osal[nv.ZCD_NV_EXTENDED_PAN_ID]) == 0 {
+			c.osal[nv.ZCD_NV_EXTENDED_PAN_ID] = littleEndian(c.config.ExtendedPanID, 8)
+		}
+
+		c.osal[nv.ZCD_NV_NIB] = make([]byte, nibSize)
+		c.channel = lowestChannel(c.primaryChannels, c.secondaryChannels, uint32(fromLittleEndian(c.osal[nv.ZCD_NV_CHANLIST])))
+		c.state = znp.DeviceStateCoordinator
+
+		return []interface{}{znp.ZdoStateChangeInd{State: c.state}}
+	}
+}
+
+// steeringStep permits joining on a running network.
+func (c *Coordinator) steeringStep(remaining uint8) step {
+	return func() []interface{} {
+		if !c.running() {
+			return c.notifyStep(znp.CommissioningNoNetwork, znp.CommissioningModeSteering, remaining)()
+		}
+
+		c.permitJoin(steeringPermitDuration)
+
+		return append([]interface{}{znp.ZdoPermitJoinInd{Duration: steeringPermitDuration}},
+			c.notifyStep(znp.CommissioningSuccess, znp.CommissioningModeSteering, remaining)()...)
+	}
+}
+
+// emit sends an AREQ to the host, reporting failures through OnError.
+func (c *Coordinator) emit(v interface{}) {
+	if err := c.Emit(v); err != nil {
+		c.OnError(err)
+	}
+}
+
+// formed returns true if a network is stored in NV. The mutex must be held.
+func (c *Coordinator) formed() bool {
+	_, found := c.osal[nv.ZCD_NV_NIB]
+	return found
+}
+
+// running returns true if the coordinator has started its network. The mutex must be held.
+func (c *Coordinator) running() bool {
+	return c.state == znp.DeviceStateCoordinator
+}
+
+// permitJoin permits joining for duration seconds, zero prevents joining and 0xff permits it until
+// changed. The mutex must be held.
+func (c *Coordinator) permitJoin(duration uint8) {
+	switch duration {
+	case 0:
+		c.permitJoinUntil = time.Time{}
+	case permitJoinForever:
+		c.permitJoinUntil = time.Unix(1<<62, 0)
+	default:
+		c.permitJoinUntil = time.Now().Add(time.Duration(duration) * time.Second)
+	}
+}
+
+func (c *Coordinator) joiningPermitted() bool {
+	return time.Now().Before(c.permitJoinUntil)
+}
+
+func (c *Coordinator) device(networkAddress uint16) (Device, bool) {
+	for _, device := range c.devices {
+		if device.NetworkAddress == networkAddress {
+			return device, true
+		}
+	}
+
+	return Device{}, false
+}
+
+// networkAddresses returns the network addresses of joined devices in order. The mutex must be held.
+func (c *Coordinator) networkAddresses() []uint16 {
+	addresses := []uint16{}
+
+	for _, device := range c.devices {
+		addresses = append(addresses, device.NetworkAddress)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i] < addresses[j]
+	})
+
+	return addresses
+}
+
+// assignAddress derives a network address from the IEEE address, so that devices have the same address
+// in every run.
+func (c *Coordinator) assignAddress(ieeeAddress uint64) uint16 {
+	address := uint16(ieeeAddress ^ ieeeAddress>>16 ^ ieeeAddress>>32 ^ ieeeAddress>>48)
+
+	for !c.addressFree(address) {
+		address++
+	}
+
+	return address
+}
+
+func (c *Coordinator) addressFree(address uint16) bool {
+	if address == coordinatorAddress || address >= broadcastAddresses {
+		return false
+	}
+
+	_, found := c.device(address)
+	return !found
+}
+
+// lowestChannel returns the lowest channel in the first non empty mask.
+func lowestChannel(masks ...uint32) uint8 {
+	for _, mask := range masks {
+		for channel := uint8(11); channel <= 26; channel++ {
+			if mask&(1<<channel) != 0 {
+				return channel
+			}
+		}
+	}
+
+	return 11
+}
@@ -0,0 +1,218 @@
+package zstack
+
+import (
+	"errors"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/nv"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// form forms a network with BDB commissioning, waiting for it to complete.
+func form(t *testing.T, b *broker.Broker) {
+	notifications := subscribe(t, b, &znp.AppCnfBdbCommissioningNotification{})
+
+	assert.NoError(t, b.RequestResponse(testContext(t), znp.AppCnfBdbStartCommissioning{Mode: znp.CommissioningModeFormation}, &znp.AppCnfBdbStartCommissioningReply{}))
+
+	for {
+		notification := receive(t, notifications).(*znp.AppCnfBdbCommissioningNotification)
+
+		if notification.Status != znp.CommissioningInProgress {
+			assert.Equal(t, znp.CommissioningSuccess, notification.Status)
+			return
+		}
+	}
+}
+
+func permitJoin(t *testing.T, b *broker.Broker) {
+	req := znp.ZdoMgmtPermitJoinReq{AddressMode: 0x0f, DestinationAddress: 0xfffc, Duration: 0xff}
+	assert.NoError(t, b.RequestResponse(testContext(t), req, &znp.ZdoMgmtPermitJoinReqReply{}))
+}
+
+func TestCoordinator_Commissioning(t *testing.T) {
+	t.Run("forms a network with BDB commissioning", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0, PanID: 0x1234, Channels: 0x02000000})
+		states := subscribe(t, b, &znp.ZdoStateChangeInd{})
+
+		form(t, b)
+
+		assert.Equal(t, &znp.ZdoStateChangeInd{State: znp.DeviceStateCoordStarting}, receive(t, states))
+		assert.Equal(t, &znp.ZdoStateChangeInd{State: znp.DeviceStateCoordinator}, receive(t, states))
+		assert.Equal(t, znp.DeviceStateCoordinator, c.State())
+
+		_, found := c.OSALItem(nv.ZCD_NV_NIB)
+		assert.True(t, found)
+
+		info := znp.ZdoExtNwkInfoReply{}
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.ZdoExtNwkInfo{}, &info))
+
+		assert.Equal(t, uint16(0x1234), info.PanID)
+		assert.Equal(t, uint8(25), info.LogicalChannel)
+		assert.Equal(t, uint16(0x0000), info.NetworkAddress)
+	})
+
+	t.Run("restores a formed network after a reset", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		form(t, b)
+
+		reset(t, b)
+
+		assert.Equal(t, znp.DeviceStateHold, c.State())
+
+		notifications := subscribe(t, b, &znp.AppCnfBdbCommissioningNotification{})
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AppCnfBdbStartCommissioning{Mode: znp.CommissioningModeInitialisation}, &znp.AppCnfBdbStartCommissioningReply{}))
+
+		notification := receive(t, notifications).(*znp.AppCnfBdbCommissioningNotification)
+		assert.Equal(t, znp.CommissioningNetworkRestored, notification.Status)
+		assert.Equal(t, znp.DeviceStateCoordinator, c.State())
+	})
+
+	t.Run("steering without a network reports no network", func(t *testing.T) {
+		_, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		notifications := subscribe(t, b, &znp.AppCnfBdbCommissioningNotification{})
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AppCnfBdbStartCommissioning{Mode: znp.CommissioningModeSteering}, &znp.AppCnfBdbStartCommissioningReply{}))
+
+		notification := receive(t, notifications).(*znp.AppCnfBdbCommissioningNotification)
+		assert.Equal(t, znp.CommissioningNoNetwork, notification.Status)
+	})
+
+	t.Run("starts a network from the application on Z-Stack Home 1.2", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack12})
+		states := subscribe(t, b, &znp.ZdoStateChangeInd{})
+
+		reply := znp.ZdoStartupFromAppReply{}
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.ZdoStartupFromApp{}, &reply))
+		assert.Equal(t, znp.StartupNewNetworkState, reply.StartupStatus)
+
+		receive(t, states)
+		receive(t, states)
+		assert.Equal(t, znp.DeviceStateCoordinator, c.State())
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.ZdoStartupFromApp{}, &reply))
+		assert.Equal(t, znp.StartupRestoredNetworkState, reply.StartupStatus)
+	})
+
+	t.Run("a network migrated with an NV backup is restored", func(t *testing.T) {
+		_, source := newCoordinator(t, Config{Firmware: znp.ZStack3x0, PanID: 0x4321})
+		form(t, source)
+
+		backup, err := nv.Create(testContext(t), source, nv.ItemsFor(znp.ZStack3x0), uint8(znp.ZStack3x0))
+		assert.NoError(t, err)
+
+		c, destination := newCoordinator(t, Config{Firmware: znp.ZStack3x0, IEEEAddress: 0x00124b00aabbccdd})
+		assert.NoError(t, nv.Restore(testContext(t), destination, backup, uint8(znp.ZStack3x0)))
+
+		notifications := subscribe(t, destination, &znp.AppCnfBdbCommissioningNotification{})
+		assert.NoError(t, destination.RequestResponse(testContext(t), znp.AppCnfBdbStartCommissioning{Mode: znp.CommissioningModeInitialisation}, &znp.AppCnfBdbStartCommissioningReply{}))
+
+		notification := receive(t, notifications).(*znp.AppCnfBdbCommissioningNotification)
+		assert.Equal(t, znp.CommissioningNetworkRestored, notification.Status)
+
+		panID, _ := c.OSALItem(nv.ZCD_NV_PANID)
+		assert.Equal(t, []byte{0x21, 0x43}, panID)
+	})
+}
+
+func TestCoordinator_Devices(t *testing.T) {
+	t.Run("devices may only join while joining is permitted", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		_, err := c.Join(Device{IEEEAddress: 0x0011223344556677})
+		assert.True(t, errors.Is(err, NetworkNotFormed))
+
+		form(t, b)
+
+		_, err = c.Join(Device{IEEEAddress: 0x0011223344556677})
+		assert.True(t, errors.Is(err, JoiningNotPermitted))
+	})
+
+	t.Run("joining devices are announced to the host", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		form(t, b)
+		permitJoin(t, b)
+
+		announcements := subscribe(t, b, &znp.ZdoEndDeviceAnnceInd{})
+
+		device, err := c.Join(Device{IEEEAddress: 0x0011223344556677, Capabilities: 0x8e})
+		assert.NoError(t, err)
+		assert.NotZero(t, device.NetworkAddress)
+
+		announcement := receive(t, announcements).(*znp.ZdoEndDeviceAnnceInd)
+		assert.Equal(t, device.NetworkAddress, announcement.NetworkAddress)
+		assert.Equal(t, uint64(0x0011223344556677), announcement.IEEEAddress)
+		assert.Equal(t, uint8(0x8e), announcement.Capabilities)
+
+		info := znp.UtilGetDeviceInfoReply{}
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.UtilGetDeviceInfo{}, &info))
+		assert.Equal(t, []uint16{device.NetworkAddress}, info.AssocDevices)
+
+		rejoined, err := c.Join(Device{IEEEAddress: 0x0011223344556677})
+		assert.NoError(t, err)
+		assert.Equal(t, device.NetworkAddress, rejoined.NetworkAddress)
+	})
+
+	t.Run("joined devices send messages to registered endpoints", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		form(t, b)
+		permitJoin(t, b)
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AfRegister{Endpoint: 1, AppProfileID: 0x0104}, &znp.AfRegisterReply{}))
+
+		device, _ := c.Join(Device{IEEEAddress: 0x0011223344556677})
+		incoming := subscribe(t, b, &znp.AfIncomingMsg{})
+
+		err := c.Deliver(device.IEEEAddress, Incoming{ClusterID: 0x0006, SourceEndpoint: 1, DestinationEndpoint: 2, Data: []byte{0x18, 0x01, 0x0a}})
+		assert.True(t, errors.Is(err, EndpointNotRegistered))
+
+		assert.NoError(t, c.Deliver(device.IEEEAddress, Incoming{ClusterID: 0x0006, SourceEndpoint: 1, DestinationEndpoint: 1, LinkQuality: 200, Data: []byte{0x18, 0x01, 0x0a}}))
+
+		msg := receive(t, incoming).(*znp.AfIncomingMsg)
+		assert.Equal(t, device.NetworkAddress, msg.SourceAddress)
+		assert.Equal(t, uint16(0x0006), msg.ClusterID)
+		assert.Equal(t, uint8(200), msg.LinkQuality)
+		assert.Equal(t, []byte{0x18, 0x01, 0x0a}, msg.Data)
+
+		err = c.Deliver(0x0102030405060708, Incoming{DestinationEndpoint: 1})
+		assert.True(t, errors.Is(err, DeviceNotJoined))
+	})
+
+	t.Run("endpoints may only be registered once", func(t *testing.T) {
+		_, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AfRegister{Endpoint: 1}, &znp.AfRegisterReply{}))
+
+		err := b.RequestResponse(testContext(t), znp.AfRegister{Endpoint: 1}, &znp.AfRegisterReply{})
+		statusErr := broker.StatusError{}
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, uint8(znp.StatusAPSDuplicateEntry), statusErr.Code)
+	})
+
+	t.Run("data requests are confirmed and passed to the device", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		c.OnDataRequest = func(device Device, req znp.AfDataRequest) {
+			_ = c.Deliver(device.IEEEAddress, Incoming{ClusterID: req.ClusterID, SourceEndpoint: req.DestinationEndpoint, DestinationEndpoint: req.SourceEndpoint, Data: []byte{0x18, req.Data[1], 0x01}})
+		}
+
+		form(t, b)
+		permitJoin(t, b)
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.AfRegister{Endpoint: 1}, &znp.AfRegisterReply{}))
+		device, _ := c.Join(Device{IEEEAddress: 0x0011223344556677})
+
+		confirms := subscribe(t, b, &znp.AfDataConfirm{})
+		incoming := subscribe(t, b, &znp.AfIncomingMsg{})
+
+		req := znp.AfDataRequest{DestinationAddress: device.NetworkAddress, DestinationEndpoint: 1, SourceEndpoint: 1, ClusterID: 0x0006, TransactionID: 7, Data: []byte{0x00, 0x2a, 0x00}}
+		assert.NoError(t, b.RequestResponse(testContext(t), req, &znp.AfDataRequestReply{}))
+
+		assert.Equal(t, &znp.AfDataConfirm{Status: znp.StatusSuccess, Endpoint: 1, TransactionID: 7}, receive(t, confirms))
+		assert.Equal(t, []byte{0x18, 0x2a, 0x01}, receive(t, incoming).(*znp.AfIncomingMsg).Data)
+
+		req.DestinationAddress = 0x9999
+		assert.NoError(t, b.RequestResponse(testContext(t), req, &znp.AfDataRequestReply{}))
+		assert.Equal(t, znp.StatusMACNoAck, receive(t, confirms).(*znp.AfDataConfirm).Status)
+	})
+}
@@ -0,0 +1,310 @@
+package zstack
+
+import (
+	"github.com/shimmeringbee/unpi/nv"
+	"github.com/shimmeringbee/unpi/znp"
+)
+
+// startupOptionItem is ZCD_NV_STARTUP_OPTION, its flags are applied and cleared on each reset.
+const startupOptionItem uint16 = 0x0003
+
+const (
+	startupOptionClearConfig uint8 = 0x01
+	startupOptionClearState  uint8 = 0x02
+)
+
+// maxReadLength is the most data returned by a single OSAL NV read, longer items must be read in chunks.
+const maxReadLength = 246
+
+// networkStateItems are the OSAL items removed when the network state is cleared.
+var networkStateItems = []uint16{
+	nv.ZCD_NV_NIB,
+	nv.ZCD_NV_NWK_ACTIVE_KEY_INFO,
+	nv.ZCD_NV_NWK_ALTERN_KEY_INFO,
+	nv.ZCD_NV_BINDING_TABLE,
+	nv.ZCD_NV_DEVICE_LIST,
+	nv.ZCD_NV_ADDRMGR,
+}
+
+// OSALItem returns a copy of an OSAL NV item, and whether it exists.
+func (c *Coordinator) OSALItem(id uint16) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.osal[id]
+	return copyBytes(value), found
+}
+
+// SetOSALItem creates or replaces an OSAL NV item.
+func (c *Coordinator) SetOSALItem(id uint16, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.osal[id] = copyBytes(value)
+}
+
+// ExtendedItem returns a copy of an item in the NV driver of Z-Stack 3.x.0, and whether it exists.
+func (c *Coordinator) ExtendedItem(key nv.ExtendedKey) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.extended[key]
+	return copyBytes(value), found
+}
+
+// SetExtendedItem creates or replaces an item in the NV driver of Z-Stack 3.x.0.
+func (c *Coordinator) SetExtendedItem(key nv.ExtendedKey, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.extended[key] = copyBytes(value)
+}
+
+func (c *Coordinator) handleNV() {
+	c.handle(&znp.SysOSALNVItemInit{}, c.osalItemInit)
+	c.handle(&znp.SysOSALNVLength{}, c.osalLength)
+	c.handle(&znp.SysOSALNVRead{}, c.osalRead)
+	c.handle(&znp.SysOSALNVReadExt{}, c.osalReadExt)
+	c.handle(&znp.SysOSALNVWrite{}, c.osalWrite)
+	c.handle(&znp.SysOSALNVWriteExt{}, c.osalWriteExt)
+	c.handle(&znp.SysOSALNVDelete{}, c.osalDelete)
+
+	c.handle(&znp.SysNVCreate{}, c.nvCreate)
+	c.handle(&znp.SysNVLength{}, c.nvLength)
+	c.handle(&znp.SysNVRead{}, c.nvRead)
+	c.handle(&znp.SysNVWrite{}, c.nvWrite)
+	c.handle(&znp.SysNVDelete{}, c.nvDelete)
+}
+
+func (c *Coordinator) osalItemInit(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVItemInit)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.osal[r.NVItemID]; found {
+		return znp.SysOSALNVItemInitReply{Status: znp.StatusSuccess}, nil
+	}
+
+	value := make([]byte, r.ItemLen)
+	copy(value, r.InitData)
+	c.osal[r.NVItemID] = value
+
+	return znp.SysOSALNVItemInitReply{Status: znp.StatusNVItemUninitialised}, nil
+}
+
+func (c *Coordinator) osalLength(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVLength)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return znp.SysOSALNVLengthReply{Length: uint16(len(c.osal[r.NVItemID]))}, nil
+}
+
+func (c *Coordinator) osalRead(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVRead)
+	status, value := c.readOSAL(r.NVItemID, int(r.Offset))
+
+	return znp.SysOSALNVReadReply{Status: status, Value: value}, nil
+}
+
+func (c *Coordinator) osalReadExt(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVReadExt)
+	status, value := c.readOSAL(r.NVItemID, int(r.Offset))
+
+	return znp.SysOSALNVReadExtReply{Status: status, Value: value}, nil
+}
+
+func (c *Coordinator) readOSAL(id uint16, offset int) (znp.Status, []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.osal[id]
+	if !found {
+		return znp.StatusNVItemUninitialised, nil
+	}
+
+	return readChunk(value, offset, maxReadLength)
+}
+
+func (c *Coordinator) osalWrite(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVWrite)
+	return znp.SysOSALNVWriteReply{Status: c.writeOSAL(r.NVItemID, int(r.Offset), r.Value)}, nil
+}
+
+func (c *Coordinator) osalWriteExt(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVWriteExt)
+	return znp.SysOSALNVWriteExtReply{Status: c.writeOSAL(r.NVItemID, int(r.Offset), r.Value)}, nil
+}
+
+func (c *Coordinator) writeOSAL(id uint16, offset int, data []byte) znp.Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.osal[id]
+	if !found {
+		return znp.StatusNVItemUninitialised
+	}
+
+	return writeChunk(value, offset, data)
+}
+
+func (c *Coordinator) osalDelete(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysOSALNVDelete)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.osal[r.NVItemID]
+	if !found {
+		return znp.SysOSALNVDeleteReply{Status: znp.StatusNVItemUninitialised}, nil
+	}
+
+	if len(value) != int(r.ItemLen) {
+		return znp.SysOSALNVDeleteReply{Status: znp.StatusNVBadItemLength}, nil
+	}
+
+	delete(c.osal, r.NVItemID)
+
+	return znp.SysOSALNVDeleteReply{Status: znp.StatusSuccess}, nil
+}
+
+func (c *Coordinator) nvCreate(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysNVCreate)
+	key := nv.ExtendedKey{SysID: r.SysID, ItemID: r.ItemID, SubID: r.SubID}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.extended[key]; found {
+		return znp.SysNVCreateReply{Status: znp.StatusSuccess}, nil
+	}
+
+	if r.Length > 0xffff {
+		return znp.SysNVCreateReply{Status: znp.StatusNVBadItemLength}, nil
+	}
+
+	c.extended[key] = make([]byte, r.Length)
+
+	return znp.SysNVCreateReply{Status: znp.StatusNVItemUninitialised}, nil
+}
+
+func (c *Coordinator) nvLength(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysNVLength)
+	key := nv.ExtendedKey{SysID: r.SysID, ItemID: r.ItemID, SubID: r.SubID}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return znp.SysNVLengthReply{Length: uint32(len(c.extended[key]))}, nil
+}
+
+func (c *Coordinator) nvRead(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysNVRead)
+	key := nv.ExtendedKey{SysID: r.SysID, ItemID: r.ItemID, SubID: r.SubID}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.extended[key]
+	if !found {
+		return znp.SysNVReadReply{Status: znp.StatusNVItemUninitialised}, nil
+	}
+
+	status, data := readChunk(value, int(r.Offset), int(r.Length))
+
+	return znp.SysNVReadReply{Status: status, Value: data}, nil
+}
+
+func (c *Coordinator) nvWrite(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysNVWrite)
+	key := nv.ExtendedKey{SysID: r.SysID, ItemID: r.ItemID, SubID: r.SubID}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.extended[key]
+	if !found {
+		return znp.SysNVWriteReply{Status: znp.StatusNVItemUninitialised}, nil
+	}
+
+	return znp.SysNVWriteReply{Status: writeChunk(value, int(r.Offset), r.Value)}, nil
+}
+
+func (c *Coordinator) nvDelete(req interface{}) (interface{}, error) {
+	r := req.(*znp.SysNVDelete)
+	key := nv.ExtendedKey{SysID: r.SysID, ItemID: r.ItemID, SubID: r.SubID}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, found := c.extended[key]; !found {
+		return znp.SysNVDeleteReply{Status: znp.StatusNVItemUninitialised}, nil
+	}
+
+	delete(c.extended, key)
+
+	return znp.SysNVDeleteReply{Status: znp.StatusSuccess}, nil
+}
+
+// applyStartupOption clears the configuration or network state as requested by ZCD_NV_STARTUP_OPTION,
+// and then clears the option. The mutex must be held.
+func (c *Coordinator) applyStartupOption() {
+	var option uint8
+
+	if value := c.osal[startupOptionItem]; len(value) > 0 {
+		option = value[0]
+	}
+
+	if option&startupOptionClearConfig != 0 {
+		extAddr := c.osal[nv.ZCD_NV_EXTADDR]
+
+		c.osal = map[uint16][]byte{
+			nv.ZCD_NV_EXTADDR:  extAddr,
+			nv.ZCD_NV_CHANLIST: littleEndian(uint64(c.config.Channels), 4),
+		}
+	}
+
+	if option&(startupOptionClearConfig|startupOptionClearState) != 0 {
+		for _, id := range networkStateItems {
+			delete(c.osal, id)
+		}
+
+		c.extended = map[nv.ExtendedKey][]byte{}
+		c.devices = map[uint64]Device{}
+	}
+
+	c.osal[startupOptionItem] = []byte{0x00}
+}
+
+func readChunk(value []byte, offset int, limit int) (znp.Status, []byte) {
+	if offset > len(value) {
+		return znp.StatusNVOperationFailed, nil
+	}
+
+	end := offset + limit
+	if end > len(value) {
+		end = len(value)
+	}
+
+	return znp.StatusSuccess, copyBytes(value[offset:end])
+}
+
+func writeChunk(value []byte, offset int, data []byte) znp.Status {
+	if offset+len(data) > len(value) {
+		return znp.StatusNVBadItemLength
+	}
+
+	copy(value[offset:], data)
+
+	return znp.StatusSuccess
+}
+
+func copyBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,87 @@
+package zstack
+
+import (
+	"bytes"
+	"errors"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/nv"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCoordinator_NV(t *testing.T) {
+	t.Run("osal items are written and read in chunks", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		value := bytes.Repeat([]byte{0x01, 0x02, 0x03}, 200)
+
+		assert.NoError(t, nv.WriteOSAL(testContext(t), b, nv.ZCD_NV_ADDRMGR, value))
+
+		stored, found := c.OSALItem(nv.ZCD_NV_ADDRMGR)
+		assert.True(t, found)
+		assert.Equal(t, value, stored)
+
+		read, err := nv.ReadOSAL(testContext(t), b, nv.ZCD_NV_ADDRMGR)
+		assert.NoError(t, err)
+		assert.Equal(t, value, read)
+	})
+
+	t.Run("extended items are written and read", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+		key := nv.ExtendedKey{SysID: nv.NVINTF_SYSID_ZSTACK, ItemID: nv.ZCD_NV_EX_TCLK_TABLE, SubID: 2}
+		value := bytes.Repeat([]byte{0xaa}, 300)
+
+		assert.NoError(t, nv.WriteExtended(testContext(t), b, key, value))
+
+		stored, _ := c.ExtendedItem(key)
+		assert.Equal(t, value, stored)
+
+		read, err := nv.ReadExtended(testContext(t), b, key)
+		assert.NoError(t, err)
+		assert.Equal(t, value, read)
+	})
+
+	t.Run("initialising an absent item creates it and reports it was uninitialised", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		err := b.RequestResponse(testContext(t), znp.SysOSALNVItemInit{NVItemID: 0x0401, ItemLen: 4, InitData: []byte{0x01, 0x02}}, &znp.SysOSALNVItemInitReply{})
+
+		statusErr := broker.StatusError{}
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, uint8(znp.StatusNVItemUninitialised), statusErr.Code)
+
+		value, _ := c.OSALItem(0x0401)
+		assert.Equal(t, []byte{0x01, 0x02, 0x00, 0x00}, value)
+
+		assert.NoError(t, b.RequestResponse(testContext(t), znp.SysOSALNVItemInit{NVItemID: 0x0401, ItemLen: 4}, &znp.SysOSALNVItemInitReply{}))
+	})
+
+	t.Run("absent items have no length and cannot be read", func(t *testing.T) {
+		_, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		_, err := nv.ReadOSAL(testContext(t), b, 0x0401)
+		assert.True(t, errors.Is(err, nv.ItemNotFound))
+
+		err = b.RequestResponse(testContext(t), znp.SysOSALNVRead{NVItemID: 0x0401}, &znp.SysOSALNVReadReply{})
+		assert.Error(t, err)
+	})
+
+	t.Run("clearing state on reset removes the network", func(t *testing.T) {
+		c, b := newCoordinator(t, Config{Firmware: znp.ZStack3x0})
+
+		c.SetOSALItem(nv.ZCD_NV_NIB, make([]byte, nibSize))
+		c.SetOSALItem(nv.ZCD_NV_PANID, []byte{0x62, 0x1a})
+
+		assert.NoError(t, nv.WriteOSAL(testContext(t), b, startupOptionItem, []byte{startupOptionClearState}))
+		reset(t, b)
+
+		_, found := c.OSALItem(nv.ZCD_NV_NIB)
+		assert.False(t, found)
+
+		_, found = c.OSALItem(nv.ZCD_NV_PANID)
+		assert.True(t, found)
+
+		option, _ := c.OSALItem(startupOptionItem)
+		assert.Equal(t, []byte{0x00}, option)
+	})
+}
@@ -0,0 +1,202 @@
+package firmware
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var InvalidRecord = errors.New("invalid record")
+var ChecksumMismatch = errors.New("checksum mismatch")
+var UnsupportedRecordType = errors.New("unsupported record type")
+var OverlappingData = errors.New("overlapping data")
+var MissingEndOfFile = errors.New("missing end of file record")
+
+// ParseError is returned for malformed Intel HEX, Line counts from one.
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Intel HEX record types.
+const (
+	recordData                   uint8 = 0x00
+	recordEndOfFile              uint8 = 0x01
+	recordExtendedSegmentAddress uint8 = 0x02
+	recordStartSegmentAddress    uint8 = 0x03
+	recordExtendedLinearAddress  uint8 = 0x04
+	recordStartLinearAddress     uint8 = 0x05
+)
+
+var recordDataLength = map[uint8]int{
+	recordEndOfFile:              0,
+	recordExtendedSegmentAddress: 2,
+	recordStartSegmentAddress:    4,
+	recordExtendedLinearAddress:  2,
+	recordStartLinearAddress:     4,
+}
+
+type lineSegment struct {
+	Segment
+	line int
+}
+
+// ParseHex parses an Intel HEX image, supporting extended segment and extended linear addressing. Data may be
+// sparse, but records may not overlap. Blank lines are ignored, and nothing but blank lines may follow the
+// end of file record.
+func ParseHex(r io.Reader) (Image, error) {
+	scanner := bufio.NewScanner(r)
+
+	var image Image
+	var segments []lineSegment
+	var base uint32
+
+	line := 0
+	ended := false
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" {
+			continue
+		}
+
+		if ended {
+			return Image{}, ParseError{Line: line, Err: fmt.Errorf("%w: data after end of file record", InvalidRecord)}
+		}
+
+		recordType, offset, data, err := parseRecord(text)
+		if err != nil {
+			return Image{}, ParseError{Line: line, Err: err}
+		}
+
+		if expected, found := recordDataLength[recordType]; found && len(data) != expected {
+			return Image{}, ParseError{Line: line, Err: fmt.Errorf("%w: record type 0x%02x has %d data bytes, expected %d", InvalidRecord, recordType, len(data), expected)}
+		}
+
+		switch recordType {
+		case recordData:
+			if len(data) > 0 {
+				segments = append(segments, lineSegment{Segment: Segment{Address: base + uint32(offset), Data: data}, line: line})
+			}
+		case recordEndOfFile:
+			ended = true
+		case recordExtendedSegmentAddress:
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 4
+		case recordExtendedLinearAddress:
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 16
+		case recordStartSegmentAddress:
+			segment := uint32(data[0])<<8 | uint32(data[1])
+			offset := uint32(data[2])<<8 | uint32(data[3])
+			image.Entry = segment<<4 + offset
+			image.HasEntry = true
+		case recordStartLinearAddress:
+			image.Entry = uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+			image.HasEntry = true
+		default:
+			return Image{}, ParseError{Line: line, Err: fmt.Errorf("%w: 0x%02x", UnsupportedRecordType, recordType)}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Image{}, err
+	}
+
+	if !ended {
+		return Image{}, ParseError{Line: line + 1, Err: MissingEndOfFile}
+	}
+
+	if err := checkOverlaps(segments); err != nil {
+		return Image{}, err
+	}
+
+	plain := make([]Segment, len(segments))
+	for i, s := range segments {
+		plain[i] = s.Segment
+	}
+
+	image.Segments = normalise(plain)
+
+	return image, nil
+}
+
+// parseRecord decodes a single record, validating its start code, hex digits, byte count and checksum.
+func parseRecord(text string) (uint8, uint16, []byte, error) {
+	if text[0] != ':' {
+		return 0, 0, nil, fmt.Errorf("%w: missing start code", InvalidRecord)
+	}
+
+	if len(text)%2 != 1 {
+		return 0, 0, nil, fmt.Errorf("%w: odd number of hex digits", InvalidRecord)
+	}
+
+	record, err := hex.DecodeString(text[1:])
+	if err != nil {
+		var invalidByte hex.InvalidByteError
+
+		if errors.As(err, &invalidByte) {
+			column := strings.IndexByte(text[1:], byte(invalidByte)) + 2
+			return 0, 0, nil, fmt.Errorf("%w: invalid hex digit %q at column %d", InvalidRecord, byte(invalidByte), column)
+		}
+
+		return 0, 0, nil, fmt.Errorf("%w: %v", InvalidRecord, err)
+	}
+
+	if len(record) < 5 {
+		return 0, 0, nil, fmt.Errorf("%w: record too short", InvalidRecord)
+	}
+
+	if expected := int(record[0]) + 5; len(record) != expected {
+		return 0, 0, nil, fmt.Errorf("%w: byte count 0x%02x requires %d bytes, record has %d", InvalidRecord, record[0], expected, len(record))
+	}
+
+	var sum byte
+	for _, b := range record[:len(record)-1] {
+		sum += b
+	}
+
+	if checksum, expected := record[len(record)-1], -sum; checksum != expected {
+		return 0, 0, nil, fmt.Errorf("%w: got 0x%02x, expected 0x%02x", ChecksumMismatch, checksum, expected)
+	}
+
+	offset := uint16(record[1])<<8 | uint16(record[2])
+
+	return record[3], offset, record[4 : len(record)-1], nil
+}
+
+// checkOverlaps reports the later of the first pair of records found to write the same address.
+func checkOverlaps(segments []lineSegment) error {
+	sorted := append([]lineSegment{}, segments...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		previous, current := sorted[i-1], sorted[i]
+
+		if current.Address < previous.end() {
+			first, second := previous, current
+			if first.line > second.line {
+				first, second = second, first
+			}
+
+			return ParseError{Line: second.line, Err: fmt.Errorf("%w: 0x%08x also written on line %d", OverlappingData, current.Address, first.line)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package firmware
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func parseLines(lines ...string) (Image, error) {
+	return ParseHex(strings.NewReader(strings.Join(lines, "\n")))
+}
+
+func TestParseHex(t *testing.T) {
+	t.Run("parses data records into merged segments", func(t *testing.T) {
+		image, err := parseLines(
+			":0400000001020304F2",
+			":02000400AABB95",
+			":00000001FF",
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Segment{{Address: 0, Data: []byte{0x01, 0x02, 0x03, 0x04, 0xaa, 0xbb}}}, image.Segments)
+	})
+
+	t.Run("applies extended linear addresses and keeps sparse ranges apart", func(t *testing.T) {
+		image, err := parseLines(
+			":020000040001F9",
+			":0400000001020304F2",
+			":02001000AABB89",
+			":020000040005F5",
+			":01000000CC33",
+			":00000001FF",
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Segment{
+			{Address: 0x00010000, Data: []byte{0x01, 0x02, 0x03, 0x04}},
+			{Address: 0x00010010, Data: []byte{0xaa, 0xbb}},
+			{Address: 0x00050000, Data: []byte{0xcc}},
+		}, image.Segments)
+	})
+
+	t.Run("applies extended segment addresses", func(t *testing.T) {
+		image, err := parseLines(
+			":020000021000EC",
+			":0100040011EA",
+			":00000001FF",
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Segment{{Address: 0x00010004, Data: []byte{0x11}}}, image.Segments)
+	})
+
+	t.Run("records start addresses", func(t *testing.T) {
+		image, err := parseLines(
+			":0400000500000101F5",
+			":00000001FF",
+		)
+
+		assert.NoError(t, err)
+		assert.True(t, image.HasEntry)
+		assert.Equal(t, uint32(0x00000101), image.Entry)
+	})
+
+	t.Run("reports checksum mismatches with their line", func(t *testing.T) {
+		_, err := parseLines(
+			":0400000001020304F2",
+			"",
+			":0400040001020304EF",
+			":00000001FF",
+		)
+
+		assert.True(t, errors.Is(err, ChecksumMismatch))
+		assert.Equal(t, "line 3: checksum mismatch: got 0xef, expected 0xee", err.Error())
+	})
+
+	t.Run("reports invalid hex digits with their column", func(t *testing.T) {
+		_, err := parseLines(":04000000010G0304F2", ":00000001FF")
+
+		parseErr := ParseError{}
+		if assert.True(t, errors.As(err, &parseErr)) {
+			assert.Equal(t, 1, parseErr.Line)
+		}
+
+		assert.True(t, errors.Is(err, InvalidRecord))
+		assert.Contains(t, err.Error(), "column 13")
+	})
+
+	t.Run("rejects records with the wrong byte count", func(t *testing.T) {
+		_, err := parseLines(":0500000001020304F1", ":00000001FF")
+
+		assert.True(t, errors.Is(err, InvalidRecord))
+		assert.Contains(t, err.Error(), "line 1")
+	})
+
+	t.Run("rejects address records with the wrong data length", func(t *testing.T) {
+		_, err := parseLines(":0300000400010AEE", ":00000001FF")
+
+		assert.True(t, errors.Is(err, InvalidRecord))
+	})
+
+	t.Run("rejects unknown record types", func(t *testing.T) {
+		_, err := parseLines(":00000006FA", ":00000001FF")
+
+		assert.True(t, errors.Is(err, UnsupportedRecordType))
+	})
+
+	t.Run("reports overlapping records against the line which first wrote the address", func(t *testing.T) {
+		_, err := parseLines(
+			":0400000001020304F2",
+			":0400080001020304EA",
+			":0100020055A8",
+			":00000001FF",
+		)
+
+		assert.True(t, errors.Is(err, OverlappingData))
+		assert.Equal(t, "line 3: overlapping data: 0x00000002 also written on line 1", err.Error())
+	})
+
+	t.Run("requires an end of file record", func(t *testing.T) {
+		_, err := parseLines(":0400000001020304F2")
+
+		assert.True(t, errors.Is(err, MissingEndOfFile))
+		assert.Contains(t, err.Error(), "line 2")
+	})
+
+	t.Run("rejects records after the end of file record", func(t *testing.T) {
+		_, err := parseLines(":00000001FF", ":0400000001020304F2")
+
+		assert.True(t, errors.Is(err, InvalidRecord))
+		assert.Contains(t, err.Error(), "line 2")
+	})
+}
@@ -0,0 +1,188 @@
+// Package firmware parses firmware images for flashing to Texas Instruments Zigbee adapters, from Intel HEX or
+// raw binaries, and validates the layout expected by CC26x2 devices.
+package firmware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// FillByte is used for addresses within an image which no data was provided for, it matches erased flash.
+const FillByte byte = 0xff
+
+var ImageEmpty = errors.New("image is empty")
+
+// Segment is a contiguous run of data starting at Address.
+type Segment struct {
+	Address uint32
+	Data    []byte
+}
+
+func (s Segment) end() uint32 {
+	return s.Address + uint32(len(s.Data))
+}
+
+// Image is a sparse firmware image, its segments are sorted by address, do not overlap and are not adjacent.
+type Image struct {
+	Segments []Segment
+	// Entry is the start address provided by the image, it is only meaningful if HasEntry is set.
+	Entry    uint32
+	HasEntry bool
+}
+
+// Raw returns an image of a raw binary to be written from address.
+func Raw(data []byte, address uint32) Image {
+	if len(data) == 0 {
+		return Image{}
+	}
+
+	return Image{Segments: []Segment{{Address: address, Data: data}}}
+}
+
+// asciiWhitespace is the whitespace which may precede or follow an Intel HEX record.
+const asciiWhitespace = " \t\r\n"
+
+// Load reads an image from Intel HEX if its first line is a valid HEX record, otherwise as a raw binary
+// written from address zero.
+func Load(r io.Reader) (Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if isHex(data) {
+		return ParseHex(bytes.NewReader(data))
+	}
+
+	return Raw(data, 0), nil
+}
+
+// isHex returns true if the first line of data, ignoring leading blank lines, is a valid Intel HEX record.
+func isHex(data []byte) bool {
+	first := bytes.TrimLeft(data, asciiWhitespace)
+
+	if end := bytes.IndexByte(first, '\n'); end >= 0 {
+		first = first[:end]
+	}
+
+	first = bytes.TrimRight(first, asciiWhitespace)
+
+	if len(first) == 0 {
+		return false
+	}
+
+	_, _, _, err := parseRecord(string(first))
+	return err == nil
+}
+
+// Empty returns true if the image contains no data.
+func (i Image) Empty() bool {
+	return len(i.Segments) == 0
+}
+
+// Range returns the lowest address with data and the address after the highest, empty images return zero
+// for both.
+func (i Image) Range() (uint32, uint32) {
+	if i.Empty() {
+		return 0, 0
+	}
+
+	return i.Segments[0].Address, i.Segments[len(i.Segments)-1].end()
+}
+
+// Contains returns true if every address from address for length bytes has data.
+func (i Image) Contains(address uint32, length int) bool {
+	end := address + uint32(length)
+
+	for _, s := range i.Segments {
+		if s.Address <= address && end <= s.end() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bytes returns length bytes from address, addresses without data are filled with fill.
+func (i Image) Bytes(address uint32, length int, fill byte) []byte {
+	data := bytes.Repeat([]byte{fill}, length)
+	end := address + uint32(length)
+
+	for _, s := range i.Segments {
+		if s.end() <= address || s.Address >= end {
+			continue
+		}
+
+		from, to := s.Address, s.end()
+
+		if from < address {
+			from = address
+		}
+
+		if to > end {
+			to = end
+		}
+
+		copy(data[from-address:to-address], s.Data[from-s.Address:to-s.Address])
+	}
+
+	return data
+}
+
+// Flatten returns the data of the image from its lowest address to its highest, gaps are filled with fill.
+func (i Image) Flatten(fill byte) []byte {
+	start, end := i.Range()
+	return i.Bytes(start, int(end-start), fill)
+}
+
+// Block is a page aligned run of data to be written in a single command.
+type Block struct {
+	Address uint32
+	Data    []byte
+}
+
+// Blocks normalises the image into blocks of size bytes aligned to size, padded with fill. Only blocks which
+// contain data are returned, so sparse images do not write their gaps.
+func (i Image) Blocks(size uint32, fill byte) []Block {
+	var blocks []Block
+	next := uint32(0)
+
+	for _, s := range i.Segments {
+		address := s.Address - s.Address%size
+
+		if len(blocks) > 0 && address < next {
+			address = next
+		}
+
+		for ; address < s.end(); address += size {
+			blocks = append(blocks, Block{Address: address, Data: i.Bytes(address, int(size), fill)})
+			next = address + size
+		}
+	}
+
+	return blocks
+}
+
+// normalise sorts segments and merges those which are adjacent, it expects segments to not overlap.
+func normalise(segments []Segment) []Segment {
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Address < segments[j].Address
+	})
+
+	var merged []Segment
+
+	for _, s := range segments {
+		if len(merged) > 0 && merged[len(merged)-1].end() == s.Address {
+			last := &merged[len(merged)-1]
+			last.Data = append(last.Data, s.Data...)
+			continue
+		}
+
+		merged = append(merged, Segment{Address: s.Address, Data: append([]byte{}, s.Data...)})
+	}
+
+	return merged
+}
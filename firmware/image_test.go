@@ -0,0 +1,81 @@
+package firmware
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("loads intel hex", func(t *testing.T) {
+		image, err := Load(strings.NewReader("\n:0400000001020304F2\n:00000001FF\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, image.Flatten(FillByte))
+	})
+
+	t.Run("loads a raw binary from address zero", func(t *testing.T) {
+		image, err := Load(bytes.NewReader([]byte{0x02, 0x00, 0x10}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Raw([]byte{0x02, 0x00, 0x10}, 0), image)
+	})
+
+	t.Run("loads a raw binary starting with a start code as a raw binary", func(t *testing.T) {
+		data := []byte{':', 0x02, 0x00, 0x10, '\n'}
+
+		image, err := Load(bytes.NewReader(data))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(data, 0), image)
+	})
+
+	t.Run("does not trim non ASCII whitespace from raw binaries", func(t *testing.T) {
+		data := append([]byte{0xc2, 0x85}, []byte(":00000001FF\n")...)
+
+		image, err := Load(bytes.NewReader(data))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Raw(data, 0), image)
+	})
+}
+
+func TestImage(t *testing.T) {
+	sparse := Image{Segments: []Segment{
+		{Address: 0x0e, Data: []byte{0x01, 0x02, 0x03}},
+		{Address: 0x14, Data: []byte{0x04}},
+		{Address: 0x40, Data: []byte{0x05}},
+	}}
+
+	t.Run("reports its range", func(t *testing.T) {
+		start, end := sparse.Range()
+
+		assert.Equal(t, uint32(0x0e), start)
+		assert.Equal(t, uint32(0x41), end)
+	})
+
+	t.Run("reads bytes across gaps with the fill byte", func(t *testing.T) {
+		assert.Equal(t, []byte{0x02, 0x03, 0xee, 0xee, 0xee, 0x04, 0xee}, sparse.Bytes(0x0f, 7, 0xee))
+	})
+
+	t.Run("reports whether a range is fully populated", func(t *testing.T) {
+		assert.True(t, sparse.Contains(0x0e, 3))
+		assert.False(t, sparse.Contains(0x0e, 4))
+	})
+
+	t.Run("normalises into aligned blocks, skipping blocks without data", func(t *testing.T) {
+		blocks := sparse.Blocks(8, FillByte)
+
+		assert.Equal(t, []Block{
+			{Address: 0x08, Data: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02}},
+			{Address: 0x10, Data: []byte{0x03, 0xff, 0xff, 0xff, 0x04, 0xff, 0xff, 0xff}},
+			{Address: 0x40, Data: []byte{0x05, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		}, blocks)
+	})
+
+	t.Run("empty images have no blocks", func(t *testing.T) {
+		assert.True(t, Raw(nil, 0x100).Empty())
+		assert.Empty(t, Image{}.Blocks(8, FillByte))
+	})
+}
@@ -0,0 +1,187 @@
+package firmware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var CCFGMissing = errors.New("image does not contain a ccfg")
+var InvalidCCFG = errors.New("invalid ccfg")
+var InvalidImageHeader = errors.New("invalid image header")
+var CRCMismatch = errors.New("image crc mismatch")
+
+// CC26x2 flash layout, the customer configuration area (CCFG) occupies the end of the last flash page.
+const (
+	CC26x2FlashSize   uint32 = 0x58000
+	CC26x2PageSize    uint32 = 0x2000
+	CC26x2CCFGAddress uint32 = CC26x2FlashSize - CCFGSize
+)
+
+// CCFGSize is the size of the CC26x2 CCFG, it is also stored within SIZE_AND_DIS_FLAGS.
+const CCFGSize = 0x58
+
+// Offsets of fields within the CCFG.
+const (
+	ccfgSizeAndDisFlagsOffset  = 0x08
+	ccfgBootloaderConfigOffset = 0x30
+	ccfgImageValidConfOffset   = 0x44
+)
+
+const bootloaderEnable uint8 = 0xc5
+
+// CCFG contains the fields of the CC26x2 customer configuration which affect whether an image will boot.
+type CCFG struct {
+	SizeAndDisFlags  uint32
+	BootloaderConfig uint32
+	ImageValidConf   uint32
+}
+
+// SizeOfCCFG is the size of the CCFG as recorded in SIZE_AND_DIS_FLAGS.
+func (c CCFG) SizeOfCCFG() uint16 {
+	return uint16(c.SizeAndDisFlags >> 16)
+}
+
+// BootloaderEnabled returns true if the ROM bootloader may be entered, if it is not the device can only be
+// reflashed over JTAG.
+func (c CCFG) BootloaderEnabled() bool {
+	return uint8(c.BootloaderConfig>>24) == bootloaderEnable
+}
+
+// Validate checks that the CCFG describes itself correctly and that ROM boot will start the flash image,
+// IMAGE_VALID_CONF must be zero or the address of a vector table below the CCFG.
+func (c CCFG) Validate() error {
+	if c.SizeOfCCFG() != CCFGSize {
+		return fmt.Errorf("%w: SIZE_OF_CCFG is 0x%04x, expected 0x%04x", InvalidCCFG, c.SizeOfCCFG(), CCFGSize)
+	}
+
+	if c.ImageValidConf != 0 && c.ImageValidConf >= CC26x2CCFGAddress {
+		return fmt.Errorf("%w: IMAGE_VALID_CONF 0x%08x is not a flash image", InvalidCCFG, c.ImageValidConf)
+	}
+
+	return nil
+}
+
+// ParseCCFG decodes a CC26x2 CCFG.
+func ParseCCFG(data []byte) (CCFG, error) {
+	if len(data) != CCFGSize {
+		return CCFG{}, fmt.Errorf("%w: %d bytes, expected %d", InvalidCCFG, len(data), CCFGSize)
+	}
+
+	return CCFG{
+		SizeAndDisFlags:  binary.LittleEndian.Uint32(data[ccfgSizeAndDisFlagsOffset:]),
+		BootloaderConfig: binary.LittleEndian.Uint32(data[ccfgBootloaderConfigOffset:]),
+		ImageValidConf:   binary.LittleEndian.Uint32(data[ccfgImageValidConfOffset:]),
+	}, nil
+}
+
+// CC26x2CCFG returns the CCFG contained within the image.
+func (i Image) CC26x2CCFG() (CCFG, error) {
+	if !i.Contains(CC26x2CCFGAddress, CCFGSize) {
+		return CCFG{}, CCFGMissing
+	}
+
+	return ParseCCFG(i.Bytes(CC26x2CCFGAddress, CCFGSize, FillByte))
+}
+
+// ValidateCC26x2 checks that the image fits within CC26x2 flash and contains a valid CCFG.
+func (i Image) ValidateCC26x2() error {
+	if _, end := i.Range(); end > CC26x2FlashSize {
+		return fmt.Errorf("%w: image ends at 0x%08x beyond flash", InvalidCCFG, end)
+	}
+
+	ccfg, err := i.CC26x2CCFG()
+	if err != nil {
+		return err
+	}
+
+	return ccfg.Validate()
+}
+
+// ImageHeaderSize is the size of the TI OAD image header.
+const ImageHeaderSize = 44
+
+// imageCRCOffset is the offset the CRC is calculated from, everything after the CRC field itself.
+const imageCRCOffset = 12
+
+var imageIDs = [][]byte{[]byte("CC26x2R1"), []byte("CC13x2R1"), []byte("OAD IMG ")}
+
+// ImageHeader is the TI OAD image header placed at the start of CC26x2 images.
+type ImageHeader struct {
+	ID              [8]byte
+	CRC32           uint32
+	BIMVersion      uint8
+	MetaVersion     uint8
+	TechType        uint16
+	CopyStatus      uint8
+	CRCStatus       uint8
+	ImageType       uint8
+	ImageNumber     uint8
+	ImageValidation uint32
+	Length          uint32
+	ProgramEntry    uint32
+	SoftwareVersion [4]byte
+	EndAddress      uint32
+	HeaderLength    uint16
+	Reserved        uint16
+}
+
+// ParseImageHeader decodes a TI OAD image header, rejecting unknown image IDs.
+func ParseImageHeader(data []byte) (ImageHeader, error) {
+	if len(data) < ImageHeaderSize {
+		return ImageHeader{}, fmt.Errorf("%w: %d bytes, expected %d", InvalidImageHeader, len(data), ImageHeaderSize)
+	}
+
+	header := ImageHeader{}
+
+	if err := binary.Read(bytes.NewReader(data[:ImageHeaderSize]), binary.LittleEndian, &header); err != nil {
+		return ImageHeader{}, err
+	}
+
+	known := false
+	for _, id := range imageIDs {
+		known = known || bytes.Equal(header.ID[:], id)
+	}
+
+	if !known {
+		return ImageHeader{}, fmt.Errorf("%w: unknown image id %q", InvalidImageHeader, header.ID[:])
+	}
+
+	return header, nil
+}
+
+// ImageHeader returns the TI OAD image header at the start of the image.
+func (i Image) ImageHeader() (ImageHeader, error) {
+	start, _ := i.Range()
+
+	if !i.Contains(start, ImageHeaderSize) {
+		return ImageHeader{}, fmt.Errorf("%w: image too short", InvalidImageHeader)
+	}
+
+	return ParseImageHeader(i.Bytes(start, ImageHeaderSize, FillByte))
+}
+
+// ValidateCRC checks the CRC32 recorded in the image header against the image, which is calculated over
+// Length bytes from the start of the image excluding the ID and CRC fields.
+func (i Image) ValidateCRC() error {
+	header, err := i.ImageHeader()
+	if err != nil {
+		return err
+	}
+
+	start, end := i.Range()
+
+	if header.Length < ImageHeaderSize || header.Length > end-start {
+		return fmt.Errorf("%w: length 0x%08x outside image of 0x%08x bytes", InvalidImageHeader, header.Length, end-start)
+	}
+
+	data := i.Bytes(start, int(header.Length), FillByte)
+
+	if crc := crc32.ChecksumIEEE(data[imageCRCOffset:]); crc != header.CRC32 {
+		return fmt.Errorf("%w: calculated 0x%08x, header has 0x%08x", CRCMismatch, crc, header.CRC32)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package firmware
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"testing"
+)
+
+func ccfg(sizeOfCCFG uint16, imageValidConf uint32) []byte {
+	data := make([]byte, CCFGSize)
+
+	for i := range data {
+		data[i] = FillByte
+	}
+
+	binary.LittleEndian.PutUint32(data[ccfgSizeAndDisFlagsOffset:], uint32(sizeOfCCFG)<<16|0xffff)
+	binary.LittleEndian.PutUint32(data[ccfgBootloaderConfigOffset:], 0xc5fe10c5)
+	binary.LittleEndian.PutUint32(data[ccfgImageValidConfOffset:], imageValidConf)
+
+	return data
+}
+
+func withCCFG(data []byte) Image {
+	return Image{Segments: []Segment{
+		{Address: 0, Data: []byte{0x00, 0x01}},
+		{Address: CC26x2CCFGAddress, Data: data},
+	}}
+}
+
+func TestCC26x2CCFG(t *testing.T) {
+	t.Run("validates an image with a correct ccfg", func(t *testing.T) {
+		image := withCCFG(ccfg(CCFGSize, 0))
+
+		assert.NoError(t, image.ValidateCC26x2())
+
+		parsed, err := image.CC26x2CCFG()
+		assert.NoError(t, err)
+		assert.True(t, parsed.BootloaderEnabled())
+	})
+
+	t.Run("errors if the image has no ccfg", func(t *testing.T) {
+		err := Raw([]byte{0x00, 0x01}, 0).ValidateCC26x2()
+
+		assert.True(t, errors.Is(err, CCFGMissing))
+	})
+
+	t.Run("errors if the ccfg size is wrong", func(t *testing.T) {
+		err := withCCFG(ccfg(0x50, 0)).ValidateCC26x2()
+
+		assert.True(t, errors.Is(err, InvalidCCFG))
+	})
+
+	t.Run("errors if the image will not boot", func(t *testing.T) {
+		err := withCCFG(ccfg(CCFGSize, 0xffffffff)).ValidateCC26x2()
+
+		assert.True(t, errors.Is(err, InvalidCCFG))
+	})
+
+	t.Run("errors if the image extends beyond flash", func(t *testing.T) {
+		image := withCCFG(ccfg(CCFGSize, 0))
+		image.Segments = append(image.Segments, Segment{Address: CC26x2FlashSize, Data: []byte{0x00}})
+
+		assert.True(t, errors.Is(image.ValidateCC26x2(), InvalidCCFG))
+	})
+}
+
+func oadImage(length int) []byte {
+	data := make([]byte, length)
+
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	copy(data, "CC26x2R1")
+	binary.LittleEndian.PutUint32(data[24:], uint32(length))
+	binary.LittleEndian.PutUint32(data[8:], crc32.ChecksumIEEE(data[imageCRCOffset:]))
+
+	return data
+}
+
+func TestImageHeader(t *testing.T) {
+	t.Run("parses the header at the start of the image", func(t *testing.T) {
+		header, err := Raw(oadImage(128), 0).ImageHeader()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "CC26x2R1", string(header.ID[:]))
+		assert.Equal(t, uint32(128), header.Length)
+	})
+
+	t.Run("rejects unknown image ids", func(t *testing.T) {
+		_, err := Raw(make([]byte, 128), 0).ImageHeader()
+
+		assert.True(t, errors.Is(err, InvalidImageHeader))
+	})
+
+	t.Run("validates the crc", func(t *testing.T) {
+		assert.NoError(t, Raw(oadImage(128), 0x2000).ValidateCRC())
+	})
+
+	t.Run("errors if the crc does not match", func(t *testing.T) {
+		data := oadImage(128)
+		data[100] ^= 0xff
+
+		assert.True(t, errors.Is(Raw(data, 0).ValidateCRC(), CRCMismatch))
+	})
+
+	t.Run("errors if the length exceeds the image", func(t *testing.T) {
+		data := oadImage(128)
+
+		assert.True(t, errors.Is(Raw(data[:64], 0).ValidateCRC(), InvalidImageHeader))
+	})
+}
@@ -8,6 +8,8 @@ import (
 type Library struct {
 	identityToType map[Identity]reflect.Type
 	typeToIdentity map[reflect.Type]Identity
+
+	identityToAttributes map[Identity]attributes
 }
 
 type Identity struct {
@@ -20,10 +22,12 @@ func NewLibrary() *Library {
 	return &Library{
 		identityToType: make(map[Identity]reflect.Type),
 		typeToIdentity: make(map[reflect.Type]Identity),
+
+		identityToAttributes: make(map[Identity]attributes),
 	}
 }
 
-func (cl *Library) Add(messageType MessageType, subsystem Subsystem, commandID uint8, v interface{}) {
+func (cl *Library) Add(messageType MessageType, subsystem Subsystem, commandID uint8, v interface{}, opts ...Option) {
 	t := reflect.TypeOf(v)
 
 	identity := Identity{
@@ -34,6 +38,14 @@ func (cl *Library) Add(messageType MessageType, subsystem Subsystem, commandID u
 
 	cl.identityToType[identity] = t
 	cl.typeToIdentity[t] = identity
+
+	a := defaultAttributes()
+
+	for _, opt := range opts {
+		opt(&a)
+	}
+
+	cl.identityToAttributes[identity] = a
 }
 
 func (cl *Library) GetByIdentifier(messageType MessageType, subsystem Subsystem, commandID uint8) (reflect.Type, bool) {
@@ -40,4 +40,64 @@ func TestMessageLibrary(t *testing.T) {
 		assert.True(t, found)
 		assert.Equal(t, expectedIdentity, actualIdentity)
 	})
+	t.Run("verifies that messages default to normal priority", func(t *testing.T) {
+		ml := NewLibrary()
+
+		type KnownStruct struct{}
+
+		ml.Add(SREQ, SYS, 0x01, KnownStruct{})
+
+		identity, _ := ml.GetByObject(KnownStruct{})
+		assert.Equal(t, PriorityNormal, ml.Priority(identity))
+
+		unknown := Identity{MessageType: SREQ, Subsystem: SYS, CommandID: 0xff}
+		assert.Equal(t, PriorityNormal, ml.Priority(unknown))
+	})
+
+	t.Run("verifies that priority provided as an option is recorded", func(t *testing.T) {
+		ml := NewLibrary()
+
+		type KnownStruct struct{}
+
+		ml.Add(SREQ, SYS, 0x01, KnownStruct{}, WithPriority(PriorityCritical))
+
+		identity, _ := ml.GetByObject(KnownStruct{})
+		assert.Equal(t, PriorityCritical, ml.Priority(identity))
+	})
+	t.Run("verifies that a retry policy provided as an option is recorded", func(t *testing.T) {
+		ml := NewLibrary()
+
+		type KnownStruct struct{}
+		type OtherStruct struct{}
+
+		ml.Add(SREQ, SYS, 0x01, KnownStruct{}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+		ml.Add(SREQ, SYS, 0x02, OtherStruct{})
+
+		identity, _ := ml.GetByObject(KnownStruct{})
+		policy, found := ml.RetryPolicy(identity)
+
+		assert.True(t, found)
+		assert.Equal(t, 3, policy.MaxAttempts)
+
+		identity, _ = ml.GetByObject(OtherStruct{})
+		_, found = ml.RetryPolicy(identity)
+
+		assert.False(t, found)
+	})
+
+	t.Run("verifies that a leading status provided as an option is recorded", func(t *testing.T) {
+		ml := NewLibrary()
+
+		type KnownStruct struct{}
+		type OtherStruct struct{}
+
+		ml.Add(SRSP, SYS, 0x01, KnownStruct{}, WithLeadingStatus())
+		ml.Add(SRSP, SYS, 0x02, OtherStruct{})
+
+		identity, _ := ml.GetByObject(KnownStruct{})
+		assert.True(t, ml.LeadingStatus(identity))
+
+		identity, _ = ml.GetByObject(OtherStruct{})
+		assert.False(t, ml.LeadingStatus(identity))
+	})
 }
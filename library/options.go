@@ -0,0 +1,103 @@
+package library
+
+import "time"
+
+// Priority is the class an outbound message is queued with, higher priorities are sent first.
+type Priority uint8
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+// PriorityCount is the number of distinct priority classes.
+const PriorityCount = int(PriorityCritical) + 1
+
+// RetryPolicy describes how a request is retried when an attempt fails. Backoff is the delay before the
+// second attempt, it is multiplied by Multiplier for each subsequent attempt up to MaxBackoff, and varied
+// by up to +/- Jitter (a fraction of the delay). Retryable decides which errors are retried, if nil the
+// broker's default is used.
+type RetryPolicy struct {
+	MaxAttempts    int
+	AttemptTimeout time.Duration
+
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	Jitter     float64
+
+	Retryable func(error) bool
+}
+
+type attributes struct {
+	priority      Priority
+	retryPolicy   *RetryPolicy
+	leadingStatus bool
+}
+
+func defaultAttributes() attributes {
+	return attributes{
+		priority: PriorityNormal,
+	}
+}
+
+// Option alters the attributes recorded against a message when it is added to the library.
+type Option func(*attributes)
+
+// WithPriority sets the default priority that the message is sent with.
+func WithPriority(p Priority) Option {
+	return func(a *attributes) {
+		a.priority = p
+	}
+}
+
+// WithRetryPolicy sets the retry policy used by default when the message is sent as a request.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(a *attributes) {
+		a.retryPolicy = &p
+	}
+}
+
+// WithLeadingStatus marks a response as starting with a status byte, where zero is success. If the first
+// field of the response implements fmt.Stringer it is used to name the status.
+func WithLeadingStatus() Option {
+	return func(a *attributes) {
+		a.leadingStatus = true
+	}
+}
+
+// Priority returns the default priority for a message identity, PriorityNormal unless one was set when
+// the message was added.
+func (cl *Library) Priority(identity Identity) Priority {
+	return cl.attributes(identity).priority
+}
+
+// RetryPolicy returns the retry policy for a message identity, if one was set when the message was added.
+func (cl *Library) RetryPolicy(identity Identity) (RetryPolicy, bool) {
+	if p := cl.attributes(identity).retryPolicy; p != nil {
+		return *p, true
+	}
+
+	return RetryPolicy{}, false
+}
+
+// LeadingStatus returns true if the message identity was marked as starting with a status byte.
+func (cl *Library) LeadingStatus(identity Identity) bool {
+	return cl.attributes(identity).leadingStatus
+}
+
+func (cl *Library) attributes(identity Identity) attributes {
+	if a, found := cl.identityToAttributes[identity]; found {
+		return a
+	}
+
+	return defaultAttributes()
+}
+
+// StatusCarrier is implemented by responses which report their own status, for example when the status is
+// not the first field. A code of zero is success.
+type StatusCarrier interface {
+	ResponseStatus() (code uint8, name string)
+}
@@ -0,0 +1,234 @@
+package nv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BackupVersion is the version of the backup format written by Create, backups without a version are
+// treated as version one.
+const BackupVersion = 1
+
+// BackupAdapterType is the adapter type recorded in backups, as used by zigbee-herdsman.
+const BackupAdapterType = "zStack"
+
+// anyProduct marks a backup item as usable on any product, as in zigbee-herdsman backups.
+const anyProduct = -1
+
+var UnsupportedBackupVersion = errors.New("unsupported backup version")
+var UnsupportedAdapterType = errors.New("unsupported backup adapter type")
+var IncompatibleProduct = errors.New("backup is for a different product")
+
+// ProductMismatch reports a backup, or an item within it, which was made on a different product to the
+// adapter being restored. Item is empty if the backup itself is for another product.
+type ProductMismatch struct {
+	Item    string
+	Product int
+	Target  uint8
+}
+
+func (e ProductMismatch) Error() string {
+	if e.Item == "" {
+		return fmt.Sprintf("%v: backup product %d, adapter product %d", IncompatibleProduct, e.Product, e.Target)
+	}
+
+	return fmt.Sprintf("%v: item %s product %d, adapter product %d", IncompatibleProduct, e.Item, e.Product, e.Target)
+}
+
+func (e ProductMismatch) Unwrap() error {
+	return IncompatibleProduct
+}
+
+// Backup is a JSON backup of NV items, laid out as the Z-Stack backups of zigbee-herdsman.
+type Backup struct {
+	AdapterType string                `json:"adapterType"`
+	Time        string                `json:"time"`
+	Meta        BackupMeta            `json:"meta"`
+	Data        map[string]BackupItem `json:"data"`
+}
+
+type BackupMeta struct {
+	Product int `json:"product"`
+	Version int `json:"version,omitempty"`
+}
+
+// BackupItem is a single NV item in a backup. For OSAL items ID is the item ID, for extended items ID is
+// the item ID within SysID and SubID.
+type BackupItem struct {
+	ID      uint16 `json:"id"`
+	OSAL    bool   `json:"osal"`
+	Product int    `json:"product"`
+	Value   Bytes  `json:"value"`
+	Len     int    `json:"len"`
+
+	SysID uint8  `json:"sysid,omitempty"`
+	SubID uint16 `json:"subid,omitempty"`
+}
+
+// Bytes is a byte slice encoded in JSON as an array of numbers, rather than base64.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	values := make([]uint16, len(b))
+
+	for i, v := range b {
+		values[i] = uint16(v)
+	}
+
+	return json.Marshal(values)
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var values []uint16
+
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	*b = make(Bytes, len(values))
+
+	for i, v := range values {
+		if v > 0xff {
+			return fmt.Errorf("byte %d out of range: %d", i, v)
+		}
+
+		(*b)[i] = byte(v)
+	}
+
+	return nil
+}
+
+// Create reads the items from the adapter into a backup. Items absent from the adapter are left out.
+func Create(ctx context.Context, r Requester, items []Item, product uint8) (Backup, error) {
+	backup := Backup{
+		AdapterType: BackupAdapterType,
+		Time:        time.Now().UTC().Format(time.RFC1123),
+		Meta:        BackupMeta{Product: int(product), Version: BackupVersion},
+		Data:        map[string]BackupItem{},
+	}
+
+	for _, item := range items {
+		if !item.Extended {
+			value, err := ReadOSAL(ctx, r, item.ID)
+
+			if errors.Is(err, ItemNotFound) {
+				continue
+			} else if err != nil {
+				return Backup{}, fmt.Errorf("backup %s: %w", item.Name, err)
+			}
+
+			backup.Data[item.Name] = BackupItem{ID: item.ID, OSAL: true, Product: anyProduct, Value: value, Len: len(value)}
+			continue
+		}
+
+		key := item.ExtendedKey
+
+		for {
+			value, err := ReadExtended(ctx, r, key)
+
+			if errors.Is(err, ItemNotFound) {
+				break
+			} else if err != nil {
+				return Backup{}, fmt.Errorf("backup %s: %w", item.Name, err)
+			}
+
+			name := item.Name
+			if item.Table {
+				name = fmt.Sprintf("%s_%d", item.Name, key.SubID)
+			}
+
+			backup.Data[name] = BackupItem{ID: key.ItemID, SysID: key.SysID, SubID: key.SubID, Product: int(product), Value: value, Len: len(value)}
+
+			if !item.Table || key.SubID == 0xffff {
+				break
+			}
+
+			key.SubID++
+		}
+	}
+
+	return backup, nil
+}
+
+// Parse decodes a JSON backup, checking that it can be restored by this package.
+func Parse(data []byte) (Backup, error) {
+	backup := Backup{}
+
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return Backup{}, err
+	}
+
+	if err := backup.validate(); err != nil {
+		return Backup{}, err
+	}
+
+	return backup, nil
+}
+
+func (b Backup) validate() error {
+	if b.Meta.Version > BackupVersion {
+		return fmt.Errorf("%w: %d", UnsupportedBackupVersion, b.Meta.Version)
+	}
+
+	if b.AdapterType != BackupAdapterType {
+		return fmt.Errorf("%w: %s", UnsupportedAdapterType, b.AdapterType)
+	}
+
+	return nil
+}
+
+// Restore writes every item in the backup to an adapter of the product specified, in name order. Nothing is
+// written if the backup, or any item within it, was made on another product.
+func Restore(ctx context.Context, r Requester, backup Backup, product uint8) error {
+	if err := backup.validate(); err != nil {
+		return err
+	}
+
+	if err := backup.compatible(product); err != nil {
+		return err
+	}
+
+	var names []string
+
+	for name := range backup.Data {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		item := backup.Data[name]
+
+		var err error
+
+		if item.OSAL {
+			err = WriteOSAL(ctx, r, item.ID, item.Value)
+		} else {
+			err = WriteExtended(ctx, r, ExtendedKey{SysID: item.SysID, ItemID: item.ID, SubID: item.SubID}, item.Value)
+		}
+
+		if err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (b Backup) compatible(product uint8) error {
+	if b.Meta.Product != anyProduct && b.Meta.Product != int(product) {
+		return ProductMismatch{Product: b.Meta.Product, Target: product}
+	}
+
+	for name, item := range b.Data {
+		if item.Product != anyProduct && item.Product != int(product) {
+			return ProductMismatch{Item: name, Product: item.Product, Target: product}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package nv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	t.Run("backs up present items and restores them to another adapter", func(t *testing.T) {
+		source := newSimulatedNV()
+		source.osal[ZCD_NV_PANID] = []byte{0x62, 0x1a}
+		source.osal[ZCD_NV_NIB] = pattern(300)
+		source.extended[ExtendedKey{NVINTF_SYSID_ZSTACK, ZCD_NV_EX_ADDRMGR, 0}] = pattern(16)
+		source.extended[ExtendedKey{NVINTF_SYSID_ZSTACK, ZCD_NV_EX_ADDRMGR, 1}] = pattern(17)
+
+		backup, err := Create(context.Background(), source, ItemsFor(znp.ZStack3x0), uint8(znp.ZStack3x0))
+		assert.NoError(t, err)
+
+		assert.Len(t, backup.Data, 4)
+		assert.Equal(t, BackupItem{ID: ZCD_NV_PANID, OSAL: true, Product: anyProduct, Value: Bytes{0x62, 0x1a}, Len: 2}, backup.Data["ZCD_NV_PANID"])
+		assert.Equal(t, uint16(1), backup.Data["ZCD_NV_EX_ADDRMGR_1"].SubID)
+
+		data, err := json.Marshal(backup)
+		assert.NoError(t, err)
+
+		parsed, err := Parse(data)
+		assert.NoError(t, err)
+
+		destination := newSimulatedNV()
+		err = Restore(context.Background(), destination, parsed, uint8(znp.ZStack3x0))
+
+		assert.NoError(t, err)
+		assert.Equal(t, source.osal, destination.osal)
+		assert.Equal(t, source.extended, destination.extended)
+	})
+
+	t.Run("refuses to restore a backup of another product", func(t *testing.T) {
+		backup := Backup{AdapterType: BackupAdapterType, Meta: BackupMeta{Product: int(znp.ZStack12)}, Data: map[string]BackupItem{}}
+
+		err := Restore(context.Background(), newSimulatedNV(), backup, uint8(znp.ZStack3x0))
+
+		assert.True(t, errors.Is(err, IncompatibleProduct))
+		assert.Equal(t, ProductMismatch{Product: int(znp.ZStack12), Target: uint8(znp.ZStack3x0)}, err)
+	})
+
+	t.Run("writes nothing if any item is for another product", func(t *testing.T) {
+		backup := Backup{
+			AdapterType: BackupAdapterType,
+			Meta:        BackupMeta{Product: int(znp.ZStack3x0)},
+			Data: map[string]BackupItem{
+				"ZCD_NV_PANID":        {ID: ZCD_NV_PANID, OSAL: true, Product: anyProduct, Value: Bytes{0x62, 0x1a}},
+				"ZCD_NV_EX_ADDRMGR_0": {ID: ZCD_NV_EX_ADDRMGR, SysID: NVINTF_SYSID_ZSTACK, Product: int(znp.ZStack30x), Value: pattern(16)},
+			},
+		}
+
+		destination := newSimulatedNV()
+		err := Restore(context.Background(), destination, backup, uint8(znp.ZStack3x0))
+
+		assert.Equal(t, ProductMismatch{Item: "ZCD_NV_EX_ADDRMGR_0", Product: int(znp.ZStack30x), Target: uint8(znp.ZStack3x0)}, err)
+		assert.Empty(t, destination.osal)
+		assert.Empty(t, destination.extended)
+	})
+
+	t.Run("encodes values as arrays of numbers", func(t *testing.T) {
+		data, err := json.Marshal(BackupItem{ID: ZCD_NV_PANID, OSAL: true, Product: anyProduct, Value: Bytes{0x62, 0x1a}, Len: 2})
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"id":131,"osal":true,"product":-1,"value":[98,26],"len":2}`, string(data))
+	})
+
+	t.Run("parses a backup without a version", func(t *testing.T) {
+		data := `{"adapterType":"zStack","time":"Mon, 01 Feb 2021 00:00:00 UTC","meta":{"product":2},"data":{"ZCD_NV_PANID":{"id":131,"offset":0,"osal":true,"product":-1,"value":[98,26],"len":2}}}`
+
+		backup, err := Parse([]byte(data))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Bytes{0x62, 0x1a}, backup.Data["ZCD_NV_PANID"].Value)
+	})
+
+	t.Run("rejects backups from a newer version", func(t *testing.T) {
+		_, err := Parse([]byte(`{"adapterType":"zStack","meta":{"product":1,"version":99},"data":{}}`))
+
+		assert.True(t, errors.Is(err, UnsupportedBackupVersion))
+	})
+
+	t.Run("rejects values which are not bytes", func(t *testing.T) {
+		_, err := Parse([]byte(`{"adapterType":"zStack","meta":{"product":1},"data":{"X":{"value":[256]}}}`))
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,95 @@
+package nv
+
+import "github.com/shimmeringbee/unpi/znp"
+
+// Item describes an NV item to back up. OSAL items are identified by ID, extended items by their
+// ExtendedKey. If Table is set every sub ID of an extended item is backed up, starting from zero until an
+// absent sub ID is found.
+type Item struct {
+	Name string
+
+	ID uint16
+
+	Extended    bool
+	ExtendedKey ExtendedKey
+	Table       bool
+}
+
+// OSAL NV item IDs used by Z-Stack to store network state.
+const (
+	ZCD_NV_EXTADDR                      uint16 = 0x0001
+	ZCD_NV_NIB                          uint16 = 0x0021
+	ZCD_NV_EXTENDED_PAN_ID              uint16 = 0x002d
+	ZCD_NV_NWK_ACTIVE_KEY_INFO          uint16 = 0x003a
+	ZCD_NV_NWK_ALTERN_KEY_INFO          uint16 = 0x003b
+	ZCD_NV_BINDING_TABLE                uint16 = 0x0041
+	ZCD_NV_DEVICE_LIST                  uint16 = 0x0042
+	ZCD_NV_APS_USE_EXT_PANID            uint16 = 0x0047
+	ZCD_NV_ADDRMGR                      uint16 = 0x0059
+	ZCD_NV_PRECFGKEY                    uint16 = 0x0062
+	ZCD_NV_PRECFGKEY_ENABLE             uint16 = 0x0063
+	ZCD_NV_NWK_SEC_MATERIAL_TABLE_START uint16 = 0x0075
+	ZCD_NV_PANID                        uint16 = 0x0083
+	ZCD_NV_CHANLIST                     uint16 = 0x0084
+	ZCD_NV_TCLK_TABLE_START             uint16 = 0x0101
+)
+
+// NVINTF_SYSID_ZSTACK is the system ID of Z-Stack items in the NV driver of Z-Stack 3.x.0.
+const NVINTF_SYSID_ZSTACK uint8 = 0x01
+
+// Extended NV item IDs used by Z-Stack 3.x.0 to store tables, one entry per sub ID.
+const (
+	ZCD_NV_EX_ADDRMGR                uint16 = 0x0001
+	ZCD_NV_EX_BINDING_TABLE          uint16 = 0x0002
+	ZCD_NV_EX_DEVICE_LIST            uint16 = 0x0003
+	ZCD_NV_EX_TCLK_TABLE             uint16 = 0x0004
+	ZCD_NV_EX_TCLK_IC_TABLE          uint16 = 0x0005
+	ZCD_NV_EX_APS_KEY_DATA_TABLE     uint16 = 0x0006
+	ZCD_NV_EX_NWK_SEC_MATERIAL_TABLE uint16 = 0x0007
+)
+
+// NetworkItems are the OSAL items which hold the identity, keys and configuration of a network, common to
+// every Z-Stack release.
+var NetworkItems = []Item{
+	{Name: "ZCD_NV_EXTADDR", ID: ZCD_NV_EXTADDR},
+	{Name: "ZCD_NV_NIB", ID: ZCD_NV_NIB},
+	{Name: "ZCD_NV_PANID", ID: ZCD_NV_PANID},
+	{Name: "ZCD_NV_EXTENDED_PAN_ID", ID: ZCD_NV_EXTENDED_PAN_ID},
+	{Name: "ZCD_NV_NWK_ACTIVE_KEY_INFO", ID: ZCD_NV_NWK_ACTIVE_KEY_INFO},
+	{Name: "ZCD_NV_NWK_ALTERN_KEY_INFO", ID: ZCD_NV_NWK_ALTERN_KEY_INFO},
+	{Name: "ZCD_NV_APS_USE_EXT_PANID", ID: ZCD_NV_APS_USE_EXT_PANID},
+	{Name: "ZCD_NV_PRECFGKEY", ID: ZCD_NV_PRECFGKEY},
+	{Name: "ZCD_NV_PRECFGKEY_ENABLE", ID: ZCD_NV_PRECFGKEY_ENABLE},
+	{Name: "ZCD_NV_CHANLIST", ID: ZCD_NV_CHANLIST},
+}
+
+// OSALTableItems are the device, binding and key tables stored as OSAL items by Z-Stack Home 1.2 and 3.0.x.
+var OSALTableItems = []Item{
+	{Name: "ZCD_NV_ADDRMGR", ID: ZCD_NV_ADDRMGR},
+	{Name: "ZCD_NV_BINDING_TABLE", ID: ZCD_NV_BINDING_TABLE},
+	{Name: "ZCD_NV_DEVICE_LIST", ID: ZCD_NV_DEVICE_LIST},
+	{Name: "ZCD_NV_TCLK_TABLE_START", ID: ZCD_NV_TCLK_TABLE_START},
+	{Name: "ZCD_NV_NWK_SEC_MATERIAL_TABLE_START", ID: ZCD_NV_NWK_SEC_MATERIAL_TABLE_START},
+}
+
+// ExtendedTableItems are the device, binding and key tables stored in the NV driver of Z-Stack 3.x.0.
+var ExtendedTableItems = []Item{
+	{Name: "ZCD_NV_EX_ADDRMGR", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_ADDRMGR}},
+	{Name: "ZCD_NV_EX_BINDING_TABLE", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_BINDING_TABLE}},
+	{Name: "ZCD_NV_EX_DEVICE_LIST", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_DEVICE_LIST}},
+	{Name: "ZCD_NV_EX_TCLK_TABLE", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_TCLK_TABLE}},
+	{Name: "ZCD_NV_EX_TCLK_IC_TABLE", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_TCLK_IC_TABLE}},
+	{Name: "ZCD_NV_EX_APS_KEY_DATA_TABLE", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_APS_KEY_DATA_TABLE}},
+	{Name: "ZCD_NV_EX_NWK_SEC_MATERIAL_TABLE", Extended: true, Table: true, ExtendedKey: ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_NWK_SEC_MATERIAL_TABLE}},
+}
+
+// ItemsFor returns the items to back up for an adapter running the specified firmware.
+func ItemsFor(firmware znp.Firmware) []Item {
+	items := append([]Item{}, NetworkItems...)
+
+	if firmware == znp.ZStack3x0 {
+		return append(items, ExtendedTableItems...)
+	}
+
+	return append(items, OSALTableItems...)
+}
@@ -0,0 +1,219 @@
+// Package nv reads and writes the non volatile items of a Z-Stack adapter, and can back up and restore the
+// items needed to migrate a Zigbee network between adapters.
+package nv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/znp"
+)
+
+// MaxChunkSize is the largest number of bytes read or written in a single NV command, it keeps every
+// request and response within the maximum UNPI payload.
+const MaxChunkSize = 240
+
+var ItemNotFound = errors.New("nv item not found")
+var ItemTooLarge = errors.New("nv item too large")
+var ReadMadeNoProgress = errors.New("nv read returned no data")
+
+// Requester sends a request and waits for its response, it is satisfied by *broker.Broker using a znp
+// message library.
+type Requester interface {
+	RequestResponse(ctx context.Context, req interface{}, resp interface{}) error
+}
+
+// ExtendedKey identifies an item in the NV driver of Z-Stack 3.x.0.
+type ExtendedKey struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+}
+
+// ReadOSAL reads an OSAL NV item in full, items longer than a single response are read in chunks.
+func ReadOSAL(ctx context.Context, r Requester, id uint16) ([]byte, error) {
+	lengthReply := znp.SysOSALNVLengthReply{}
+
+	if err := r.RequestResponse(ctx, znp.SysOSALNVLength{NVItemID: id}, &lengthReply); err != nil {
+		return nil, err
+	}
+
+	if lengthReply.Length == 0 {
+		return nil, fmt.Errorf("%w: osal item 0x%04x", ItemNotFound, id)
+	}
+
+	length := int(lengthReply.Length)
+	data := make([]byte, 0, length)
+
+	for len(data) < length {
+		var value []byte
+		offset := len(data)
+
+		if offset <= 0xff {
+			reply := znp.SysOSALNVReadReply{}
+			if err := r.RequestResponse(ctx, znp.SysOSALNVRead{NVItemID: id, Offset: uint8(offset)}, &reply); err != nil {
+				return nil, err
+			}
+			value = reply.Value
+		} else {
+			reply := znp.SysOSALNVReadExtReply{}
+			if err := r.RequestResponse(ctx, znp.SysOSALNVReadExt{NVItemID: id, Offset: uint16(offset)}, &reply); err != nil {
+				return nil, err
+			}
+			value = reply.Value
+		}
+
+		if len(value) == 0 {
+			return nil, fmt.Errorf("%w: osal item 0x%04x at offset %d", ReadMadeNoProgress, id, offset)
+		}
+
+		data = append(data, value...)
+	}
+
+	return data[:length], nil
+}
+
+// WriteOSAL writes an OSAL NV item in full. The item is created if missing, and recreated if its length
+// differs from the value.
+func WriteOSAL(ctx context.Context, r Requester, id uint16, value []byte) error {
+	if len(value) > 0xffff {
+		return fmt.Errorf("%w: osal item 0x%04x is %d bytes", ItemTooLarge, id, len(value))
+	}
+
+	lengthReply := znp.SysOSALNVLengthReply{}
+
+	if err := r.RequestResponse(ctx, znp.SysOSALNVLength{NVItemID: id}, &lengthReply); err != nil {
+		return err
+	}
+
+	if lengthReply.Length != 0 && int(lengthReply.Length) != len(value) {
+		if err := r.RequestResponse(ctx, znp.SysOSALNVDelete{NVItemID: id, ItemLen: lengthReply.Length}, &znp.SysOSALNVDeleteReply{}); err != nil {
+			return err
+		}
+	}
+
+	if err := r.RequestResponse(ctx, znp.SysOSALNVItemInit{NVItemID: id, ItemLen: uint16(len(value))}, &znp.SysOSALNVItemInitReply{}); err != nil && !itemCreated(err) {
+		return err
+	}
+
+	for offset := 0; offset < len(value); offset += MaxChunkSize {
+		chunk := value[offset:minInt(offset+MaxChunkSize, len(value))]
+
+		var err error
+
+		if offset <= 0xff {
+			err = r.RequestResponse(ctx, znp.SysOSALNVWrite{NVItemID: id, Offset: uint8(offset), Value: chunk}, &znp.SysOSALNVWriteReply{})
+		} else {
+			err = r.RequestResponse(ctx, znp.SysOSALNVWriteExt{NVItemID: id, Offset: uint16(offset), Value: chunk}, &znp.SysOSALNVWriteExtReply{})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadExtended reads an item from the NV driver of Z-Stack 3.x.0 in full, in chunks.
+func ReadExtended(ctx context.Context, r Requester, key ExtendedKey) ([]byte, error) {
+	lengthReply := znp.SysNVLengthReply{}
+
+	if err := r.RequestResponse(ctx, znp.SysNVLength{SysID: key.SysID, ItemID: key.ItemID, SubID: key.SubID}, &lengthReply); err != nil {
+		return nil, err
+	}
+
+	if lengthReply.Length == 0 {
+		return nil, fmt.Errorf("%w: extended item %+v", ItemNotFound, key)
+	}
+
+	if lengthReply.Length > 0xffff {
+		return nil, fmt.Errorf("%w: extended item %+v is %d bytes", ItemTooLarge, key, lengthReply.Length)
+	}
+
+	length := int(lengthReply.Length)
+	data := make([]byte, 0, length)
+
+	for len(data) < length {
+		offset := len(data)
+		reply := znp.SysNVReadReply{}
+
+		req := znp.SysNVRead{
+			SysID:  key.SysID,
+			ItemID: key.ItemID,
+			SubID:  key.SubID,
+			Offset: uint16(offset),
+			Length: uint8(minInt(MaxChunkSize, length-offset)),
+		}
+
+		if err := r.RequestResponse(ctx, req, &reply); err != nil {
+			return nil, err
+		}
+
+		if len(reply.Value) == 0 {
+			return nil, fmt.Errorf("%w: extended item %+v at offset %d", ReadMadeNoProgress, key, offset)
+		}
+
+		data = append(data, reply.Value...)
+	}
+
+	return data[:length], nil
+}
+
+// WriteExtended writes an item to the NV driver of Z-Stack 3.x.0 in full. The item is created if missing,
+// and recreated if its length differs from the value.
+func WriteExtended(ctx context.Context, r Requester, key ExtendedKey, value []byte) error {
+	if len(value) > 0xffff {
+		return fmt.Errorf("%w: extended item %+v is %d bytes", ItemTooLarge, key, len(value))
+	}
+
+	lengthReply := znp.SysNVLengthReply{}
+
+	if err := r.RequestResponse(ctx, znp.SysNVLength{SysID: key.SysID, ItemID: key.ItemID, SubID: key.SubID}, &lengthReply); err != nil {
+		return err
+	}
+
+	if lengthReply.Length != 0 && int(lengthReply.Length) != len(value) {
+		if err := r.RequestResponse(ctx, znp.SysNVDelete{SysID: key.SysID, ItemID: key.ItemID, SubID: key.SubID}, &znp.SysNVDeleteReply{}); err != nil {
+			return err
+		}
+	}
+
+	create := znp.SysNVCreate{SysID: key.SysID, ItemID: key.ItemID, SubID: key.SubID, Length: uint32(len(value))}
+
+	if err := r.RequestResponse(ctx, create, &znp.SysNVCreateReply{}); err != nil && !itemCreated(err) {
+		return err
+	}
+
+	for offset := 0; offset < len(value); offset += MaxChunkSize {
+		write := znp.SysNVWrite{
+			SysID:  key.SysID,
+			ItemID: key.ItemID,
+			SubID:  key.SubID,
+			Offset: uint16(offset),
+			Value:  value[offset:minInt(offset+MaxChunkSize, len(value))],
+		}
+
+		if err := r.RequestResponse(ctx, write, &znp.SysNVWriteReply{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// itemCreated returns true if the error is the NV_ITEM_UNINIT status, which Z-Stack reports when an item
+// did not exist and has been created.
+func itemCreated(err error) bool {
+	statusErr := broker.StatusError{}
+	return errors.As(err, &statusErr) && statusErr.Code == uint8(znp.StatusNVItemUninitialised)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
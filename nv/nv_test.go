@@ -0,0 +1,199 @@
+package nv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// osalReadLimit is the most data the simulated adapter returns in a single OSAL NV read reply.
+const osalReadLimit = 246
+
+// simulatedNV answers NV requests from maps of items, as a Z-Stack adapter would.
+type simulatedNV struct {
+	osal     map[uint16][]byte
+	extended map[ExtendedKey][]byte
+	requests []interface{}
+}
+
+func newSimulatedNV() *simulatedNV {
+	return &simulatedNV{
+		osal:     map[uint16][]byte{},
+		extended: map[ExtendedKey][]byte{},
+	}
+}
+
+func (s *simulatedNV) RequestResponse(ctx context.Context, req interface{}, resp interface{}) error {
+	s.requests = append(s.requests, req)
+
+	switch r := req.(type) {
+	case znp.SysOSALNVLength:
+		resp.(*znp.SysOSALNVLengthReply).Length = uint16(len(s.osal[r.NVItemID]))
+	case znp.SysOSALNVRead:
+		value := readChunk(s.osal[r.NVItemID], int(r.Offset), osalReadLimit)
+		resp.(*znp.SysOSALNVReadReply).Value = value
+	case znp.SysOSALNVReadExt:
+		value := readChunk(s.osal[r.NVItemID], int(r.Offset), osalReadLimit)
+		resp.(*znp.SysOSALNVReadExtReply).Value = value
+	case znp.SysOSALNVDelete:
+		delete(s.osal, r.NVItemID)
+	case znp.SysOSALNVItemInit:
+		if _, found := s.osal[r.NVItemID]; found {
+			return nil
+		}
+
+		s.osal[r.NVItemID] = make([]byte, r.ItemLen)
+		resp.(*znp.SysOSALNVItemInitReply).Status = znp.StatusNVItemUninitialised
+		return broker.StatusError{Code: uint8(znp.StatusNVItemUninitialised)}
+	case znp.SysOSALNVWrite:
+		copy(s.osal[r.NVItemID][r.Offset:], r.Value)
+	case znp.SysOSALNVWriteExt:
+		copy(s.osal[r.NVItemID][r.Offset:], r.Value)
+	case znp.SysNVLength:
+		resp.(*znp.SysNVLengthReply).Length = uint32(len(s.extended[ExtendedKey{r.SysID, r.ItemID, r.SubID}]))
+	case znp.SysNVRead:
+		value := readChunk(s.extended[ExtendedKey{r.SysID, r.ItemID, r.SubID}], int(r.Offset), int(r.Length))
+		resp.(*znp.SysNVReadReply).Value = value
+	case znp.SysNVDelete:
+		delete(s.extended, ExtendedKey{r.SysID, r.ItemID, r.SubID})
+	case znp.SysNVCreate:
+		key := ExtendedKey{r.SysID, r.ItemID, r.SubID}
+
+		if _, found := s.extended[key]; found {
+			return nil
+		}
+
+		s.extended[key] = make([]byte, r.Length)
+		return broker.StatusError{Code: uint8(znp.StatusNVItemUninitialised)}
+	case znp.SysNVWrite:
+		copy(s.extended[ExtendedKey{r.SysID, r.ItemID, r.SubID}][r.Offset:], r.Value)
+	default:
+		return fmt.Errorf("unexpected request %T", req)
+	}
+
+	return nil
+}
+
+func readChunk(data []byte, offset int, limit int) []byte {
+	if offset >= len(data) {
+		return nil
+	}
+
+	end := offset + limit
+	if end > len(data) {
+		end = len(data)
+	}
+
+	return append([]byte{}, data[offset:end]...)
+}
+
+func pattern(n int) []byte {
+	data := make([]byte, n)
+
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	return data
+}
+
+func TestOSAL(t *testing.T) {
+	t.Run("reads a short item in one request", func(t *testing.T) {
+		s := newSimulatedNV()
+		s.osal[ZCD_NV_PANID] = []byte{0x62, 0x1a}
+
+		value, err := ReadOSAL(context.Background(), s, ZCD_NV_PANID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x62, 0x1a}, value)
+		assert.Len(t, s.requests, 2)
+	})
+
+	t.Run("reads an item longer than a reply in chunks, using extended reads past offset 255", func(t *testing.T) {
+		s := newSimulatedNV()
+		s.osal[ZCD_NV_ADDRMGR] = pattern(600)
+
+		value, err := ReadOSAL(context.Background(), s, ZCD_NV_ADDRMGR)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pattern(600), value)
+		assert.Equal(t, znp.SysOSALNVRead{NVItemID: ZCD_NV_ADDRMGR, Offset: 246}, s.requests[2])
+		assert.Equal(t, znp.SysOSALNVReadExt{NVItemID: ZCD_NV_ADDRMGR, Offset: 492}, s.requests[3])
+	})
+
+	t.Run("returns ItemNotFound for an absent item", func(t *testing.T) {
+		s := newSimulatedNV()
+
+		_, err := ReadOSAL(context.Background(), s, ZCD_NV_PANID)
+
+		assert.True(t, errors.Is(err, ItemNotFound))
+	})
+
+	t.Run("creates and writes an item in chunks", func(t *testing.T) {
+		s := newSimulatedNV()
+
+		err := WriteOSAL(context.Background(), s, ZCD_NV_ADDRMGR, pattern(600))
+
+		assert.NoError(t, err)
+		assert.Equal(t, pattern(600), s.osal[ZCD_NV_ADDRMGR])
+	})
+
+	t.Run("recreates an item whose length differs", func(t *testing.T) {
+		s := newSimulatedNV()
+		s.osal[ZCD_NV_PANID] = []byte{0x01, 0x02, 0x03}
+
+		err := WriteOSAL(context.Background(), s, ZCD_NV_PANID, []byte{0x62, 0x1a})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x62, 0x1a}, s.osal[ZCD_NV_PANID])
+		assert.Contains(t, s.requests, znp.SysOSALNVDelete{NVItemID: ZCD_NV_PANID, ItemLen: 3})
+	})
+}
+
+func TestExtended(t *testing.T) {
+	key := ExtendedKey{SysID: NVINTF_SYSID_ZSTACK, ItemID: ZCD_NV_EX_ADDRMGR, SubID: 2}
+
+	t.Run("reads and writes an item in chunks", func(t *testing.T) {
+		s := newSimulatedNV()
+
+		err := WriteExtended(context.Background(), s, key, pattern(500))
+		assert.NoError(t, err)
+
+		value, err := ReadExtended(context.Background(), s, key)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pattern(500), value)
+	})
+
+	t.Run("returns ItemNotFound for an absent item", func(t *testing.T) {
+		s := newSimulatedNV()
+
+		_, err := ReadExtended(context.Background(), s, key)
+
+		assert.True(t, errors.Is(err, ItemNotFound))
+	})
+
+	t.Run("returns errors other than a created item", func(t *testing.T) {
+		s := &failingRequester{err: broker.StatusError{Code: uint8(znp.StatusFailure)}}
+
+		err := WriteExtended(context.Background(), s, key, []byte{0x01})
+
+		assert.True(t, errors.As(err, &broker.StatusError{}))
+	})
+}
+
+type failingRequester struct {
+	err error
+}
+
+func (f *failingRequester) RequestResponse(ctx context.Context, req interface{}, resp interface{}) error {
+	if _, ok := req.(znp.SysNVLength); ok {
+		return nil
+	}
+
+	return f.err
+}
@@ -0,0 +1,61 @@
+package unpi
+
+import "fmt"
+
+// RPCErrorCode is returned by an adapter in an RPCError when it cannot process a synchronous request.
+type RPCErrorCode uint8
+
+const (
+	RPCErrorUnsupportedSubsystem RPCErrorCode = 0x01
+	RPCErrorUnsupportedCommand   RPCErrorCode = 0x02
+	RPCErrorInvalidParameter     RPCErrorCode = 0x03
+	RPCErrorInvalidLength        RPCErrorCode = 0x04
+)
+
+func (c RPCErrorCode) String() string {
+	switch c {
+	case RPCErrorUnsupportedSubsystem:
+		return "MT_RPC_ERR_SUBSYSTEM"
+	case RPCErrorUnsupportedCommand:
+		return "MT_RPC_ERR_COMMAND_ID"
+	case RPCErrorInvalidParameter:
+		return "MT_RPC_ERR_PARAMETER"
+	case RPCErrorInvalidLength:
+		return "MT_RPC_ERR_LENGTH"
+	default:
+		return fmt.Sprintf("MT_RPC_ERR_UNKNOWN_0x%02x", uint8(c))
+	}
+}
+
+func (c RPCErrorCode) Error() string {
+	return "rpc error " + c.String()
+}
+
+// RPCErrorCommandID is the command ID of an RPCError, which is sent as an SRSP in the RES0 subsystem.
+const RPCErrorCommandID byte = 0x00
+
+// RPCError is sent as an SRSP in the RES0 subsystem in place of the response to a synchronous request which
+// could not be processed. Cmd0 and Cmd1 are the type and subsystem, and command ID, of the request.
+type RPCError struct {
+	ErrorCode RPCErrorCode
+	Cmd0      uint8
+	Cmd1      uint8
+}
+
+// NewRPCError returns the RPCError answering the request frame.
+func NewRPCError(code RPCErrorCode, req Frame) RPCError {
+	return RPCError{ErrorCode: code, Cmd0: uint8(req.MessageType)<<5 | uint8(req.Subsystem), Cmd1: req.CommandID}
+}
+
+// Answers returns true if the RPCError was sent in response to the request frame.
+func (e RPCError) Answers(req Frame) bool {
+	return MessageType(e.Cmd0>>5) == req.MessageType && Subsystem(e.Cmd0&0x1f) == req.Subsystem && e.Cmd1 == req.CommandID
+}
+
+func (e RPCError) Error() string {
+	return fmt.Sprintf("request 0x%02x/0x%02x/0x%02x failed with %s", e.Cmd0>>5, e.Cmd0&0x1f, e.Cmd1, e.ErrorCode.String())
+}
+
+func (e RPCError) Unwrap() error {
+	return e.ErrorCode
+}
@@ -0,0 +1,31 @@
+package unpi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRPCError(t *testing.T) {
+	t.Run("identifies the request it answers", func(t *testing.T) {
+		req := Frame{MessageType: SREQ, Subsystem: ZDO, CommandID: 0x36}
+		rpcErr := NewRPCError(RPCErrorUnsupportedCommand, req)
+
+		assert.Equal(t, RPCError{ErrorCode: RPCErrorUnsupportedCommand, Cmd0: 0x25, Cmd1: 0x36}, rpcErr)
+		assert.True(t, rpcErr.Answers(req))
+		assert.False(t, rpcErr.Answers(Frame{MessageType: SREQ, Subsystem: ZDO, CommandID: 0x37}))
+		assert.False(t, rpcErr.Answers(Frame{MessageType: SREQ, Subsystem: AF, CommandID: 0x36}))
+	})
+
+	t.Run("wraps its error code", func(t *testing.T) {
+		rpcErr := RPCError{ErrorCode: RPCErrorInvalidLength, Cmd0: 0x21, Cmd1: 0x02}
+
+		assert.True(t, errors.Is(rpcErr, RPCErrorInvalidLength))
+		assert.Equal(t, "request 0x01/0x01/0x02 failed with MT_RPC_ERR_LENGTH", rpcErr.Error())
+	})
+
+	t.Run("error code names", func(t *testing.T) {
+		assert.Equal(t, "MT_RPC_ERR_PARAMETER", RPCErrorInvalidParameter.String())
+		assert.Equal(t, "MT_RPC_ERR_UNKNOWN_0x7f", RPCErrorCode(0x7f).String())
+	})
+}
@@ -0,0 +1,37 @@
+package sbl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/unpi/firmware"
+)
+
+var ImageTooLarge = errors.New("image exceeds bootloader address range")
+
+type block struct {
+	address uint16
+	data    [BlockSize]byte
+}
+
+// blocksOf normalises the image into blocks of BlockSize, addressed in words as the bootloader expects. Blocks
+// without any data are not written.
+func blocksOf(image firmware.Image) ([]block, error) {
+	if image.Empty() {
+		return nil, firmware.ImageEmpty
+	}
+
+	if _, end := image.Range(); (end-1)/WordSize > 0xffff {
+		return nil, fmt.Errorf("%w: ends at 0x%x", ImageTooLarge, end)
+	}
+
+	var blocks []block
+
+	for _, b := range image.Blocks(BlockSize, firmware.FillByte) {
+		converted := block{address: uint16(b.Address / WordSize)}
+		copy(converted.data[:], b.Data)
+
+		blocks = append(blocks, converted)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,60 @@
+package sbl
+
+import (
+	"errors"
+	"github.com/shimmeringbee/unpi/firmware"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func pattern(n int) []byte {
+	data := make([]byte, n)
+
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	return data
+}
+
+func TestBlocksOf(t *testing.T) {
+	t.Run("aligns blocks, pads with the fill byte and uses word addresses", func(t *testing.T) {
+		blocks, err := blocksOf(firmware.Raw([]byte{0x01, 0x02}, 0x7f))
+
+		assert.NoError(t, err)
+		assert.Len(t, blocks, 2)
+
+		assert.Equal(t, uint16(0x40/WordSize), blocks[0].address)
+		assert.Equal(t, byte(0x01), blocks[0].data[BlockSize-1])
+		assert.Equal(t, firmware.FillByte, blocks[0].data[0])
+
+		assert.Equal(t, uint16(0x80/WordSize), blocks[1].address)
+		assert.Equal(t, byte(0x02), blocks[1].data[0])
+		assert.Equal(t, firmware.FillByte, blocks[1].data[1])
+	})
+
+	t.Run("skips blocks without data in sparse images", func(t *testing.T) {
+		image := firmware.Image{Segments: []firmware.Segment{
+			{Address: 0x00, Data: []byte{0x01}},
+			{Address: 0x100, Data: []byte{0x02}},
+		}}
+
+		blocks, err := blocksOf(image)
+
+		assert.NoError(t, err)
+		assert.Len(t, blocks, 2)
+		assert.Equal(t, uint16(0x100/WordSize), blocks[1].address)
+	})
+
+	t.Run("rejects empty images", func(t *testing.T) {
+		_, err := blocksOf(firmware.Image{})
+
+		assert.True(t, errors.Is(err, firmware.ImageEmpty))
+	})
+
+	t.Run("rejects images beyond the bootloader address range", func(t *testing.T) {
+		_, err := blocksOf(firmware.Raw([]byte{0x01}, 0x40000))
+
+		assert.True(t, errors.Is(err, ImageTooLarge))
+	})
+}
@@ -0,0 +1,120 @@
+package sbl
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+)
+
+// BlockSize is the number of bytes carried by a single write or read command.
+const BlockSize = 64
+
+// WordSize is the number of bytes addressed by each unit of a bootloader address, addresses in commands
+// are byte addresses divided by WordSize.
+const WordSize = 4
+
+// Command IDs of the serial bootloader, responses are sent with ResponseMask set on the command ID.
+const (
+	WriteCommandID     uint8 = 0x01
+	ReadCommandID      uint8 = 0x02
+	EnableCommandID    uint8 = 0x03
+	HandshakeCommandID uint8 = 0x04
+	// EraseCommandID is not implemented by every bootloader build, those without it erase each page as it
+	// is first written.
+	EraseCommandID uint8 = 0x05
+
+	ResponseMask uint8 = 0x80
+)
+
+// Status is the status returned by every bootloader response.
+type Status uint8
+
+const (
+	StatusSuccess         Status = 0x00
+	StatusFailure         Status = 0x01
+	StatusInvalidFCS      Status = 0x02
+	StatusInvalidFile     Status = 0x03
+	StatusFilesystemError Status = 0x04
+	StatusAlreadyStarted  Status = 0x05
+	StatusNoResponse      Status = 0x06
+	StatusValidateFailed  Status = 0x07
+	StatusCanceled        Status = 0x08
+)
+
+var statusNames = map[Status]string{
+	StatusSuccess:         "SB_SUCCESS",
+	StatusFailure:         "SB_FAILURE",
+	StatusInvalidFCS:      "SB_INVALID_FCS",
+	StatusInvalidFile:     "SB_INVALID_FILE",
+	StatusFilesystemError: "SB_FILESYSTEM_ERROR",
+	StatusAlreadyStarted:  "SB_ALREADY_STARTED",
+	StatusNoResponse:      "SB_NO_RESPONSE",
+	StatusValidateFailed:  "SB_VALIDATE_FAILED",
+	StatusCanceled:        "SB_CANCELED",
+}
+
+func (s Status) String() string {
+	if name, found := statusNames[s]; found {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN_STATUS_0x%02x", uint8(s))
+}
+
+type Write struct {
+	Address uint16
+	Data    [BlockSize]byte
+}
+
+type WriteReply struct {
+	Status Status
+}
+
+type Read struct {
+	Address uint16
+}
+
+type ReadReply struct {
+	Status  Status
+	Address uint16
+	Data    [BlockSize]byte
+}
+
+type Enable struct{}
+
+type EnableReply struct {
+	Status Status
+}
+
+type Handshake struct{}
+
+type HandshakeReply struct {
+	Status Status
+}
+
+type Erase struct{}
+
+type EraseReply struct {
+	Status Status
+}
+
+// Library returns a message library populated with the serial bootloader commands.
+func Library() *library.Library {
+	ml := library.NewLibrary()
+	Register(ml)
+	return ml
+}
+
+// Register adds the serial bootloader commands to an existing message library.
+func Register(ml *library.Library) {
+	ml.Add(unpi.AREQ, unpi.BOOT, WriteCommandID, Write{})
+	ml.Add(unpi.AREQ, unpi.BOOT, WriteCommandID|ResponseMask, WriteReply{}, library.WithLeadingStatus())
+	ml.Add(unpi.AREQ, unpi.BOOT, ReadCommandID, Read{})
+	ml.Add(unpi.AREQ, unpi.BOOT, ReadCommandID|ResponseMask, ReadReply{}, library.WithLeadingStatus())
+	ml.Add(unpi.AREQ, unpi.BOOT, EnableCommandID, Enable{})
+	ml.Add(unpi.AREQ, unpi.BOOT, EnableCommandID|ResponseMask, EnableReply{}, library.WithLeadingStatus())
+	ml.Add(unpi.AREQ, unpi.BOOT, HandshakeCommandID, Handshake{})
+	ml.Add(unpi.AREQ, unpi.BOOT, HandshakeCommandID|ResponseMask, HandshakeReply{}, library.WithLeadingStatus())
+	ml.Add(unpi.AREQ, unpi.BOOT, EraseCommandID, Erase{})
+	ml.Add(unpi.AREQ, unpi.BOOT, EraseCommandID|ResponseMask, EraseReply{}, library.WithLeadingStatus())
+}
@@ -0,0 +1,185 @@
+// Package sbl flashes firmware using the CC2530/CC2531 MT serial bootloader, which is driven with UNPI
+// frames in the BOOT subsystem. It does not support CC26x2 devices such as the CC2652, their ROM bootloader
+// is the TI serial BSL which does not use UNPI or MT framing.
+package sbl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/unpi/firmware"
+	"time"
+)
+
+var VerifyFailed = errors.New("verify failed, read back data differs")
+
+// Requester sends a request and waits for its response, it is satisfied by *broker.Broker using the
+// library returned by Library.
+type Requester interface {
+	RequestResponse(ctx context.Context, req interface{}, resp interface{}) error
+}
+
+// Phase is the step of flashing that progress is being reported for.
+type Phase uint8
+
+const (
+	PhaseHandshake Phase = iota
+	PhaseErase
+	PhaseWrite
+	PhaseVerify
+	PhaseEnable
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseHandshake:
+		return "Handshake"
+	case PhaseErase:
+		return "Erase"
+	case PhaseWrite:
+		return "Write"
+	case PhaseVerify:
+		return "Verify"
+	case PhaseEnable:
+		return "Enable"
+	default:
+		return fmt.Sprintf("Unknown Phase %d", uint8(p))
+	}
+}
+
+// Progress is reported as flashing proceeds, Done and Total count blocks during write and verify, and are
+// otherwise zero until the phase completes.
+type Progress struct {
+	Phase Phase
+	Done  int
+	Total int
+}
+
+// Options configure Flash, zero values are replaced with defaults.
+type Options struct {
+	// Erase sends the erase command before writing, only for bootloaders which implement it.
+	Erase bool
+	// SkipVerify disables reading back every block after writing.
+	SkipVerify bool
+	// SkipEnable leaves the bootloader running after the image is written.
+	SkipEnable bool
+
+	HandshakeAttempts int
+	CommandTimeout    time.Duration
+	EraseTimeout      time.Duration
+
+	Progress func(Progress)
+}
+
+func (o Options) withDefaults() Options {
+	if o.HandshakeAttempts <= 0 {
+		o.HandshakeAttempts = 5
+	}
+
+	if o.CommandTimeout <= 0 {
+		o.CommandTimeout = time.Second
+	}
+
+	if o.EraseTimeout <= 0 {
+		o.EraseTimeout = 30 * time.Second
+	}
+
+	if o.Progress == nil {
+		o.Progress = func(Progress) {}
+	}
+
+	return o
+}
+
+// Flash writes the image, as loaded by the firmware package, using the bootloader: handshake, optionally
+// erase, write each block, read back and verify each block, and finally enable the image so that the
+// bootloader runs it.
+func Flash(ctx context.Context, r Requester, image firmware.Image, opts Options) error {
+	opts = opts.withDefaults()
+
+	blocks, err := blocksOf(image)
+	if err != nil {
+		return err
+	}
+
+	if err := handshake(ctx, r, opts); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+
+	if opts.Erase {
+		opts.Progress(Progress{Phase: PhaseErase})
+
+		if err := command(ctx, r, opts.EraseTimeout, Erase{}, &EraseReply{}); err != nil {
+			return fmt.Errorf("erase: %w", err)
+		}
+
+		opts.Progress(Progress{Phase: PhaseErase, Done: 1, Total: 1})
+	}
+
+	for i, b := range blocks {
+		opts.Progress(Progress{Phase: PhaseWrite, Done: i, Total: len(blocks)})
+
+		if err := command(ctx, r, opts.CommandTimeout, Write{Address: b.address, Data: b.data}, &WriteReply{}); err != nil {
+			return fmt.Errorf("write at 0x%04x: %w", b.address, err)
+		}
+	}
+
+	opts.Progress(Progress{Phase: PhaseWrite, Done: len(blocks), Total: len(blocks)})
+
+	if !opts.SkipVerify {
+		for i, b := range blocks {
+			opts.Progress(Progress{Phase: PhaseVerify, Done: i, Total: len(blocks)})
+
+			reply := ReadReply{}
+
+			if err := command(ctx, r, opts.CommandTimeout, Read{Address: b.address}, &reply); err != nil {
+				return fmt.Errorf("read at 0x%04x: %w", b.address, err)
+			}
+
+			if reply.Address != b.address || !bytes.Equal(reply.Data[:], b.data[:]) {
+				return fmt.Errorf("%w: at 0x%04x", VerifyFailed, b.address)
+			}
+		}
+
+		opts.Progress(Progress{Phase: PhaseVerify, Done: len(blocks), Total: len(blocks)})
+	}
+
+	if !opts.SkipEnable {
+		opts.Progress(Progress{Phase: PhaseEnable})
+
+		if err := command(ctx, r, opts.CommandTimeout, Enable{}, &EnableReply{}); err != nil {
+			return fmt.Errorf("enable: %w", err)
+		}
+
+		opts.Progress(Progress{Phase: PhaseEnable, Done: 1, Total: 1})
+	}
+
+	return nil
+}
+
+func handshake(ctx context.Context, r Requester, opts Options) error {
+	opts.Progress(Progress{Phase: PhaseHandshake})
+
+	var err error
+
+	for attempt := 1; attempt <= opts.HandshakeAttempts; attempt++ {
+		if err = command(ctx, r, opts.CommandTimeout, Handshake{}, &HandshakeReply{}); err == nil {
+			opts.Progress(Progress{Phase: PhaseHandshake, Done: 1, Total: 1})
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return err
+}
+
+func command(ctx context.Context, r Requester, timeout time.Duration, req interface{}, resp interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return r.RequestResponse(ctx, req, resp)
+}
@@ -0,0 +1,114 @@
+package sbl
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/firmware"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func replyFrame(commandID uint8, v interface{}) unpi.Frame {
+	payload, _ := bytecodec.Marshal(v)
+	return unpi.Frame{MessageType: unpi.AREQ, Subsystem: unpi.BOOT, CommandID: commandID | ResponseMask, Payload: payload}
+}
+
+// simulatedBootloader configures a MockAdapter to answer as a serial bootloader that has been written the
+// blocks, read replies are returned in block order as Flash verifies them.
+func simulatedBootloader(t *testing.T, blocks []block, writeStatus Status) (*testunpi.MockAdapter, *broker.Broker) {
+	m := testunpi.NewMockAdapter()
+
+	var readReplies []unpi.Frame
+	for _, b := range blocks {
+		readReplies = append(readReplies, replyFrame(ReadCommandID, ReadReply{Address: b.address, Data: b.data}))
+	}
+
+	m.On(unpi.AREQ, unpi.BOOT, HandshakeCommandID).Return(replyFrame(HandshakeCommandID, HandshakeReply{}))
+	m.On(unpi.AREQ, unpi.BOOT, WriteCommandID).Return(replyFrame(WriteCommandID, WriteReply{Status: writeStatus})).Times(len(blocks))
+	m.On(unpi.AREQ, unpi.BOOT, ReadCommandID).Return(readReplies...).Times(len(blocks))
+	m.On(unpi.AREQ, unpi.BOOT, EnableCommandID).Return(replyFrame(EnableCommandID, EnableReply{}))
+
+	b := broker.NewBroker(m, m, Library())
+	b.Start()
+
+	t.Cleanup(func() {
+		b.Stop()
+		m.Stop()
+	})
+
+	return m, b
+}
+
+func TestFlash(t *testing.T) {
+	image := firmware.Raw(pattern(150), 0x100)
+	opts := Options{CommandTimeout: 100 * time.Millisecond}
+
+	t.Run("handshakes, writes, verifies and enables the image, reporting progress", func(t *testing.T) {
+		blocks, err := blocksOf(image)
+		assert.NoError(t, err)
+
+		m, b := simulatedBootloader(t, blocks, StatusSuccess)
+
+		var progress []Progress
+		opts := opts
+		opts.Progress = func(p Progress) {
+			progress = append(progress, p)
+		}
+
+		err = Flash(context.Background(), b, image, opts)
+
+		assert.NoError(t, err)
+		assert.Contains(t, progress, Progress{Phase: PhaseHandshake, Done: 1, Total: 1})
+		assert.Contains(t, progress, Progress{Phase: PhaseWrite, Done: 3, Total: 3})
+		assert.Contains(t, progress, Progress{Phase: PhaseVerify, Done: 3, Total: 3})
+		assert.Equal(t, Progress{Phase: PhaseEnable, Done: 1, Total: 1}, progress[len(progress)-1])
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("fails verification if read back data differs", func(t *testing.T) {
+		blocks, _ := blocksOf(image)
+		corrupted := append([]block{}, blocks...)
+		corrupted[0].data[3] ^= 0xff
+
+		_, b := simulatedBootloader(t, corrupted, StatusSuccess)
+
+		err := Flash(context.Background(), b, image, opts)
+
+		assert.True(t, errors.Is(err, VerifyFailed))
+	})
+
+	t.Run("returns the bootloader status if a write fails", func(t *testing.T) {
+		blocks, _ := blocksOf(image)
+		_, b := simulatedBootloader(t, blocks, StatusInvalidFCS)
+
+		err := Flash(context.Background(), b, image, opts)
+
+		statusErr := broker.StatusError{}
+		if assert.True(t, errors.As(err, &statusErr)) {
+			assert.Equal(t, "SB_INVALID_FCS", statusErr.Name)
+		}
+	})
+
+	t.Run("gives up if the bootloader never answers a handshake", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(unpi.AREQ, unpi.BOOT, HandshakeCommandID).Times(2)
+
+		b := broker.NewBroker(m, m, Library())
+		b.Start()
+		defer b.Stop()
+
+		opts := Options{HandshakeAttempts: 2, CommandTimeout: 10 * time.Millisecond}
+		err := Flash(context.Background(), b, image, opts)
+
+		assert.True(t, errors.Is(err, broker.ContextCancelled))
+		m.AssertCalls(t)
+	})
+}
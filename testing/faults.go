@@ -0,0 +1,157 @@
+package testing
+
+import (
+	"fmt"
+	. "github.com/shimmeringbee/unpi"
+	"math/rand"
+	"time"
+)
+
+// Fault is a misbehaviour the mock applies to the bytes of a frame it sends, to test handling of a
+// misbehaving adapter.
+type Fault uint8
+
+const (
+	// FaultCorruptChecksum inverts the checksum of the frame.
+	FaultCorruptChecksum Fault = iota
+	// FaultDropByte removes a single byte, other than the start of frame, from the frame.
+	FaultDropByte
+	// FaultDuplicateByte repeats a single byte of the frame.
+	FaultDuplicateByte
+	// FaultGarbage precedes the frame with bytes which are not StartOfFrame.
+	FaultGarbage
+	// FaultSplitReads returns the frame a single byte per Read.
+	FaultSplitReads
+	// FaultTruncate removes the end of the frame.
+	FaultTruncate
+	// FaultStall blocks Read for the stall duration before the frame is returned.
+	FaultStall
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FaultCorruptChecksum:
+		return "CorruptChecksum"
+	case FaultDropByte:
+		return "DropByte"
+	case FaultDuplicateByte:
+		return "DuplicateByte"
+	case FaultGarbage:
+		return "Garbage"
+	case FaultSplitReads:
+		return "SplitReads"
+	case FaultTruncate:
+		return "Truncate"
+	case FaultStall:
+		return "Stall"
+	default:
+		return fmt.Sprintf("Unknown Fault %d", uint8(f))
+	}
+}
+
+const defaultFaultSeed int64 = 1
+const defaultStallDuration = 100 * time.Millisecond
+const maximumGarbage = 8
+
+// MockOption configures a MockAdapter when it is constructed.
+type MockOption func(*MockAdapter)
+
+// WithRandomFaults applies one of faults, chosen at random, to each frame sent with probability rate. The
+// seed also chooses the bytes affected by every fault, so results are reproducible.
+func WithRandomFaults(seed int64, rate float64, faults ...Fault) MockOption {
+	return func(m *MockAdapter) {
+		m.faults.random = rand.New(rand.NewSource(seed))
+		m.faults.rate = rate
+		m.faults.kinds = faults
+	}
+}
+
+// WithStallDuration sets how long FaultStall blocks Read, the default is 100ms.
+func WithStallDuration(d time.Duration) MockOption {
+	return func(m *MockAdapter) {
+		m.faults.stall = d
+	}
+}
+
+type faultInjector struct {
+	random *rand.Rand
+	rate   float64
+	kinds  []Fault
+	stall  time.Duration
+}
+
+func newFaultInjector() faultInjector {
+	return faultInjector{
+		random: rand.New(rand.NewSource(defaultFaultSeed)),
+		stall:  defaultStallDuration,
+	}
+}
+
+// outgoing is a frame waiting to be read from the mock, with the faults requested for it.
+type outgoing struct {
+	frame  Frame
+	faults []Fault
+}
+
+// chunk is the data of a frame ready to be read, with how faults have changed the way it is read.
+type chunk struct {
+	data  []byte
+	split bool
+	stall bool
+}
+
+// prepare marshals the frame and applies its faults, adding a random fault if configured.
+func (fi *faultInjector) prepare(o outgoing) chunk {
+	return fi.prepareData(o.frame.Marshall(), o.faults)
+}
+
+// prepareData applies faults to data, adding a random fault if configured.
+func (fi *faultInjector) prepareData(data []byte, faults []Fault) chunk {
+	if fi.rate > 0 && len(fi.kinds) > 0 && fi.random.Float64() < fi.rate {
+		faults = append(append([]Fault{}, faults...), fi.kinds[fi.random.Intn(len(fi.kinds))])
+	}
+
+	c := chunk{data: data}
+
+	for _, f := range faults {
+		c = fi.apply(f, c)
+	}
+
+	return c
+}
+
+func (fi *faultInjector) apply(f Fault, c chunk) chunk {
+	data := c.data
+
+	switch f {
+	case FaultCorruptChecksum:
+		data[len(data)-1] ^= 0xff
+	case FaultDropByte:
+		if len(data) > 1 {
+			i := fi.random.Intn(len(data)-1) + 1
+			data = append(data[:i:i], data[i+1:]...)
+		}
+	case FaultDuplicateByte:
+		i := fi.random.Intn(len(data))
+		data = append(data[:i+1:i+1], data[i:]...)
+	case FaultGarbage:
+		garbage := make([]byte, fi.random.Intn(maximumGarbage)+1)
+
+		for i := range garbage {
+			garbage[i] = byte(fi.random.Intn(int(StartOfFrame)))
+		}
+
+		data = append(garbage, data...)
+	case FaultSplitReads:
+		c.split = true
+	case FaultTruncate:
+		if len(data) > 1 {
+			data = data[:fi.random.Intn(len(data)-1)+1]
+		}
+	case FaultStall:
+		c.stall = true
+	}
+
+	c.data = data
+	return c
+}
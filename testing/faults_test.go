@@ -0,0 +1,134 @@
+package testing
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFaultInjector(t *testing.T) {
+	frame := Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x80, Payload: []byte{0x01, 0x02, 0x03, 0x04}}
+	marshalled := frame.Marshall()
+
+	t.Run("byte faults change the length of the frame", func(t *testing.T) {
+		fi := newFaultInjector()
+
+		assert.Len(t, fi.prepare(outgoing{frame: frame, faults: []Fault{FaultDropByte}}).data, len(marshalled)-1)
+		assert.Len(t, fi.prepare(outgoing{frame: frame, faults: []Fault{FaultDuplicateByte}}).data, len(marshalled)+1)
+		assert.Less(t, len(fi.prepare(outgoing{frame: frame, faults: []Fault{FaultTruncate}}).data), len(marshalled))
+	})
+
+	t.Run("dropped bytes never include the start of frame", func(t *testing.T) {
+		fi := newFaultInjector()
+
+		for i := 0; i < 20; i++ {
+			c := fi.prepare(outgoing{frame: frame, faults: []Fault{FaultDropByte}})
+			assert.Equal(t, StartOfFrame, c.data[0])
+		}
+	})
+
+	t.Run("garbage precedes the frame and does not contain a start of frame", func(t *testing.T) {
+		fi := newFaultInjector()
+
+		c := fi.prepare(outgoing{frame: frame, faults: []Fault{FaultGarbage}})
+		start := bytes.IndexByte(c.data, StartOfFrame)
+
+		assert.Greater(t, start, 0)
+		assert.Equal(t, marshalled, c.data[start:])
+	})
+
+	t.Run("random faults are reproducible with the same seed", func(t *testing.T) {
+		prepareMany := func() [][]byte {
+			m := &MockAdapter{faults: newFaultInjector()}
+			WithRandomFaults(42, 0.5, FaultDropByte, FaultDuplicateByte, FaultGarbage, FaultTruncate)(m)
+
+			var data [][]byte
+			for i := 0; i < 20; i++ {
+				data = append(data, m.faults.prepare(outgoing{frame: frame}).data)
+			}
+
+			return data
+		}
+
+		first := prepareMany()
+
+		assert.Equal(t, first, prepareMany())
+
+		faulted := 0
+		for _, data := range first {
+			if !bytes.Equal(marshalled, data) {
+				faulted++
+			}
+		}
+
+		assert.Greater(t, faulted, 0)
+		assert.Less(t, faulted, len(first))
+	})
+}
+
+func TestMockAdapter_Faults(t *testing.T) {
+	frame := Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x80, Payload: []byte{0x01, 0x02, 0x03, 0x04}}
+
+	t.Run("corrupted checksums fail to unmarshal and following frames are intact", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.InjectOutgoing(frame, FaultCorruptChecksum)
+		m.InjectOutgoing(frame)
+
+		_, err := Read(m)
+		assert.True(t, errors.Is(err, FrameChecksumFailed))
+
+		actual, err := Read(m)
+		assert.NoError(t, err)
+		assert.Equal(t, frame, actual)
+	})
+
+	t.Run("split reads return a single byte at a time", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.InjectOutgoing(frame, FaultSplitReads)
+
+		var reads []int
+		buffer := make([]byte, 64)
+
+		for i := 0; i < len(frame.Marshall()); i++ {
+			n, err := m.Read(buffer)
+			assert.NoError(t, err)
+
+			reads = append(reads, n)
+		}
+
+		assert.Equal(t, []int{1, 1, 1, 1, 1, 1, 1, 1, 1}, reads)
+	})
+
+	t.Run("stalled reads block for the stall duration", func(t *testing.T) {
+		m := NewMockAdapter(WithStallDuration(50 * time.Millisecond))
+		defer m.Stop()
+
+		m.InjectOutgoing(frame, FaultStall)
+
+		start := time.Now()
+		_, err := Read(m)
+
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	})
+
+	t.Run("expectations apply faults to their responses", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		request := Frame{MessageType: SREQ, Subsystem: AF, CommandID: 0x01}
+		m.On(SREQ, AF, 0x01).Return(frame).WithFaults(FaultGarbage, FaultCorruptChecksum)
+
+		_ = Write(m, request)
+
+		_, err := Read(m)
+		assert.True(t, errors.Is(err, FrameChecksumFailed))
+	})
+}
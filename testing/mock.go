@@ -2,10 +2,16 @@ package testing
 
 import (
 	"bytes"
+	"context"
+	"github.com/shimmeringbee/bytecodec"
 	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
 	"io"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const UnlimitedCalls = -1
@@ -13,18 +19,34 @@ const UnlimitedCalls = -1
 type MockAdapter struct {
 	sequencer *int64
 
-	ReceivedFrames []Frame
+	// mutex guards the expectations and everything recorded against them, frames are matched on their
+	// own goroutines.
+	mutex *sync.Mutex
+
+	receivedFrames []Frame
 
 	incomingReader io.Reader
 	incomingWriter io.WriteCloser
 	incomingEnd    chan bool
 
 	outgoingBuffer *bytes.Buffer
-	outgoingFrames chan Frame
+	outgoingSplit  bool
+	outgoingFrames chan outgoing
 	outgoingEnd    chan bool
 
-	Calls           []*Call
-	UnexpectedCalls []CallRecord
+	// responses carries undelayed responses to a single goroutine, so they are sent in the order the
+	// frames were received.
+	responses chan pendingResponse
+
+	faults  faultInjector
+	library *library.Library
+
+	calls           []*Call
+	unexpectedCalls []CallRecord
+	orders          [][]*Call
+
+	// matched is closed and replaced each time a frame is matched, waking anything waiting for calls.
+	matched chan struct{}
 }
 
 type CallRecord struct {
@@ -55,48 +77,285 @@ func (cr CallRecord) AssertAfter(t *testing.T, ocr CallRecord) {
 }
 
 type Call struct {
+	mutex   *sync.Mutex
+	adapter *MockAdapter
+
 	mT MessageType
 	s  Subsystem
 	c  byte
 
-	CapturedCalls []CallRecord
+	matchers      []func(Frame) bool
+	capturedCalls []CallRecord
 	returnFrames  []Frame
+	responder     func(Frame) []Frame
+	delay         time.Duration
+	faults        []Fault
 
 	expectedCalls int
 	actualCalls   int
+
+	// identity is the message expected, set when the call is made by Expect.
+	identity *library.Identity
+
+	// exhaustible calls stop matching once they reach their expected calls, previous must be exhausted
+	// before a call chained with Then matches.
+	exhaustible bool
+	previous    *Call
+	next        *Call
 }
 
+// Return responds to each matching frame with one of frames, in round-robin order.
 func (c *Call) Return(frames ...Frame) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.returnFrames = frames
+	c.responder = nil
+	return c
+}
+
+// RespondWith responds to each matching frame with the frames returned by responder, allowing responses to
+// be built from the request.
+func (c *Call) RespondWith(responder func(req Frame) []Frame) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.returnFrames = nil
+	c.responder = responder
 	return c
 }
 
+// ReturnThenAsync responds to each matching frame with srsp followed by every areq, modelling commands
+// whose synchronous response is followed by callbacks.
+func (c *Call) ReturnThenAsync(srsp Frame, areq ...Frame) *Call {
+	frames := append([]Frame{srsp}, areq...)
+
+	return c.RespondWith(func(Frame) []Frame {
+		return frames
+	})
+}
+
+// After delays responses to matching frames by delay.
+func (c *Call) After(delay time.Duration) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.delay = delay
+	return c
+}
+
+// WithFaults applies faults to every response sent for matching frames.
+func (c *Call) WithFaults(faults ...Fault) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.faults = faults
+	return c
+}
+
+// Once expects a single matching frame, after which the call no longer matches so that further frames
+// fall through to a call chained with Then.
+func (c *Call) Once() *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expectedCalls = 1
+	c.exhaustible = true
+	return c
+}
+
+// Then returns a new call for the same frames, with the same payload matchers, which matches only once
+// this call has received all of its expected calls. It allows successive frames to receive different
+// responses. It panics if this call expects unlimited calls, as the new call would never match.
+func (c *Call) Then() *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.expectedCalls == UnlimitedCalls {
+		panic("mock: Then cannot follow a call which expects unlimited calls")
+	}
+
+	c.exhaustible = true
+
+	next := c.adapter.newCall(c.mT, c.s, c.c)
+	next.matchers = append([]func(Frame) bool{}, c.matchers...)
+	next.identity = c.identity
+	next.previous = c
+	c.next = next
+
+	c.adapter.calls = append(c.adapter.calls, next)
+
+	return next
+}
+
+func (c *Call) exhausted() bool {
+	return c.exhaustible && c.expectedCalls != UnlimitedCalls && c.actualCalls >= c.expectedCalls
+}
+
 func (c *Call) Times(times int) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	c.expectedCalls = times
 	return c
 }
 
+// UnlimitedTimes expects any number of calls. It panics if a call has been chained with Then, as that call
+// would never match.
 func (c *Call) UnlimitedTimes() *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.next != nil {
+		panic("mock: a call chained with Then cannot expect unlimited calls")
+	}
+
 	c.expectedCalls = UnlimitedCalls
 	return c
 }
 
+// CapturedCalls returns a snapshot of the calls which have matched this expectation.
+func (c *Call) CapturedCalls() []CallRecord {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]CallRecord{}, c.capturedCalls...)
+}
+
+// WithPayload restricts the expectation to frames with exactly this payload.
+func (c *Call) WithPayload(payload []byte) *Call {
+	return c.MatchPayload(func(p []byte) bool {
+		return bytes.Equal(payload, p)
+	})
+}
+
+// MatchPayload restricts the expectation to frames whose payload the matcher accepts.
+func (c *Call) MatchPayload(matcher func([]byte) bool) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.matchers = append(c.matchers, func(f Frame) bool {
+		return matcher(f.Payload)
+	})
+	return c
+}
+
+// MatchMessage restricts the expectation to frames which decode, using the type the library holds for the
+// frame, into a message of the same type as v with the same fields. Exported fields left as zero values in v
+// are not compared, so only the fields of interest need be provided; use MatchMessageExactly to match a zero
+// value such as a success status. Unexported fields are never compared.
+func (c *Call) MatchMessage(ml *library.Library, v interface{}) *Call {
+	return c.matchMessage(ml, v, false)
+}
+
+// MatchMessageExactly behaves as MatchMessage, but compares every exported field of v including those
+// left as zero values.
+func (c *Call) MatchMessageExactly(ml *library.Library, v interface{}) *Call {
+	return c.matchMessage(ml, v, true)
+}
+
+func (c *Call) matchMessage(ml *library.Library, v interface{}, exact bool) *Call {
+	expected := reflect.Indirect(reflect.ValueOf(v))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.matchers = append(c.matchers, func(f Frame) bool {
+		t, found := ml.GetByIdentifier(f.MessageType, f.Subsystem, f.CommandID)
+		if !found || t != expected.Type() {
+			return false
+		}
+
+		actual := reflect.New(t)
+		if err := bytecodec.Unmarshal(f.Payload, actual.Interface()); err != nil {
+			return false
+		}
+
+		return fieldsMatch(expected, actual.Elem(), exact)
+	})
+	return c
+}
+
+func fieldsMatch(expected reflect.Value, actual reflect.Value, exact bool) bool {
+	if expected.Kind() != reflect.Struct {
+		return reflect.DeepEqual(expected.Interface(), actual.Interface())
+	}
+
+	for i := 0; i < expected.NumField(); i++ {
+		if expected.Type().Field(i).PkgPath != "" {
+			continue
+		}
+
+		field := expected.Field(i)
+
+		if !exact && reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			continue
+		}
+
+		if !reflect.DeepEqual(field.Interface(), actual.Field(i).Interface()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Call) matches(f Frame) bool {
+	if c.exhausted() || (c.previous != nil && !c.previous.exhausted()) {
+		return false
+	}
+
+	if (c.mT != f.MessageType && c.mT != AnyType) ||
+		(c.s != f.Subsystem && c.s != AnySubsystem) ||
+		(c.c != f.CommandID && c.c != AnyCommand) {
+		return false
+	}
+
+	for _, matcher := range c.matchers {
+		if !matcher(f) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Frames returns a snapshot of the frames which have matched this expectation.
 func (c *Call) Frames() []Frame {
-	return []Frame{}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	frames := make([]Frame, len(c.capturedCalls))
+
+	for i, cr := range c.capturedCalls {
+		frames[i] = cr.Frame
+	}
+
+	return frames
 }
 
-func NewMockAdapter() *MockAdapter {
+func NewMockAdapter(opts ...MockOption) *MockAdapter {
 	m := &MockAdapter{
 		sequencer:      new(int64),
-		ReceivedFrames: []Frame{},
+		mutex:          &sync.Mutex{},
+		receivedFrames: []Frame{},
 
 		incomingEnd: make(chan bool, 1),
 
-		Calls:           []*Call{},
-		UnexpectedCalls: []CallRecord{},
+		calls:           []*Call{},
+		unexpectedCalls: []CallRecord{},
+		matched:         make(chan struct{}),
 
-		outgoingFrames: make(chan Frame, 50),
+		outgoingFrames: make(chan outgoing, 50),
 		outgoingEnd:    make(chan bool, 1),
+
+		responses: make(chan pendingResponse, pendingResponses),
+
+		faults: newFaultInjector(),
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
 
 	*m.sequencer = 0
@@ -110,14 +369,27 @@ func NewMockAdapter() *MockAdapter {
 func (m *MockAdapter) Read(p []byte) (n int, err error) {
 	if m.outgoingBuffer == nil {
 		select {
-		case f := <-m.outgoingFrames:
-			data := f.Marshall()
-			m.outgoingBuffer = bytes.NewBuffer(data)
+		case o := <-m.outgoingFrames:
+			m.mutex.Lock()
+			c := m.faults.prepare(o)
+			stall := m.faults.stall
+			m.mutex.Unlock()
+
+			if c.stall {
+				time.Sleep(stall)
+			}
+
+			m.outgoingBuffer = bytes.NewBuffer(c.data)
+			m.outgoingSplit = c.split
 		case <-m.outgoingEnd:
 			return 0, io.EOF
 		}
 	}
 
+	if m.outgoingSplit && len(p) > 1 {
+		p = p[:1]
+	}
+
 	actualRead, err := m.outgoingBuffer.Read(p)
 
 	if m.outgoingBuffer.Len() == 0 {
@@ -138,53 +410,197 @@ const (
 )
 
 func (m *MockAdapter) On(mT MessageType, s Subsystem, c uint8) *Call {
-	call := &Call{
+	call := m.newCall(mT, s, c)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.calls = append(m.calls, call)
+
+	return call
+}
+
+func (m *MockAdapter) newCall(mT MessageType, s Subsystem, c uint8) *Call {
+	return &Call{
+		mutex:         m.mutex,
+		adapter:       m,
 		mT:            mT,
 		s:             s,
 		c:             c,
-		CapturedCalls: []CallRecord{},
+		capturedCalls: []CallRecord{},
 		returnFrames:  []Frame{},
 		expectedCalls: 1,
 		actualCalls:   0,
 	}
+}
 
-	m.Calls = append(m.Calls, call)
+// ReceivedFrames returns a snapshot of every frame written to the mock, in the order received.
+func (m *MockAdapter) ReceivedFrames() []Frame {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-	return call
+	return append([]Frame{}, m.receivedFrames...)
+}
+
+// UnexpectedCalls returns a snapshot of the frames which matched no expectation.
+func (m *MockAdapter) UnexpectedCalls() []CallRecord {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]CallRecord{}, m.unexpectedCalls...)
 }
 
 func (m *MockAdapter) AssertCalls(t *testing.T) {
-	for _, call := range m.Calls {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, call := range m.calls {
 		if call.expectedCalls != call.actualCalls && call.expectedCalls != UnlimitedCalls {
 			t.Logf("call count mismatch (mT: %v s: %v c: %v): expected(%d) != actual(%d)", call.mT, call.s, call.c, call.expectedCalls, call.actualCalls)
 			t.Fail()
 		}
 	}
 
-	if len(m.UnexpectedCalls) > 0 {
-		t.Logf("unexpected calls (%d) to mock", len(m.UnexpectedCalls))
+	if len(m.unexpectedCalls) > 0 {
+		t.Logf("unexpected calls (%d) to mock", len(m.unexpectedCalls))
 
-		for _, call := range m.UnexpectedCalls {
+		for _, call := range m.unexpectedCalls {
 			t.Logf("unexpected call: (s: %v mT: %v s: %v c: %v)", call.when, call.Frame.MessageType, call.Frame.Subsystem, call.Frame.CommandID)
 		}
 
 		t.Fail()
 	}
+
+	for _, order := range m.orders {
+		for i := 1; i < len(order); i++ {
+			previous, next := order[i-1], order[i]
+
+			if len(previous.capturedCalls) == 0 || len(next.capturedCalls) == 0 {
+				continue
+			}
+
+			last := previous.capturedCalls[len(previous.capturedCalls)-1]
+
+			if !last.Before(next.capturedCalls[0]) {
+				t.Logf("call order mismatch: (mT: %v s: %v c: %v) was called after (mT: %v s: %v c: %v)", previous.mT, previous.s, previous.c, next.mT, next.s, next.c)
+				t.Fail()
+			}
+		}
+	}
 }
 
-func (m *MockAdapter) InjectOutgoing(f Frame) {
-	m.outgoingFrames <- f
+// InOrder requires that every frame matching each call arrives before any frame matching the next, the
+// order is checked by AssertCalls.
+func (m *MockAdapter) InOrder(calls ...*Call) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.orders = append(m.orders, calls)
+}
+
+// WaitForCalls blocks until every expectation has received its expected calls, or the context is done.
+func (m *MockAdapter) WaitForCalls(ctx context.Context) error {
+	for {
+		m.mutex.Lock()
+		satisfied := m.satisfied()
+		matched := m.matched
+		m.mutex.Unlock()
+
+		if satisfied {
+			return nil
+		}
+
+		select {
+		case <-matched:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AssertCallsEventually waits up to timeout for every expectation to be satisfied, and then asserts calls.
+func (m *MockAdapter) AssertCallsEventually(t *testing.T, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := m.WaitForCalls(ctx); err != nil {
+		t.Logf("expectations not satisfied within %v", timeout)
+	}
+
+	m.AssertCalls(t)
+}
+
+// WaitForFrames blocks until at least n frames have been received and matched, or the context is done.
+func (m *MockAdapter) WaitForFrames(ctx context.Context, n int) error {
+	for {
+		m.mutex.Lock()
+		received := len(m.receivedFrames)
+		matched := m.matched
+		m.mutex.Unlock()
+
+		if received >= n {
+			return nil
+		}
+
+		select {
+		case <-matched:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AssertNoFramesWithin asserts that no frame has been written to the mock by the end of d, for checks that
+// the code under test sent nothing. It waits for the whole of d unless a frame arrives, and then asserts
+// calls.
+func (m *MockAdapter) AssertNoFramesWithin(t *testing.T, d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	if err := m.WaitForFrames(ctx, 1); err == nil {
+		t.Errorf("frame received within %v", d)
+	}
+
+	m.AssertCalls(t)
+}
+
+func (m *MockAdapter) satisfied() bool {
+	for _, call := range m.calls {
+		if call.expectedCalls != UnlimitedCalls && call.actualCalls < call.expectedCalls {
+			return false
+		}
+	}
+
+	return true
+}
+
+// InjectOutgoing queues a frame to be read from the mock, with any faults to apply to it.
+func (m *MockAdapter) InjectOutgoing(f Frame, faults ...Fault) {
+	m.outgoingFrames <- outgoing{frame: f, faults: faults}
 }
 
 func (m *MockAdapter) handleIncoming() {
+	defer close(m.responses)
+
 	for {
 		frame, err := Read(m.incomingReader)
 		if err != nil {
 			return
 		}
 
-		m.ReceivedFrames = append(m.ReceivedFrames, frame)
-		go m.matchCalls(frame)
+		var immediate []response
+
+		for _, r := range m.matchCalls(frame) {
+			if r.delay > 0 {
+				go m.respond(frame, []response{r})
+			} else {
+				immediate = append(immediate, r)
+			}
+		}
+
+		if len(immediate) > 0 {
+			m.responses <- pendingResponse{frame: frame, responses: immediate}
+		}
 
 		select {
 		case <-m.incomingEnd:
@@ -194,37 +610,102 @@ func (m *MockAdapter) handleIncoming() {
 	}
 }
 
-func (m *MockAdapter) matchCalls(frame Frame) {
+// matchCalls records the frame against every expectation it matches, frames are matched in the order
+// received so that call records are sequenced correctly. It returns the responses to send.
+func (m *MockAdapter) matchCalls(frame Frame) []response {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.receivedFrames = append(m.receivedFrames, frame)
+
 	found := false
 	cr := CallRecord{
 		when:  atomic.AddInt64(m.sequencer, 1),
 		Frame: frame,
 	}
 
-	for _, call := range m.Calls {
-		if (call.mT == frame.MessageType || call.mT == AnyType) &&
-			(call.s == frame.Subsystem || call.s == AnySubsystem) &&
-			(call.c == frame.CommandID || call.c == AnyCommand) {
+	var matched []*Call
 
-			found = true
+	for _, call := range m.calls {
+		if call.matches(frame) {
+			matched = append(matched, call)
+		}
+	}
 
-			if len(call.returnFrames) > 0 {
-				i := call.actualCalls % len(call.returnFrames)
-				m.outgoingFrames <- call.returnFrames[i]
-			}
+	var responses []response
 
-			call.CapturedCalls = append(call.CapturedCalls, cr)
-			call.actualCalls += 1
+	for _, call := range matched {
+		found = true
+
+		r := response{delay: call.delay, responder: call.responder, faults: call.faults}
+
+		if len(call.returnFrames) > 0 {
+			i := call.actualCalls % len(call.returnFrames)
+			r.frames = []Frame{call.returnFrames[i]}
 		}
+
+		responses = append(responses, r)
+
+		call.capturedCalls = append(call.capturedCalls, cr)
+		call.actualCalls += 1
 	}
 
 	if !found {
-		m.UnexpectedCalls = append(m.UnexpectedCalls, cr)
+		m.unexpectedCalls = append(m.unexpectedCalls, cr)
+	}
+
+	close(m.matched)
+	m.matched = make(chan struct{})
+
+	return responses
+}
+
+// handleResponding sends undelayed responses in the order their frames were received.
+func (m *MockAdapter) handleResponding() {
+	for p := range m.responses {
+		m.respond(p.frame, p.responses)
 	}
 }
 
+// respond sends responses to a frame, delayed responses are sent from their own goroutine so that they do
+// not block frames being received or answered.
+func (m *MockAdapter) respond(frame Frame, responses []response) {
+	for _, r := range responses {
+		if r.delay > 0 {
+			time.Sleep(r.delay)
+		}
+
+		frames := r.frames
+
+		if r.responder != nil {
+			frames = r.responder(frame)
+		}
+
+		for _, f := range frames {
+			m.outgoingFrames <- outgoing{frame: f, faults: r.faults}
+		}
+	}
+}
+
+// pendingResponses is the number of frames whose undelayed responses may wait to be sent before frames
+// stop being received.
+const pendingResponses = 1024
+
+type pendingResponse struct {
+	frame     Frame
+	responses []response
+}
+
+type response struct {
+	delay     time.Duration
+	frames    []Frame
+	responder func(Frame) []Frame
+	faults    []Fault
+}
+
 func (m *MockAdapter) start() {
 	go m.handleIncoming()
+	go m.handleResponding()
 }
 
 func (m *MockAdapter) Stop() {
@@ -1,9 +1,12 @@
 package testing
 
 import (
+	"context"
 	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -21,14 +24,21 @@ func TestMockAdapter_ReceivingFrames(t *testing.T) {
 		err = Write(m, expectedFrame)
 		assert.NoError(t, err)
 
-		time.Sleep(10 * time.Millisecond)
+		waitForFrames(t, m, 2)
 
-		assert.Equal(t, 2, len(m.ReceivedFrames))
-		assert.Equal(t, expectedFrame, m.ReceivedFrames[0])
-		assert.Equal(t, expectedFrame, m.ReceivedFrames[1])
+		assert.Equal(t, 2, len(m.ReceivedFrames()))
+		assert.Equal(t, expectedFrame, m.ReceivedFrames()[0])
+		assert.Equal(t, expectedFrame, m.ReceivedFrames()[1])
 	})
 }
 
+func waitForFrames(t *testing.T, m *MockAdapter, n int) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, m.WaitForFrames(ctx, n))
+}
+
 func TestMockAdapter(t *testing.T) {
 	t.Run("single mocked response return their correct Frame", func(t *testing.T) {
 		m := NewMockAdapter()
@@ -60,11 +70,9 @@ func TestMockAdapter(t *testing.T) {
 		err := Write(m, frame)
 		assert.NoError(t, err)
 
+		waitForFrames(t, m, 1)
 		m.Stop()
 
-		// Force stop to ensure the Read results in an EOF
-		time.Sleep(20 * time.Millisecond)
-
 		_, err = Read(m)
 		assert.Error(t, err)
 		assert.Equal(t, io.EOF, err)
@@ -233,23 +241,23 @@ func TestMockAdapter(t *testing.T) {
 		err = Write(m, frame)
 		assert.NoError(t, err)
 
-		time.Sleep(50 * time.Millisecond)
+		waitForFrames(t, m, 2)
 
-		assert.Equal(t, 2, len(c.CapturedCalls))
+		assert.Equal(t, 2, len(c.CapturedCalls()))
 
-		assert.Equal(t, frame, c.CapturedCalls[0].Frame)
-		assert.Equal(t, frame, c.CapturedCalls[1].Frame)
+		assert.Equal(t, frame, c.CapturedCalls()[0].Frame)
+		assert.Equal(t, frame, c.CapturedCalls()[1].Frame)
 
-		assert.True(t, c.CapturedCalls[0].Before(c.CapturedCalls[1]))
+		assert.True(t, c.CapturedCalls()[0].Before(c.CapturedCalls()[1]))
 
 		internalT := new(testing.T)
-		c.CapturedCalls[0].AssertBefore(internalT, c.CapturedCalls[1])
+		c.CapturedCalls()[0].AssertBefore(internalT, c.CapturedCalls()[1])
 		assert.False(t, internalT.Failed())
 
-		assert.True(t, c.CapturedCalls[1].After(c.CapturedCalls[0]))
+		assert.True(t, c.CapturedCalls()[1].After(c.CapturedCalls()[0]))
 
 		internalT = new(testing.T)
-		c.CapturedCalls[1].AssertAfter(internalT, c.CapturedCalls[0])
+		c.CapturedCalls()[1].AssertAfter(internalT, c.CapturedCalls()[0])
 		assert.False(t, internalT.Failed())
 	})
 
@@ -275,13 +283,378 @@ func TestMockAdapter(t *testing.T) {
 		err := Write(m, frame)
 		assert.NoError(t, err)
 
-		time.Sleep(10 * time.Millisecond)
+		waitForFrames(t, m, 1)
 
-		assert.Equal(t, 1, len(m.UnexpectedCalls))
-		assert.Equal(t, frame, m.UnexpectedCalls[0].Frame)
+		assert.Equal(t, 1, len(m.UnexpectedCalls()))
+		assert.Equal(t, frame, m.UnexpectedCalls()[0].Frame)
 
 		internalT := new(testing.T)
 		m.AssertCalls(internalT)
 		assert.True(t, internalT.Failed())
 	})
+	t.Run("recorded calls can be read while frames are being matched", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c := m.On(AREQ, ZDO, 0xf0).UnlimitedTimes()
+		frame := Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0xf0, Payload: []byte{0x01}}
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			for i := 0; i < 20; i++ {
+				_ = Write(m, frame)
+			}
+		}()
+
+		for i := 0; i < 20; i++ {
+			_ = m.ReceivedFrames()
+			_ = c.CapturedCalls()
+		}
+
+		<-done
+		waitForFrames(t, m, 20)
+
+		captured := c.CapturedCalls()
+		captured[0].Frame.CommandID = 0x00
+
+		assert.Equal(t, 20, len(m.ReceivedFrames()))
+		assert.Equal(t, 20, len(c.CapturedCalls()))
+		assert.Equal(t, uint8(0xf0), c.CapturedCalls()[0].Frame.CommandID)
+		m.AssertCalls(t)
+	})
+}
+
+func TestMockAdapter_Matching(t *testing.T) {
+	frame := Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x34, 0x12, 0x01, 0x06, 0x00}}
+
+	type DataRequest struct {
+		DestinationAddress  uint16
+		DestinationEndpoint uint8
+		ClusterID           uint16
+	}
+
+	ml := library.NewLibrary()
+	ml.Add(AREQ, AF, 0x01, DataRequest{})
+
+	t.Run("expectations match on exact payloads and capture the frames", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c := m.On(AREQ, AF, 0x01).WithPayload(frame.Payload)
+
+		_ = Write(m, frame)
+		m.AssertCallsEventually(t, time.Second)
+
+		assert.Equal(t, []Frame{frame}, c.Frames())
+	})
+
+	t.Run("frames with other payloads are unexpected", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c := m.On(AREQ, AF, 0x01).WithPayload([]byte{0x00}).Times(0)
+
+		_ = Write(m, frame)
+		waitForFrames(t, m, 1)
+
+		assert.Empty(t, c.Frames())
+		assert.Equal(t, 1, len(m.UnexpectedCalls()))
+	})
+
+	t.Run("payload matchers select between expectations", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		first := m.On(AREQ, AF, 0x01).MatchPayload(func(p []byte) bool { return p[0] == 0x34 })
+		second := m.On(AREQ, AF, 0x01).MatchPayload(func(p []byte) bool { return p[0] == 0x35 }).Times(0)
+
+		_ = Write(m, frame)
+		m.AssertCallsEventually(t, time.Second)
+
+		assert.Len(t, first.Frames(), 1)
+		assert.Empty(t, second.Frames())
+	})
+
+	t.Run("message matchers compare only the provided fields", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		matching := m.On(AREQ, AF, 0x01).MatchMessage(ml, DataRequest{DestinationEndpoint: 0x01, ClusterID: 0x0006})
+		wrongCluster := m.On(AREQ, AF, 0x01).MatchMessage(ml, &DataRequest{DestinationEndpoint: 0x01, ClusterID: 0x0008}).Times(0)
+
+		_ = Write(m, frame)
+		m.AssertCallsEventually(t, time.Second)
+
+		assert.Len(t, matching.Frames(), 1)
+		assert.Empty(t, wrongCluster.Frames())
+	})
+
+	t.Run("asserting no frames passes if nothing is written", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.AssertNoFramesWithin(t, 10*time.Millisecond)
+	})
+
+	t.Run("asserting no frames fails if a frame is written", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(AREQ, AF, 0x01).UnlimitedTimes()
+		_ = Write(m, frame)
+
+		internalT := new(testing.T)
+		m.AssertNoFramesWithin(internalT, time.Second)
+		assert.True(t, internalT.Failed())
+	})
+
+	t.Run("exact message matchers compare zero valued fields", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		matching := m.On(AREQ, AF, 0x01).MatchMessageExactly(ml, DataRequest{DestinationAddress: 0x1234, DestinationEndpoint: 0x01, ClusterID: 0x0006})
+		zeroAddress := m.On(AREQ, AF, 0x01).MatchMessageExactly(ml, DataRequest{DestinationEndpoint: 0x01, ClusterID: 0x0006}).Times(0)
+
+		_ = Write(m, frame)
+		m.AssertCallsEventually(t, time.Second)
+
+		assert.Len(t, matching.Frames(), 1)
+		assert.Empty(t, zeroAddress.Frames())
+	})
+
+	t.Run("message matchers ignore unexported fields", func(t *testing.T) {
+		type Unexported struct {
+			Value  uint8
+			hidden uint8
+		}
+
+		assert.True(t, fieldsMatch(reflect.ValueOf(Unexported{Value: 1, hidden: 2}), reflect.ValueOf(Unexported{Value: 1}), true))
+		assert.False(t, fieldsMatch(reflect.ValueOf(Unexported{Value: 0}), reflect.ValueOf(Unexported{Value: 1}), true))
+	})
+
+	t.Run("message matchers do not match frames of another type", func(t *testing.T) {
+		type Other struct {
+			Value uint8
+		}
+
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c := m.On(AREQ, AF, 0x01).MatchMessage(ml, Other{}).Times(0)
+
+		_ = Write(m, frame)
+		waitForFrames(t, m, 1)
+
+		assert.Empty(t, c.Frames())
+	})
+}
+
+func TestMockAdapter_Responding(t *testing.T) {
+	request := Frame{MessageType: SREQ, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x2a}}
+
+	t.Run("responders build responses from the request", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, AF, 0x01).RespondWith(func(req Frame) []Frame {
+			return []Frame{{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: req.Payload}}
+		})
+
+		_ = Write(m, request)
+
+		frame, err := Read(m)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x2a}, frame.Payload)
+		m.AssertCalls(t)
+	})
+
+	t.Run("responses can be delayed", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, AF, 0x01).Return(Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01}).After(50 * time.Millisecond)
+
+		start := time.Now()
+		_ = Write(m, request)
+
+		_, err := Read(m)
+
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	})
+
+	t.Run("synchronous responses are followed by asynchronous callbacks", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		srsp := Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}}
+		areq := Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x80, Payload: []byte{0x00, 0x2a}}
+
+		m.On(SREQ, AF, 0x01).ReturnThenAsync(srsp, areq)
+
+		_ = Write(m, request)
+
+		first, _ := Read(m)
+		second, _ := Read(m)
+
+		assert.Equal(t, srsp, first)
+		assert.Equal(t, areq, second)
+	})
+
+	t.Run("chained calls answer successive frames differently", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		failure := Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x01}}
+		success := Frame{MessageType: SRSP, Subsystem: AF, CommandID: 0x01, Payload: []byte{0x00}}
+
+		first := m.On(SREQ, AF, 0x01).Return(failure).Once()
+		second := first.Then().Return(success).Times(2)
+
+		var responses [][]byte
+
+		for i := 0; i < 3; i++ {
+			_ = Write(m, request)
+
+			frame, err := Read(m)
+			assert.NoError(t, err)
+
+			responses = append(responses, frame.Payload)
+		}
+
+		assert.Equal(t, [][]byte{{0x01}, {0x00}, {0x00}}, responses)
+		assert.Len(t, first.Frames(), 1)
+		assert.Len(t, second.Frames(), 2)
+		m.AssertCalls(t)
+	})
+
+	t.Run("chaining after unlimited calls panics", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		assert.Panics(t, func() {
+			m.On(SREQ, AF, 0x01).UnlimitedTimes().Then()
+		})
+
+		assert.Panics(t, func() {
+			c := m.On(SREQ, AF, 0x02)
+			c.Then()
+			c.UnlimitedTimes()
+		})
+	})
+
+	t.Run("responses are sent in the order frames were received", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, AF, AnyCommand).RespondWith(func(req Frame) []Frame {
+			return []Frame{{MessageType: SRSP, Subsystem: AF, CommandID: req.CommandID}}
+		}).UnlimitedTimes()
+
+		for i := 0; i < 20; i++ {
+			_ = Write(m, Frame{MessageType: SREQ, Subsystem: AF, CommandID: uint8(i)})
+		}
+
+		for i := 0; i < 20; i++ {
+			frame, err := Read(m)
+			assert.NoError(t, err)
+			assert.Equal(t, uint8(i), frame.CommandID)
+		}
+	})
+
+	t.Run("frames beyond a chain are unexpected", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, AF, 0x01).Once().Then().Once()
+
+		for i := 0; i < 3; i++ {
+			_ = Write(m, request)
+		}
+
+		waitForFrames(t, m, 3)
+
+		assert.Len(t, m.UnexpectedCalls(), 1)
+	})
+}
+
+func TestMockAdapter_Ordering(t *testing.T) {
+	first := Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x01}
+	second := Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x02}
+
+	t.Run("calls in the expected order pass", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c1 := m.On(AREQ, SYS, 0x01)
+		c2 := m.On(AREQ, SYS, 0x02)
+		m.InOrder(c1, c2)
+
+		_ = Write(m, first)
+		_ = Write(m, second)
+
+		m.AssertCallsEventually(t, time.Second)
+	})
+
+	t.Run("calls out of order fail", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		c1 := m.On(AREQ, SYS, 0x01)
+		c2 := m.On(AREQ, SYS, 0x02)
+		m.InOrder(c1, c2)
+
+		_ = Write(m, second)
+		_ = Write(m, first)
+
+		internalT := new(testing.T)
+		m.AssertCallsEventually(internalT, time.Second)
+		assert.True(t, internalT.Failed())
+	})
+}
+
+func TestMockAdapter_Waiting(t *testing.T) {
+	frame := Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x01}
+
+	t.Run("waiting returns once every expectation is satisfied", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(AREQ, SYS, 0x01).Times(2)
+
+		go func() {
+			_ = Write(m, frame)
+			_ = Write(m, frame)
+		}()
+
+		assert.NoError(t, m.WaitForCalls(context.Background()))
+		m.AssertCalls(t)
+	})
+
+	t.Run("waiting returns the context error if expectations are not satisfied", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(AREQ, SYS, 0x01)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Equal(t, context.DeadlineExceeded, m.WaitForCalls(ctx))
+	})
+
+	t.Run("asserting eventually fails if expectations are not satisfied in time", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		m.On(AREQ, SYS, 0x01)
+
+		internalT := new(testing.T)
+		m.AssertCallsEventually(internalT, 10*time.Millisecond)
+		assert.True(t, internalT.Failed())
+	})
 }
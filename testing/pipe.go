@@ -0,0 +1,231 @@
+package testing
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// pendingWrites is the number of writes which may be waiting for delivery before Write blocks.
+const pendingWrites = 1024
+
+// PipeOption configures both directions of a Pipe.
+type PipeOption func(*pipeConfig)
+
+type pipeConfig struct {
+	latency        time.Duration
+	bytesPerSecond int
+	seed           int64
+	rate           float64
+	faults         []Fault
+	stall          time.Duration
+}
+
+// WithLatency delays each write by d before it can be read from the other end.
+func WithLatency(d time.Duration) PipeOption {
+	return func(c *pipeConfig) {
+		c.latency = d
+	}
+}
+
+// WithBandwidth limits each direction to bytesPerSecond, writes are delivered once they would have been
+// transmitted. A serial line at 115200 baud carries 11520 bytes per second.
+func WithBandwidth(bytesPerSecond int) PipeOption {
+	return func(c *pipeConfig) {
+		c.bytesPerSecond = bytesPerSecond
+	}
+}
+
+// WithPipeFaults applies one of faults, chosen at random, to each write with probability rate. Each
+// direction has its own source of randomness derived from seed, so results are reproducible.
+func WithPipeFaults(seed int64, rate float64, faults ...Fault) PipeOption {
+	return func(c *pipeConfig) {
+		c.seed = seed
+		c.rate = rate
+		c.faults = faults
+	}
+}
+
+// WithPipeStallDuration sets how long FaultStall delays a write, the default is 100ms.
+func WithPipeStallDuration(d time.Duration) PipeOption {
+	return func(c *pipeConfig) {
+		c.stall = d
+	}
+}
+
+// Pipe returns the two ends of an in-memory byte stream, data written to one end is read from the other.
+// Unlike io.Pipe a write does not wait for its data to be read, it is delivered in order after any latency
+// and transmission time, so that a Broker and an emulator can be connected as if by a serial line. Faults
+// are applied to the bytes of each write, unpi.Write writes a whole frame at once.
+func Pipe(opts ...PipeOption) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	config := pipeConfig{seed: defaultFaultSeed, stall: defaultStallDuration}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	aToB := newLink(config, config.seed)
+	bToA := newLink(config, config.seed+1)
+
+	return &pipeEnd{in: bToA, out: aToB}, &pipeEnd{in: aToB, out: bToA}
+}
+
+type pipeEnd struct {
+	in  *link
+	out *link
+}
+
+func (e *pipeEnd) Read(p []byte) (int, error) {
+	return e.in.reader.Read(p)
+}
+
+func (e *pipeEnd) Write(p []byte) (int, error) {
+	return e.out.write(p)
+}
+
+// Close stops both directions, data already written is still delivered to the other end before it reads
+// io.EOF.
+func (e *pipeEnd) Close() error {
+	e.out.close()
+	e.in.close()
+
+	return e.in.reader.Close()
+}
+
+// link carries data in one direction of a Pipe, delivering each write from its own goroutine.
+type link struct {
+	config pipeConfig
+
+	// mutex guards the fault injector and the time the line is next free, and keeps writes in order.
+	mutex    *sync.Mutex
+	faults   faultInjector
+	lineFree time.Time
+
+	pending   chan delivery
+	closed    chan struct{}
+	closeOnce *sync.Once
+
+	reader *io.PipeReader
+	writer *io.PipeWriter
+}
+
+// delivery is the data of a write, with the time it may be read.
+type delivery struct {
+	chunk
+	at time.Time
+}
+
+func newLink(config pipeConfig, seed int64) *link {
+	reader, writer := io.Pipe()
+
+	l := &link{
+		config: config,
+
+		mutex: &sync.Mutex{},
+		faults: faultInjector{
+			random: rand.New(rand.NewSource(seed)),
+			rate:   config.rate,
+			kinds:  config.faults,
+			stall:  config.stall,
+		},
+
+		pending:   make(chan delivery, pendingWrites),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+
+		reader: reader,
+		writer: writer,
+	}
+
+	go l.deliver()
+
+	return l
+}
+
+func (l *link) write(p []byte) (int, error) {
+	select {
+	case <-l.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	c := l.faults.prepareData(append([]byte{}, p...), nil)
+
+	start := time.Now()
+	if l.lineFree.After(start) {
+		start = l.lineFree
+	}
+
+	l.lineFree = start
+	if l.config.bytesPerSecond > 0 {
+		l.lineFree = start.Add(time.Duration(len(c.data)) * time.Second / time.Duration(l.config.bytesPerSecond))
+	}
+
+	select {
+	case l.pending <- delivery{chunk: c, at: l.lineFree.Add(l.config.latency)}:
+		return len(p), nil
+	case <-l.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (l *link) close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+}
+
+// deliver writes each delivery to the reading end once it is due, once closed the remaining deliveries are
+// written before the reading end is closed.
+func (l *link) deliver() {
+	defer l.writer.Close()
+
+	for {
+		select {
+		case d := <-l.pending:
+			if err := l.send(d); err != nil {
+				return
+			}
+		case <-l.closed:
+			for {
+				select {
+				case d := <-l.pending:
+					if err := l.send(d); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *link) send(d delivery) error {
+	time.Sleep(time.Until(d.at))
+
+	if d.stall {
+		time.Sleep(l.config.stall)
+	}
+
+	if !d.split {
+		_, err := l.writer.Write(d.data)
+		return err
+	}
+
+	for i := range d.data {
+		if _, err := l.writer.Write(d.data[i : i+1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
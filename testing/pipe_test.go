@@ -0,0 +1,128 @@
+package testing
+
+import (
+	"errors"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	frame := Frame{MessageType: AREQ, Subsystem: AF, CommandID: 0x80, Payload: []byte{0x01, 0x02, 0x03, 0x04}}
+
+	t.Run("frames written to one end are read from the other", func(t *testing.T) {
+		a, b := Pipe()
+		defer a.Close()
+		defer b.Close()
+
+		assert.NoError(t, Write(a, frame))
+		actual, err := Read(b)
+		assert.NoError(t, err)
+		assert.Equal(t, frame, actual)
+
+		assert.NoError(t, Write(b, frame))
+		actual, err = Read(a)
+		assert.NoError(t, err)
+		assert.Equal(t, frame, actual)
+	})
+
+	t.Run("writes do not wait for the data to be read", func(t *testing.T) {
+		a, b := Pipe()
+		defer a.Close()
+		defer b.Close()
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, Write(a, Frame{MessageType: AREQ, Subsystem: AF, CommandID: uint8(i)}))
+		}
+
+		for i := 0; i < 10; i++ {
+			actual, err := Read(b)
+			assert.NoError(t, err)
+			assert.Equal(t, uint8(i), actual.CommandID)
+		}
+	})
+
+	t.Run("writes are delayed by the latency", func(t *testing.T) {
+		a, b := Pipe(WithLatency(50 * time.Millisecond))
+		defer a.Close()
+		defer b.Close()
+
+		start := time.Now()
+		assert.NoError(t, Write(a, frame))
+		assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+		_, err := Read(b)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	})
+
+	t.Run("writes are delivered at the bandwidth of the line", func(t *testing.T) {
+		a, b := Pipe(WithBandwidth(100))
+		defer a.Close()
+		defer b.Close()
+
+		start := time.Now()
+
+		// Each frame is 9 bytes, so five take 450ms to transmit.
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, Write(a, frame))
+		}
+
+		for i := 0; i < 5; i++ {
+			_, err := Read(b)
+			assert.NoError(t, err)
+		}
+
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(450*time.Millisecond))
+	})
+
+	t.Run("faults are applied to writes", func(t *testing.T) {
+		a, b := Pipe(WithPipeFaults(1, 1, FaultCorruptChecksum))
+		defer a.Close()
+		defer b.Close()
+
+		assert.NoError(t, Write(a, frame))
+
+		_, err := Read(b)
+		assert.True(t, errors.Is(err, FrameChecksumFailed))
+	})
+
+	t.Run("split writes are read a byte at a time", func(t *testing.T) {
+		a, b := Pipe(WithPipeFaults(1, 1, FaultSplitReads))
+		defer a.Close()
+		defer b.Close()
+
+		assert.NoError(t, Write(a, frame))
+
+		buffer := make([]byte, 64)
+
+		for i := 0; i < len(frame.Marshall()); i++ {
+			n, err := b.Read(buffer)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+		}
+	})
+
+	t.Run("closing an end delivers written data before the other end reads EOF", func(t *testing.T) {
+		a, b := Pipe(WithLatency(10 * time.Millisecond))
+		defer b.Close()
+
+		assert.NoError(t, Write(a, frame))
+		assert.NoError(t, a.Close())
+
+		actual, err := Read(b)
+		assert.NoError(t, err)
+		assert.Equal(t, frame, actual)
+
+		_, err = b.Read(make([]byte, 1))
+		assert.Equal(t, io.EOF, err)
+
+		_, err = b.Write([]byte{0x00})
+		assert.Equal(t, io.ErrClosedPipe, err)
+
+		_, err = a.Write([]byte{0x00})
+		assert.Equal(t, io.ErrClosedPipe, err)
+	})
+}
@@ -0,0 +1,105 @@
+package testing
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"reflect"
+)
+
+// WithLibrary provides the message library used by Expect, Reply and Emit to resolve identities and encode
+// payloads.
+func WithLibrary(ml *library.Library) MockOption {
+	return func(m *MockAdapter) {
+		m.library = ml
+	}
+}
+
+// Expect adds an expectation for frames of the message v, resolved by the mock's library. Frames must
+// decode to a message with the same non-zero fields as v. It panics if the mock has no library or the
+// message is not in it.
+func (m *MockAdapter) Expect(v interface{}) *Call {
+	identity := m.identity(v)
+
+	c := m.On(identity.MessageType, identity.Subsystem, identity.CommandID).MatchMessage(m.library, v)
+
+	c.mutex.Lock()
+	c.identity = &identity
+	c.mutex.Unlock()
+
+	return c
+}
+
+// Reply responds to each frame matching an expectation made with Expect with the message v. It panics if
+// v is not a valid response to the expected message: an SREQ must be answered by the SRSP of the same
+// subsystem and command, and an AREQ may only be answered by another AREQ.
+func (c *Call) Reply(v interface{}) *Call {
+	c.mutex.Lock()
+	expected := c.identity
+	c.mutex.Unlock()
+
+	if expected == nil {
+		panic("mock: Reply requires an expectation made with Expect")
+	}
+
+	identity := c.adapter.identity(v)
+
+	switch expected.MessageType {
+	case SREQ:
+		if identity.MessageType != SRSP || identity.Subsystem != expected.Subsystem || identity.CommandID != expected.CommandID {
+			panic(fmt.Sprintf("mock: %s must be answered by %s, not %s (%T)", describe(*expected), describe(library.Identity{MessageType: SRSP, Subsystem: expected.Subsystem, CommandID: expected.CommandID}), describe(identity), v))
+		}
+	case AREQ:
+		if identity.MessageType != AREQ {
+			panic(fmt.Sprintf("mock: %s may only be answered by an AREQ, not %s (%T)", describe(*expected), describe(identity), v))
+		}
+	}
+
+	return c.Return(c.adapter.frame(identity, v))
+}
+
+// Emit sends the AREQ message v from the mock, resolved by the mock's library. It panics if v is not an
+// AREQ in the library.
+func (m *MockAdapter) Emit(v interface{}) {
+	identity := m.identity(v)
+
+	if identity.MessageType != AREQ {
+		panic(fmt.Sprintf("mock: only AREQ may be emitted, not %s (%T)", describe(identity), v))
+	}
+
+	m.InjectOutgoing(m.frame(identity, v))
+}
+
+func (m *MockAdapter) identity(v interface{}) library.Identity {
+	if m.library == nil {
+		panic("mock: no library, construct with WithLibrary")
+	}
+
+	identity, found := m.library.GetByObject(v)
+	if !found {
+		panic(fmt.Sprintf("mock: %s is not in the library", reflect.TypeOf(v)))
+	}
+
+	return identity
+}
+
+func (m *MockAdapter) frame(identity library.Identity, v interface{}) Frame {
+	payload, err := bytecodec.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("mock: failed to marshal %T: %v", v, err))
+	}
+
+	return Frame{
+		MessageType: identity.MessageType,
+		Subsystem:   identity.Subsystem,
+		CommandID:   identity.CommandID,
+		Payload:     payload,
+	}
+}
+
+var messageTypeNames = map[MessageType]string{POLL: "POLL", SREQ: "SREQ", AREQ: "AREQ", SRSP: "SRSP"}
+
+func describe(identity library.Identity) string {
+	return fmt.Sprintf("%s 0x%02x/0x%02x", messageTypeNames[identity.MessageType], uint8(identity.Subsystem), identity.CommandID)
+}
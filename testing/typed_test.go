@@ -0,0 +1,130 @@
+package testing
+
+import (
+	"context"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type versionReq struct{}
+
+type versionReply struct {
+	Transport uint8
+	Product   uint8
+}
+
+type resetReq struct {
+	ResetType uint8
+}
+
+type resetInd struct {
+	Reason uint8
+}
+
+type stateChangeInd struct {
+	State uint8
+}
+
+func typedLibrary() *library.Library {
+	ml := library.NewLibrary()
+	ml.Add(SREQ, SYS, 0x02, versionReq{})
+	ml.Add(SRSP, SYS, 0x02, versionReply{})
+	ml.Add(AREQ, SYS, 0x00, resetReq{})
+	ml.Add(AREQ, SYS, 0x80, resetInd{})
+	ml.Add(AREQ, ZDO, 0xc0, stateChangeInd{})
+	return ml
+}
+
+func TestMockAdapter_Typed(t *testing.T) {
+	t.Run("expectations reply with messages encoded by the library", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		m.Expect(&versionReq{}).Reply(&versionReply{Transport: 2, Product: 1})
+
+		_ = Write(m, Frame{MessageType: SREQ, Subsystem: SYS, CommandID: 0x02})
+
+		frame, err := Read(m)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Frame{MessageType: SRSP, Subsystem: SYS, CommandID: 0x02, Payload: []byte{0x02, 0x01}}, frame)
+		m.AssertCallsEventually(t, time.Second)
+	})
+
+	t.Run("expectations match on the fields of the message", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		hard := m.Expect(resetReq{ResetType: 0x01}).Reply(resetInd{Reason: 0x02}).Times(0)
+
+		_ = Write(m, Frame{MessageType: AREQ, Subsystem: SYS, CommandID: 0x00, Payload: []byte{0x00}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.NoError(t, m.WaitForFrames(ctx, 1))
+		assert.Empty(t, hard.Frames())
+		assert.Len(t, m.UnexpectedCalls(), 1)
+	})
+
+	t.Run("expectations made with Times(0) pass if nothing is sent", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		m.Expect(resetReq{ResetType: 0x01}).Reply(resetInd{Reason: 0x02}).Times(0)
+
+		m.AssertNoFramesWithin(t, 10*time.Millisecond)
+	})
+
+	t.Run("messages can be emitted", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		m.Emit(&stateChangeInd{State: 0x09})
+
+		frame, err := Read(m)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: 0xc0, Payload: []byte{0x09}}, frame)
+	})
+
+	t.Run("mismatched pairings panic", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		assert.PanicsWithValue(t, "mock: SREQ 0x01/0x02 must be answered by SRSP 0x01/0x02, not AREQ 0x05/0xc0 (testing.stateChangeInd)", func() {
+			m.Expect(versionReq{}).Reply(stateChangeInd{})
+		})
+
+		assert.Panics(t, func() {
+			m.Expect(resetReq{}).Reply(versionReply{})
+		})
+	})
+
+	t.Run("messages outside the library panic", func(t *testing.T) {
+		m := NewMockAdapter(WithLibrary(typedLibrary()))
+		defer m.Stop()
+
+		type unknown struct{}
+
+		assert.PanicsWithValue(t, "mock: testing.unknown is not in the library", func() {
+			m.Expect(unknown{})
+		})
+
+		assert.Panics(t, func() {
+			m.Emit(versionReply{})
+		})
+	})
+
+	t.Run("typed expectations require a library", func(t *testing.T) {
+		m := NewMockAdapter()
+		defer m.Stop()
+
+		assert.Panics(t, func() {
+			m.Expect(versionReq{})
+		})
+	})
+}
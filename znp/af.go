@@ -0,0 +1,136 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+)
+
+type AfRegister struct {
+	Endpoint          uint8
+	AppProfileID      uint16
+	AppDeviceID       uint16
+	AppDeviceVersion  uint8
+	LatencyReq        uint8
+	AppInClusterList  []uint16 `bcsliceprefix:"8"`
+	AppOutClusterList []uint16 `bcsliceprefix:"8"`
+}
+
+type AfRegisterReply struct {
+	Status Status
+}
+
+type AfDataRequest struct {
+	DestinationAddress  uint16
+	DestinationEndpoint uint8
+	SourceEndpoint      uint8
+	ClusterID           uint16
+	TransactionID       uint8
+	Options             uint8
+	Radius              uint8
+	Data                []byte `bcsliceprefix:"8"`
+}
+
+type AfDataRequestReply struct {
+	Status Status
+}
+
+type AfDataRequestExt struct {
+	DestinationAddressMode uint8
+	DestinationAddress     uint64
+	DestinationEndpoint    uint8
+	DestinationPanID       uint16
+	SourceEndpoint         uint8
+	ClusterID              uint16
+	TransactionID          uint8
+	Options                uint8
+	Radius                 uint8
+	Data                   []byte `bcsliceprefix:"16"`
+}
+
+type AfDataRequestExtReply struct {
+	Status Status
+}
+
+type AfDataRequestSrcRtg struct {
+	DestinationAddress  uint16
+	DestinationEndpoint uint8
+	SourceEndpoint      uint8
+	ClusterID           uint16
+	TransactionID       uint8
+	Options             uint8
+	Radius              uint8
+	RelayList           []uint16 `bcsliceprefix:"8"`
+	Data                []byte   `bcsliceprefix:"8"`
+}
+
+type AfDataRequestSrcRtgReply struct {
+	Status Status
+}
+
+type AfDelete struct {
+	Endpoint uint8
+}
+
+type AfDeleteReply struct {
+	Status Status
+}
+
+type AfDataConfirm struct {
+	Status        Status
+	Endpoint      uint8
+	TransactionID uint8
+}
+
+type AfIncomingMsg struct {
+	GroupID             uint16
+	ClusterID           uint16
+	SourceAddress       uint16
+	SourceEndpoint      uint8
+	DestinationEndpoint uint8
+	WasBroadcast        uint8
+	LinkQuality         uint8
+	SecurityUse         uint8
+	Timestamp           uint32
+	TransactionSequence uint8
+	Data                []byte `bcsliceprefix:"8"`
+}
+
+type AfIncomingMsgExt struct {
+	GroupID             uint16
+	ClusterID           uint16
+	SourceAddressMode   uint8
+	SourceAddress       uint64
+	SourceEndpoint      uint8
+	SourcePanID         uint16
+	DestinationEndpoint uint8
+	WasBroadcast        uint8
+	LinkQuality         uint8
+	SecurityUse         uint8
+	Timestamp           uint32
+	TransactionSequence uint8
+	Data                []byte `bcsliceprefix:"16"`
+}
+
+type AfReflectError struct {
+	Status                 Status
+	Endpoint               uint8
+	TransactionID          uint8
+	DestinationAddressMode uint8
+	DestinationAddress     uint16
+}
+
+var afMessages = []message{
+	{SREQ, AF, 0x00, AfRegister{}, nil},
+	{SRSP, AF, 0x00, AfRegisterReply{}, nil},
+	{SREQ, AF, 0x01, AfDataRequest{}, nil},
+	{SRSP, AF, 0x01, AfDataRequestReply{}, nil},
+	{SREQ, AF, 0x02, AfDataRequestExt{}, nil},
+	{SRSP, AF, 0x02, AfDataRequestExtReply{}, nil},
+	{SREQ, AF, 0x03, AfDataRequestSrcRtg{}, nil},
+	{SRSP, AF, 0x03, AfDataRequestSrcRtgReply{}, nil},
+	{SREQ, AF, 0x04, AfDelete{}, nil},
+	{SRSP, AF, 0x04, AfDeleteReply{}, nil},
+	{AREQ, AF, 0x80, AfDataConfirm{}, nil},
+	{AREQ, AF, 0x81, AfIncomingMsg{}, nil},
+	{AREQ, AF, 0x82, AfIncomingMsgExt{}, nil},
+	{AREQ, AF, 0x83, AfReflectError{}, nil},
+}
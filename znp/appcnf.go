@@ -0,0 +1,94 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+)
+
+// Commissioning modes used by APP_CNF_BDB_START_COMMISSIONING, they may be combined.
+const (
+	CommissioningModeInitialisation uint8 = 0x00
+	CommissioningModeTouchlink      uint8 = 0x01
+	CommissioningModeSteering       uint8 = 0x02
+	CommissioningModeFormation      uint8 = 0x04
+	CommissioningModeFindingBinding uint8 = 0x08
+)
+
+type AppCnfSetAllowRejoinTCPolicy struct {
+	AllowRejoin uint8
+}
+
+type AppCnfSetAllowRejoinTCPolicyReply struct {
+	Status Status
+}
+
+type AppCnfBdbStartCommissioning struct {
+	Mode uint8
+}
+
+type AppCnfBdbStartCommissioningReply struct {
+	Status Status
+}
+
+type AppCnfBdbSetJoinUsesInstallCodeKey struct {
+	UseInstallCodeKey uint8
+}
+
+type AppCnfBdbSetJoinUsesInstallCodeKeyReply struct {
+	Status Status
+}
+
+type AppCnfBdbSetActiveDefaultCentralizedKey struct {
+	UseGlobal   uint8
+	InstallCode [18]byte
+}
+
+type AppCnfBdbSetActiveDefaultCentralizedKeyReply struct {
+	Status Status
+}
+
+type AppCnfBdbSetChannel struct {
+	IsPrimary uint8
+	Channels  uint32
+}
+
+type AppCnfBdbSetChannelReply struct {
+	Status Status
+}
+
+type AppCnfBdbSetTCRequireKeyExchange struct {
+	RequireKeyExchange uint8
+}
+
+type AppCnfBdbSetTCRequireKeyExchangeReply struct {
+	Status Status
+}
+
+type AppCnfBdbZedAttemptRecoverNwk struct{}
+
+type AppCnfBdbZedAttemptRecoverNwkReply struct {
+	Status Status
+}
+
+type AppCnfBdbCommissioningNotification struct {
+	Status                      CommissioningStatus
+	CommissioningMode           uint8
+	RemainingCommissioningModes uint8
+}
+
+var appCnfMessages = []message{
+	{SREQ, APP_CNF, 0x03, AppCnfSetAllowRejoinTCPolicy{}, nil},
+	{SRSP, APP_CNF, 0x03, AppCnfSetAllowRejoinTCPolicyReply{}, nil},
+	{SREQ, APP_CNF, 0x05, AppCnfBdbStartCommissioning{}, nil},
+	{SRSP, APP_CNF, 0x05, AppCnfBdbStartCommissioningReply{}, nil},
+	{SREQ, APP_CNF, 0x06, AppCnfBdbSetJoinUsesInstallCodeKey{}, nil},
+	{SRSP, APP_CNF, 0x06, AppCnfBdbSetJoinUsesInstallCodeKeyReply{}, nil},
+	{SREQ, APP_CNF, 0x07, AppCnfBdbSetActiveDefaultCentralizedKey{}, nil},
+	{SRSP, APP_CNF, 0x07, AppCnfBdbSetActiveDefaultCentralizedKeyReply{}, nil},
+	{SREQ, APP_CNF, 0x08, AppCnfBdbSetChannel{}, nil},
+	{SRSP, APP_CNF, 0x08, AppCnfBdbSetChannelReply{}, nil},
+	{SREQ, APP_CNF, 0x09, AppCnfBdbSetTCRequireKeyExchange{}, nil},
+	{SRSP, APP_CNF, 0x09, AppCnfBdbSetTCRequireKeyExchangeReply{}, nil},
+	{SREQ, APP_CNF, 0x0a, AppCnfBdbZedAttemptRecoverNwk{}, nil},
+	{SRSP, APP_CNF, 0x0a, AppCnfBdbZedAttemptRecoverNwkReply{}, nil},
+	{AREQ, APP_CNF, 0x80, AppCnfBdbCommissioningNotification{}, nil},
+}
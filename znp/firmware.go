@@ -0,0 +1,77 @@
+package znp
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/unpi/library"
+)
+
+// Firmware identifies a Z-Stack release family, the values match the Product field of SYS_VERSION.
+type Firmware uint8
+
+const (
+	ZStack12  Firmware = 0x00
+	ZStack3x0 Firmware = 0x01
+	ZStack30x Firmware = 0x02
+)
+
+func (f Firmware) String() string {
+	switch f {
+	case ZStack12:
+		return "Z-Stack Home 1.2"
+	case ZStack3x0:
+		return "Z-Stack 3.x.0"
+	case ZStack30x:
+		return "Z-Stack 3.0.x"
+	default:
+		return fmt.Sprintf("Unknown Firmware 0x%02x", uint8(f))
+	}
+}
+
+// firmwareMessages are the messages which each firmware adds to the shared messages. Payload layouts of
+// shared commands such as ZDO_STATE_CHANGE_IND, UTIL_GET_DEVICE_INFO and SYS_VERSION do not differ between
+// firmware, Z-Stack 3 only reports additional DeviceState values.
+var firmwareMessages = map[Firmware][][]message{
+	ZStack12:  {},
+	ZStack30x: {sysOSALNVExtMessages, appCnfMessages},
+	ZStack3x0: {sysOSALNVExtMessages, sysNVMessages, appCnfMessages},
+}
+
+// messagesFor returns the messages of a firmware, unknown firmware is treated as the newest firmware.
+func messagesFor(f Firmware) []message {
+	sets, found := firmwareMessages[f]
+	if !found {
+		sets = firmwareMessages[ZStack3x0]
+	}
+
+	all := messages()
+
+	for _, set := range sets {
+		all = append(all, set...)
+	}
+
+	return all
+}
+
+// LibraryFor returns a message library populated with the messages of the specified firmware.
+func LibraryFor(f Firmware) *library.Library {
+	ml := library.NewLibrary()
+	RegisterFor(ml, f)
+	return ml
+}
+
+// RegisterFor adds the messages of the specified firmware to an existing message library.
+func RegisterFor(ml *library.Library, f Firmware) {
+	for _, m := range messagesFor(f) {
+		ml.Add(m.MessageType, m.Subsystem, m.CommandID, m.Value, m.options()...)
+	}
+}
+
+// LibraryForProduct returns a message library for the Product reported by SYS_VERSION.
+func LibraryForProduct(product uint8) *library.Library {
+	return LibraryFor(Firmware(product))
+}
+
+// LibraryForVersion returns a message library for the version reported by SYS_VERSION.
+func LibraryForVersion(v SysVersionRevisionReply) *library.Library {
+	return LibraryForProduct(v.Product)
+}
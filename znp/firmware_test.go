@@ -0,0 +1,98 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestLibraryFor(t *testing.T) {
+	t.Run("every firmware reports a revision in its version reply", func(t *testing.T) {
+		for _, f := range []Firmware{ZStack12, ZStack30x, ZStack3x0} {
+			actualType, found := LibraryFor(f).GetByIdentifier(SRSP, SYS, 0x02)
+			assert.True(t, found)
+			assert.Equal(t, reflect.TypeOf(SysVersionRevisionReply{}), actualType, f.String())
+		}
+	})
+
+	t.Run("Z-Stack 1.2 has no APP_CNF or extended NV messages", func(t *testing.T) {
+		ml := LibraryFor(ZStack12)
+
+		_, found := ml.GetByObject(AppCnfBdbStartCommissioning{})
+		assert.False(t, found)
+
+		_, found = ml.GetByObject(SysOSALNVReadExt{})
+		assert.False(t, found)
+	})
+
+	t.Run("Z-Stack 3.0.x adds APP_CNF and extended OSAL NV messages", func(t *testing.T) {
+		ml := LibraryFor(ZStack30x)
+
+		_, found := ml.GetByObject(AppCnfBdbStartCommissioning{})
+		assert.True(t, found)
+
+		_, found = ml.GetByObject(SysOSALNVReadExt{})
+		assert.True(t, found)
+
+		_, found = ml.GetByObject(SysNVRead{})
+		assert.False(t, found)
+	})
+
+	t.Run("Z-Stack 3.x.0 adds NV driver messages", func(t *testing.T) {
+		ml := LibraryFor(ZStack3x0)
+
+		_, found := ml.GetByObject(SysNVRead{})
+		assert.True(t, found)
+	})
+
+	t.Run("state change and device info layouts are shared by every firmware", func(t *testing.T) {
+		for _, f := range []Firmware{ZStack12, ZStack30x, ZStack3x0} {
+			ml := LibraryFor(f)
+
+			actualType, _ := ml.GetByIdentifier(AREQ, ZDO, 0xc0)
+			assert.Equal(t, reflect.TypeOf(ZdoStateChangeInd{}), actualType, f.String())
+
+			actualType, _ = ml.GetByIdentifier(SRSP, UTIL, 0x00)
+			assert.Equal(t, reflect.TypeOf(UtilGetDeviceInfoReply{}), actualType, f.String())
+		}
+	})
+
+	t.Run("firmware messages only add to the shared messages", func(t *testing.T) {
+		for _, f := range []Firmware{ZStack12, ZStack30x, ZStack3x0} {
+			seen := map[library.Identity]bool{}
+
+			for _, m := range messagesFor(f) {
+				identity := m.identity()
+				assert.False(t, seen[identity], "%s registers %+v twice", f, identity)
+				seen[identity] = true
+			}
+		}
+	})
+
+	t.Run("unknown products are treated as the newest firmware", func(t *testing.T) {
+		ml := LibraryForProduct(0x7f)
+
+		actualType, found := ml.GetByIdentifier(SRSP, SYS, 0x02)
+		assert.True(t, found)
+		assert.Equal(t, reflect.TypeOf(SysVersionRevisionReply{}), actualType)
+	})
+
+	t.Run("libraries are selected by the product of the version", func(t *testing.T) {
+		ml := LibraryForVersion(SysVersionRevisionReply{Product: uint8(ZStack12), MajorRelease: 2, MinorRelease: 6})
+
+		_, found := ml.GetByObject(AppCnfBdbStartCommissioning{})
+		assert.False(t, found)
+
+		ml = LibraryForVersion(SysVersionRevisionReply{Product: uint8(ZStack30x), MajorRelease: 2, MinorRelease: 7})
+
+		_, found = ml.GetByObject(AppCnfBdbStartCommissioning{})
+		assert.True(t, found)
+	})
+
+	t.Run("firmware names", func(t *testing.T) {
+		assert.Equal(t, "Z-Stack Home 1.2", ZStack12.String())
+		assert.Equal(t, "Unknown Firmware 0x7f", Firmware(0x7f).String())
+	})
+}
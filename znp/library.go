@@ -0,0 +1,60 @@
+// Package znp provides message definitions for the Texas Instruments Z-Stack ZNP (Zigbee Network
+// Processor) Monitor and Test API, ready for use with the unpi broker.
+//
+// Definitions are taken from the Z-Stack Monitor and Test API documentation, where a message has a
+// variable length list the length prefix is handled by bytecodec tags.
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"reflect"
+)
+
+type message struct {
+	MessageType MessageType
+	Subsystem   Subsystem
+	CommandID   uint8
+	Value       interface{}
+	Options     []library.Option
+}
+
+// messages returns the messages shared by every supported firmware.
+func messages() []message {
+	var all []message
+
+	all = append(all, sysMessages...)
+	all = append(all, utilMessages...)
+	all = append(all, afMessages...)
+	all = append(all, zdoMessages...)
+	all = append(all, sapiMessages...)
+
+	return all
+}
+
+// Library returns a message library populated with the messages of the newest supported firmware, Z-Stack
+// 3.x.0. Use LibraryFor if the firmware of the adapter is known.
+func Library() *library.Library {
+	return LibraryFor(ZStack3x0)
+}
+
+// Register adds the messages of the newest supported firmware to an existing message library.
+func Register(ml *library.Library) {
+	RegisterFor(ml, ZStack3x0)
+}
+
+// options returns the library options of the message, messages which start with a Status are marked as
+// carrying a leading status.
+func (m message) options() []library.Option {
+	t := reflect.TypeOf(m.Value)
+
+	if t.NumField() > 0 && t.Field(0).Type == reflect.TypeOf(Status(0)) {
+		return append([]library.Option{library.WithLeadingStatus()}, m.Options...)
+	}
+
+	return m.Options
+}
+
+func (m message) identity() library.Identity {
+	return library.Identity{MessageType: m.MessageType, Subsystem: m.Subsystem, CommandID: m.CommandID}
+}
@@ -0,0 +1,185 @@
+package znp
+
+import (
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+// populate fills every field of v with a non zero value, slices are given two elements. Unsigned fields are
+// set to three so that IEEE address mode dependent fields are present.
+func populate(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(3)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			populate(v.Field(i))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			populate(v.Index(i))
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			populate(v.Index(i))
+		}
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	for _, firmware := range []Firmware{ZStack12, ZStack30x, ZStack3x0} {
+		t.Run(fmt.Sprintf("every %v message has a unique identity and type", firmware), func(t *testing.T) {
+			identities := map[library.Identity]bool{}
+			types := map[reflect.Type]bool{}
+
+			for _, m := range messagesFor(firmware) {
+				identity := m.identity()
+				messageType := reflect.TypeOf(m.Value)
+
+				assert.Falsef(t, identities[identity], "duplicate identity %+v", identity)
+				assert.Falsef(t, types[messageType], "duplicate type %v", messageType)
+
+				identities[identity] = true
+				types[messageType] = true
+			}
+		})
+
+		t.Run(fmt.Sprintf("every %v message is available from the library", firmware), func(t *testing.T) {
+			ml := LibraryFor(firmware)
+
+			for _, m := range messagesFor(firmware) {
+				actualType, found := ml.GetByIdentifier(m.MessageType, m.Subsystem, m.CommandID)
+
+				assert.True(t, found)
+				assert.Equal(t, reflect.TypeOf(m.Value), actualType)
+			}
+		})
+
+		t.Run(fmt.Sprintf("every %v message survives a marshal and unmarshal round trip", firmware), func(t *testing.T) {
+			for _, m := range messagesFor(firmware) {
+				messageType := reflect.TypeOf(m.Value)
+
+				original := reflect.New(messageType)
+				populate(original.Elem())
+
+				data, err := bytecodec.Marshal(original.Interface())
+				if !assert.NoErrorf(t, err, "marshal %v", messageType) {
+					continue
+				}
+
+				decoded := reflect.New(messageType)
+				err = bytecodec.Unmarshal(data, decoded.Interface())
+				if !assert.NoErrorf(t, err, "unmarshal %v", messageType) {
+					continue
+				}
+
+				remarshalled, err := bytecodec.Marshal(decoded.Interface())
+				assert.NoErrorf(t, err, "remarshal %v", messageType)
+				assert.Equalf(t, data, remarshalled, "round trip %v", messageType)
+			}
+		})
+	}
+
+	t.Run("responses starting with a status are marked with a leading status", func(t *testing.T) {
+		ml := Library()
+
+		assert.True(t, ml.LeadingStatus(library.Identity{MessageType: SRSP, Subsystem: AF, CommandID: 0x01}))
+		assert.True(t, ml.LeadingStatus(library.Identity{MessageType: AREQ, Subsystem: AF, CommandID: 0x80}))
+		assert.False(t, ml.LeadingStatus(library.Identity{MessageType: SRSP, Subsystem: SYS, CommandID: 0x01}))
+	})
+
+	t.Run("ZDO callbacks report their status as a status carrier", func(t *testing.T) {
+		var carrier library.StatusCarrier = ZdoActiveEPRsp{SourceAddress: 0x1234, Status: StatusZDOTimeout}
+
+		code, name := carrier.ResponseStatus()
+
+		assert.Equal(t, uint8(StatusZDOTimeout), code)
+		assert.Equal(t, StatusZDOTimeout.String(), name)
+	})
+
+	t.Run("UTIL_SYNC_REQ is the asynchronous command 0xe0", func(t *testing.T) {
+		ml := Library()
+
+		identity, found := ml.GetByObject(UtilSyncReq{})
+		assert.True(t, found)
+		assert.Equal(t, library.Identity{MessageType: AREQ, Subsystem: UTIL, CommandID: 0xe0}, identity)
+	})
+
+	t.Run("sys ping is registered with high priority", func(t *testing.T) {
+		ml := Library()
+
+		priority := ml.Priority(library.Identity{MessageType: SREQ, Subsystem: SYS, CommandID: 0x01})
+		assert.Equal(t, library.PriorityHigh, priority)
+	})
+}
+
+func TestMessageEncoding(t *testing.T) {
+	t.Run("AF_DATA_REQUEST", func(t *testing.T) {
+		data, err := bytecodec.Marshal(AfDataRequest{
+			DestinationAddress:  0x1234,
+			DestinationEndpoint: 0x01,
+			SourceEndpoint:      0x02,
+			ClusterID:           0x0006,
+			TransactionID:       0x10,
+			Options:             0x00,
+			Radius:              0x1e,
+			Data:                []byte{0xaa, 0xbb},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x34, 0x12, 0x01, 0x02, 0x06, 0x00, 0x10, 0x00, 0x1e, 0x02, 0xaa, 0xbb}, data)
+	})
+
+	t.Run("ZDO_MGMT_BIND_RSP with group and IEEE bindings", func(t *testing.T) {
+		payload := []byte{
+			0x34, 0x12, 0x00, 0x02, 0x00, 0x02,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x06, 0x00, 0x01, 0x01, 0x00,
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x08, 0x00, 0x03, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x02,
+		}
+
+		rsp := ZdoMgmtBindRsp{}
+		err := bytecodec.Unmarshal(payload, &rsp)
+
+		assert.NoError(t, err)
+		assert.Equal(t, ZdoMgmtBindRsp{
+			SourceAddress:    0x1234,
+			Status:           StatusSuccess,
+			BindingTableSize: 2,
+			StartIndex:       0,
+			Bindings: []ZdoBinding{
+				{SourceAddress: 0x0807060504030201, SourceEndpoint: 0x01, ClusterID: 0x0006, DestinationAddressMode: AddressModeGroup, DestinationGroup: 0x0001},
+				{SourceAddress: 0x0807060504030201, SourceEndpoint: 0x01, ClusterID: 0x0008, DestinationAddressMode: AddressModeIEEE, DestinationAddress: 0x1817161514131211, DestinationEndpoint: 0x02},
+			},
+		}, rsp)
+	})
+
+	t.Run("ZDO_MGMT_LQI_RSP neighbour entries are 22 bytes", func(t *testing.T) {
+		data, err := bytecodec.Marshal(ZdoNeighbourLqi{})
+
+		assert.NoError(t, err)
+		assert.Len(t, data, 22)
+	})
+
+	t.Run("UTIL_GET_DEVICE_INFO", func(t *testing.T) {
+		payload := []byte{0x00, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x00, 0x00, 0x07, 0x09, 0x01, 0x34, 0x12}
+
+		rsp := UtilGetDeviceInfoReply{}
+		err := bytecodec.Unmarshal(payload, &rsp)
+
+		assert.NoError(t, err)
+		assert.Equal(t, UtilGetDeviceInfoReply{
+			Status:       StatusSuccess,
+			IEEEAddress:  0x0102030405060708,
+			NetworkAddr:  0x0000,
+			DeviceType:   0x07,
+			DeviceState:  DeviceStateCoordinator,
+			AssocDevices: []uint16{0x1234},
+		}, rsp)
+	})
+}
@@ -0,0 +1,153 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+)
+
+type SapiZbStartRequest struct{}
+
+type SapiZbStartRequestReply struct{}
+
+type SapiZbBindDevice struct {
+	Create      uint8
+	CommandID   uint16
+	Destination uint64
+}
+
+type SapiZbBindDeviceReply struct{}
+
+type SapiZbAllowBind struct {
+	Timeout uint8
+}
+
+type SapiZbAllowBindReply struct{}
+
+type SapiZbSendDataRequest struct {
+	Destination uint16
+	CommandID   uint16
+	Handle      uint8
+	Ack         uint8
+	Radius      uint8
+	Data        []byte `bcsliceprefix:"8"`
+}
+
+type SapiZbSendDataRequestReply struct{}
+
+type SapiZbReadConfiguration struct {
+	ConfigID uint8
+}
+
+type SapiZbReadConfigurationReply struct {
+	Status   Status
+	ConfigID uint8
+	Value    []byte `bcsliceprefix:"8"`
+}
+
+type SapiZbWriteConfiguration struct {
+	ConfigID uint8
+	Value    []byte `bcsliceprefix:"8"`
+}
+
+type SapiZbWriteConfigurationReply struct {
+	Status Status
+}
+
+type SapiZbGetDeviceInfo struct {
+	Parameter uint8
+}
+
+type SapiZbGetDeviceInfoReply struct {
+	Parameter uint8
+	Value     uint64
+}
+
+type SapiZbFindDeviceRequest struct {
+	SearchKey uint64
+}
+
+type SapiZbFindDeviceRequestReply struct{}
+
+type SapiZbPermitJoiningRequest struct {
+	Destination uint16
+	Timeout     uint8
+}
+
+type SapiZbPermitJoiningRequestReply struct {
+	Status Status
+}
+
+type SapiZbSystemReset struct{}
+
+type SapiZbAppRegisterRequest struct {
+	AppEndpoint    uint8
+	AppProfileID   uint16
+	DeviceID       uint16
+	DeviceVersion  uint8
+	Unused         uint8
+	InputCommands  []uint16 `bcsliceprefix:"8"`
+	OutputCommands []uint16 `bcsliceprefix:"8"`
+}
+
+type SapiZbAppRegisterRequestReply struct {
+	Status Status
+}
+
+type SapiZbStartConfirm struct {
+	Status Status
+}
+
+type SapiZbBindConfirm struct {
+	CommandID uint16
+	Status    Status
+}
+
+type SapiZbAllowBindConfirm struct {
+	Source uint16
+}
+
+type SapiZbSendDataConfirm struct {
+	Handle uint8
+	Status Status
+}
+
+type SapiZbFindDeviceConfirm struct {
+	SearchType uint8
+	SearchKey  uint16
+	Result     uint64
+}
+
+type SapiZbReceiveDataIndication struct {
+	Source  uint16
+	Command uint16
+	Data    []byte `bcsliceprefix:"16"`
+}
+
+var sapiMessages = []message{
+	{SREQ, SAPI, 0x00, SapiZbStartRequest{}, nil},
+	{SRSP, SAPI, 0x00, SapiZbStartRequestReply{}, nil},
+	{SREQ, SAPI, 0x01, SapiZbBindDevice{}, nil},
+	{SRSP, SAPI, 0x01, SapiZbBindDeviceReply{}, nil},
+	{SREQ, SAPI, 0x02, SapiZbAllowBind{}, nil},
+	{SRSP, SAPI, 0x02, SapiZbAllowBindReply{}, nil},
+	{SREQ, SAPI, 0x03, SapiZbSendDataRequest{}, nil},
+	{SRSP, SAPI, 0x03, SapiZbSendDataRequestReply{}, nil},
+	{SREQ, SAPI, 0x04, SapiZbReadConfiguration{}, nil},
+	{SRSP, SAPI, 0x04, SapiZbReadConfigurationReply{}, nil},
+	{SREQ, SAPI, 0x05, SapiZbWriteConfiguration{}, nil},
+	{SRSP, SAPI, 0x05, SapiZbWriteConfigurationReply{}, nil},
+	{SREQ, SAPI, 0x06, SapiZbGetDeviceInfo{}, nil},
+	{SRSP, SAPI, 0x06, SapiZbGetDeviceInfoReply{}, nil},
+	{SREQ, SAPI, 0x07, SapiZbFindDeviceRequest{}, nil},
+	{SRSP, SAPI, 0x07, SapiZbFindDeviceRequestReply{}, nil},
+	{SREQ, SAPI, 0x08, SapiZbPermitJoiningRequest{}, nil},
+	{SRSP, SAPI, 0x08, SapiZbPermitJoiningRequestReply{}, nil},
+	{AREQ, SAPI, 0x09, SapiZbSystemReset{}, nil},
+	{SREQ, SAPI, 0x0a, SapiZbAppRegisterRequest{}, nil},
+	{SRSP, SAPI, 0x0a, SapiZbAppRegisterRequestReply{}, nil},
+	{AREQ, SAPI, 0x80, SapiZbStartConfirm{}, nil},
+	{AREQ, SAPI, 0x81, SapiZbBindConfirm{}, nil},
+	{AREQ, SAPI, 0x82, SapiZbAllowBindConfirm{}, nil},
+	{AREQ, SAPI, 0x83, SapiZbSendDataConfirm{}, nil},
+	{AREQ, SAPI, 0x85, SapiZbFindDeviceConfirm{}, nil},
+	{AREQ, SAPI, 0x87, SapiZbReceiveDataIndication{}, nil},
+}
@@ -0,0 +1,281 @@
+package znp
+
+import "fmt"
+
+// Status is the status code returned by most Z-Stack commands and callbacks.
+type Status uint8
+
+const (
+	StatusSuccess                 Status = 0x00
+	StatusFailure                 Status = 0x01
+	StatusInvalidParameter        Status = 0x02
+	StatusInvalidTask             Status = 0x03
+	StatusMsgBufferNotAvailable   Status = 0x04
+	StatusInvalidMsgPointer       Status = 0x05
+	StatusInvalidEventID          Status = 0x06
+	StatusInvalidInterruptID      Status = 0x07
+	StatusNoTimerAvailable        Status = 0x08
+	StatusNVItemUninitialised     Status = 0x09
+	StatusNVOperationFailed       Status = 0x0a
+	StatusInvalidMemSize          Status = 0x0b
+	StatusNVBadItemLength         Status = 0x0c
+	StatusMemError                Status = 0x10
+	StatusBufferFull              Status = 0x11
+	StatusUnsupportedMode         Status = 0x12
+	StatusMACMemError             Status = 0x13
+	StatusZDOInvalidRequestType   Status = 0x80
+	StatusZDODeviceNotFound       Status = 0x81
+	StatusZDOInvalidEndpoint      Status = 0x82
+	StatusZDONotActive            Status = 0x83
+	StatusZDONotSupported         Status = 0x84
+	StatusZDOTimeout              Status = 0x85
+	StatusZDONoMatch              Status = 0x86
+	StatusZDONoEntry              Status = 0x88
+	StatusZDONoDescriptor         Status = 0x89
+	StatusZDOInsufficientSpace    Status = 0x8a
+	StatusZDONotPermitted         Status = 0x8b
+	StatusZDOTableFull            Status = 0x8c
+	StatusZDONotAuthorized        Status = 0x8d
+	StatusZDOBindingTableFull     Status = 0x8e
+	StatusSecNoKey                Status = 0xa1
+	StatusSecOldFrameCount        Status = 0xa2
+	StatusSecMaxFrameCount        Status = 0xa3
+	StatusSecCCMFail              Status = 0xa4
+	StatusAPSFail                 Status = 0xb0
+	StatusAPSTableFull            Status = 0xb1
+	StatusAPSIllegalRequest       Status = 0xb2
+	StatusAPSInvalidBinding       Status = 0xb3
+	StatusAPSUnsupportedAttribute Status = 0xb4
+	StatusAPSNotSupported         Status = 0xb5
+	StatusAPSNoAck                Status = 0xb6
+	StatusAPSDuplicateEntry       Status = 0xb7
+	StatusAPSNoBoundDevice        Status = 0xb8
+	StatusAPSNotAllowed           Status = 0xb9
+	StatusAPSNotAuthenticated     Status = 0xba
+	StatusNWKInvalidParameter     Status = 0xc1
+	StatusNWKInvalidRequest       Status = 0xc2
+	StatusNWKNotPermitted         Status = 0xc3
+	StatusNWKStartupFailure       Status = 0xc4
+	StatusNWKAlreadyPresent       Status = 0xc5
+	StatusNWKSyncFailure          Status = 0xc6
+	StatusNWKTableFull            Status = 0xc7
+	StatusNWKUnknownDevice        Status = 0xc8
+	StatusNWKUnsupportedAttribute Status = 0xc9
+	StatusNWKNoNetworks           Status = 0xca
+	StatusNWKLeaveUnconfirmed     Status = 0xcb
+	StatusNWKNoAck                Status = 0xcc
+	StatusNWKNoRoute              Status = 0xcd
+	StatusMACBeaconLoss           Status = 0xe0
+	StatusMACChannelAccessFailure Status = 0xe1
+	StatusMACDenied               Status = 0xe2
+	StatusMACDisableTRXFailure    Status = 0xe3
+	StatusMACFailedSecurityCheck  Status = 0xe4
+	StatusMACFrameTooLong         Status = 0xe5
+	StatusMACInvalidGTS           Status = 0xe6
+	StatusMACInvalidHandle        Status = 0xe7
+	StatusMACInvalidParameter     Status = 0xe8
+	StatusMACNoAck                Status = 0xe9
+	StatusMACNoBeacon             Status = 0xea
+	StatusMACNoData               Status = 0xeb
+	StatusMACNoShortAddress       Status = 0xec
+	StatusMACOutOfCap             Status = 0xed
+	StatusMACPANIDConflict        Status = 0xee
+	StatusMACRealignment          Status = 0xef
+	StatusMACTransactionExpired   Status = 0xf0
+	StatusMACTransactionOverflow  Status = 0xf1
+	StatusMACTXActive             Status = 0xf2
+	StatusMACUnavailableKey       Status = 0xf3
+	StatusMACUnsupportedAttribute Status = 0xf4
+	StatusMACUnsupported          Status = 0xf5
+)
+
+var statusNames = map[Status]string{
+	StatusSuccess:                 "SUCCESS",
+	StatusFailure:                 "FAILURE",
+	StatusInvalidParameter:        "INVALID_PARAMETER",
+	StatusInvalidTask:             "INVALID_TASK",
+	StatusMsgBufferNotAvailable:   "MSG_BUFFER_NOT_AVAIL",
+	StatusInvalidMsgPointer:       "INVALID_MSG_POINTER",
+	StatusInvalidEventID:          "INVALID_EVENT_ID",
+	StatusInvalidInterruptID:      "INVALID_INTERRUPT_ID",
+	StatusNoTimerAvailable:        "NO_TIMER_AVAIL",
+	StatusNVItemUninitialised:     "NV_ITEM_UNINIT",
+	StatusNVOperationFailed:       "NV_OPER_FAILED",
+	StatusInvalidMemSize:          "INVALID_MEM_SIZE",
+	StatusNVBadItemLength:         "NV_BAD_ITEM_LEN",
+	StatusMemError:                "MEM_ERROR",
+	StatusBufferFull:              "BUFFER_FULL",
+	StatusUnsupportedMode:         "UNSUPPORTED_MODE",
+	StatusMACMemError:             "MAC_MEM_ERROR",
+	StatusZDOInvalidRequestType:   "ZDO_INVALID_REQUEST_TYPE",
+	StatusZDODeviceNotFound:       "ZDO_DEVICE_NOT_FOUND",
+	StatusZDOInvalidEndpoint:      "ZDO_INVALID_ENDPOINT",
+	StatusZDONotActive:            "ZDO_NOT_ACTIVE",
+	StatusZDONotSupported:         "ZDO_NOT_SUPPORTED",
+	StatusZDOTimeout:              "ZDO_TIMEOUT",
+	StatusZDONoMatch:              "ZDO_NO_MATCH",
+	StatusZDONoEntry:              "ZDO_NO_ENTRY",
+	StatusZDONoDescriptor:         "ZDO_NO_DESCRIPTOR",
+	StatusZDOInsufficientSpace:    "ZDO_INSUFFICIENT_SPACE",
+	StatusZDONotPermitted:         "ZDO_NOT_PERMITTED",
+	StatusZDOTableFull:            "ZDO_TABLE_FULL",
+	StatusZDONotAuthorized:        "ZDO_NOT_AUTHORIZED",
+	StatusZDOBindingTableFull:     "ZDO_BINDING_TABLE_FULL",
+	StatusSecNoKey:                "SEC_NO_KEY",
+	StatusSecOldFrameCount:        "SEC_OLD_FRM_COUNT",
+	StatusSecMaxFrameCount:        "SEC_MAX_FRM_COUNT",
+	StatusSecCCMFail:              "SEC_CCM_FAIL",
+	StatusAPSFail:                 "APS_FAIL",
+	StatusAPSTableFull:            "APS_TABLE_FULL",
+	StatusAPSIllegalRequest:       "APS_ILLEGAL_REQUEST",
+	StatusAPSInvalidBinding:       "APS_INVALID_BINDING",
+	StatusAPSUnsupportedAttribute: "APS_UNSUPPORTED_ATTRIB",
+	StatusAPSNotSupported:         "APS_NOT_SUPPORTED",
+	StatusAPSNoAck:                "APS_NO_ACK",
+	StatusAPSDuplicateEntry:       "APS_DUPLICATE_ENTRY",
+	StatusAPSNoBoundDevice:        "APS_NO_BOUND_DEVICE",
+	StatusAPSNotAllowed:           "APS_NOT_ALLOWED",
+	StatusAPSNotAuthenticated:     "APS_NOT_AUTHENTICATED",
+	StatusNWKInvalidParameter:     "NWK_INVALID_PARAM",
+	StatusNWKInvalidRequest:       "NWK_INVALID_REQUEST",
+	StatusNWKNotPermitted:         "NWK_NOT_PERMITTED",
+	StatusNWKStartupFailure:       "NWK_STARTUP_FAILURE",
+	StatusNWKAlreadyPresent:       "NWK_ALREADY_PRESENT",
+	StatusNWKSyncFailure:          "NWK_SYNC_FAILURE",
+	StatusNWKTableFull:            "NWK_TABLE_FULL",
+	StatusNWKUnknownDevice:        "NWK_UNKNOWN_DEVICE",
+	StatusNWKUnsupportedAttribute: "NWK_UNSUPPORTED_ATTRIBUTE",
+	StatusNWKNoNetworks:           "NWK_NO_NETWORKS",
+	StatusNWKLeaveUnconfirmed:     "NWK_LEAVE_UNCONFIRMED",
+	StatusNWKNoAck:                "NWK_NO_ACK",
+	StatusNWKNoRoute:              "NWK_NO_ROUTE",
+	StatusMACBeaconLoss:           "MAC_BEACON_LOSS",
+	StatusMACChannelAccessFailure: "MAC_CHANNEL_ACCESS_FAILURE",
+	StatusMACDenied:               "MAC_DENIED",
+	StatusMACDisableTRXFailure:    "MAC_DISABLE_TRX_FAILURE",
+	StatusMACFailedSecurityCheck:  "MAC_FAILED_SECURITY_CHECK",
+	StatusMACFrameTooLong:         "MAC_FRAME_TOO_LONG",
+	StatusMACInvalidGTS:           "MAC_INVALID_GTS",
+	StatusMACInvalidHandle:        "MAC_INVALID_HANDLE",
+	StatusMACInvalidParameter:     "MAC_INVALID_PARAMETER",
+	StatusMACNoAck:                "MAC_NO_ACK",
+	StatusMACNoBeacon:             "MAC_NO_BEACON",
+	StatusMACNoData:               "MAC_NO_DATA",
+	StatusMACNoShortAddress:       "MAC_NO_SHORT_ADDR",
+	StatusMACOutOfCap:             "MAC_OUT_OF_CAP",
+	StatusMACPANIDConflict:        "MAC_PANID_CONFLICT",
+	StatusMACRealignment:          "MAC_REALIGNMENT",
+	StatusMACTransactionExpired:   "MAC_TRANSACTION_EXPIRED",
+	StatusMACTransactionOverflow:  "MAC_TRANSACTION_OVERFLOW",
+	StatusMACTXActive:             "MAC_TX_ACTIVE",
+	StatusMACUnavailableKey:       "MAC_UNAVAILABLE_KEY",
+	StatusMACUnsupportedAttribute: "MAC_UNSUPPORTED_ATTRIBUTE",
+	StatusMACUnsupported:          "MAC_UNSUPPORTED",
+}
+
+func (s Status) String() string {
+	if name, found := statusNames[s]; found {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN_STATUS_0x%02x", uint8(s))
+}
+
+// DeviceState is the state of the Zigbee device, as reported by ZDO_STATE_CHANGE_IND.
+type DeviceState uint8
+
+const (
+	DeviceStateHold             DeviceState = 0x00
+	DeviceStateInit             DeviceState = 0x01
+	DeviceStateNetworkDiscovery DeviceState = 0x02
+	DeviceStateNetworkJoining   DeviceState = 0x03
+	DeviceStateNetworkRejoin    DeviceState = 0x04
+	DeviceStateEndDeviceUnauth  DeviceState = 0x05
+	DeviceStateEndDevice        DeviceState = 0x06
+	DeviceStateRouter           DeviceState = 0x07
+	DeviceStateCoordStarting    DeviceState = 0x08
+	DeviceStateCoordinator      DeviceState = 0x09
+	DeviceStateNetworkOrphan    DeviceState = 0x0a
+
+	// Reported by Z-Stack 3 firmware only.
+	DeviceStateNetworkKeepAlive              DeviceState = 0x0b
+	DeviceStateNetworkBackoff                DeviceState = 0x0c
+	DeviceStateNetworkSecureRejoinAllChannel DeviceState = 0x0d
+	DeviceStateNetworkTCRejoinCurrentChannel DeviceState = 0x0e
+	DeviceStateNetworkTCRejoinAllChannel     DeviceState = 0x0f
+)
+
+var deviceStateNames = map[DeviceState]string{
+	DeviceStateHold:             "DEV_HOLD",
+	DeviceStateInit:             "DEV_INIT",
+	DeviceStateNetworkDiscovery: "DEV_NWK_DISC",
+	DeviceStateNetworkJoining:   "DEV_NWK_JOINING",
+	DeviceStateNetworkRejoin:    "DEV_NWK_REJOIN",
+	DeviceStateEndDeviceUnauth:  "DEV_END_DEVICE_UNAUTH",
+	DeviceStateEndDevice:        "DEV_END_DEVICE",
+	DeviceStateRouter:           "DEV_ROUTER",
+	DeviceStateCoordStarting:    "DEV_COORD_STARTING",
+	DeviceStateCoordinator:      "DEV_ZB_COORD",
+	DeviceStateNetworkOrphan:    "DEV_NWK_ORPHAN",
+
+	DeviceStateNetworkKeepAlive:              "DEV_NWK_KA",
+	DeviceStateNetworkBackoff:                "DEV_NWK_BACKOFF",
+	DeviceStateNetworkSecureRejoinAllChannel: "DEV_NWK_SEC_REJOIN_ALL_CHANNEL",
+	DeviceStateNetworkTCRejoinCurrentChannel: "DEV_NWK_TC_REJOIN_CURR_CHANNEL",
+	DeviceStateNetworkTCRejoinAllChannel:     "DEV_NWK_TC_REJOIN_ALL_CHANNEL",
+}
+
+func (s DeviceState) String() string {
+	if name, found := deviceStateNames[s]; found {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN_STATE_0x%02x", uint8(s))
+}
+
+// CommissioningStatus is the status reported by APP_CNF_BDB_COMMISSIONING_NOTIFICATION.
+type CommissioningStatus uint8
+
+const (
+	CommissioningSuccess                   CommissioningStatus = 0x00
+	CommissioningInProgress                CommissioningStatus = 0x01
+	CommissioningNoNetwork                 CommissioningStatus = 0x02
+	CommissioningTLTargetFailure           CommissioningStatus = 0x03
+	CommissioningTLNotAACapable            CommissioningStatus = 0x04
+	CommissioningTLNoScanResponse          CommissioningStatus = 0x05
+	CommissioningTLNotPermitted            CommissioningStatus = 0x06
+	CommissioningTCLKExchangeFailure       CommissioningStatus = 0x07
+	CommissioningFormationFailure          CommissioningStatus = 0x08
+	CommissioningFBTargetInProgress        CommissioningStatus = 0x09
+	CommissioningFBInitiatorInProgress     CommissioningStatus = 0x0a
+	CommissioningFBNoIdentifyQueryResponse CommissioningStatus = 0x0b
+	CommissioningFBBindingTableFull        CommissioningStatus = 0x0c
+	CommissioningNetworkRestored           CommissioningStatus = 0x0d
+	CommissioningFailure                   CommissioningStatus = 0x0e
+)
+
+var commissioningStatusNames = map[CommissioningStatus]string{
+	CommissioningSuccess:                   "SUCCESS",
+	CommissioningInProgress:                "IN_PROGRESS",
+	CommissioningNoNetwork:                 "NO_NETWORK",
+	CommissioningTLTargetFailure:           "TL_TARGET_FAILURE",
+	CommissioningTLNotAACapable:            "TL_NOT_AA_CAPABLE",
+	CommissioningTLNoScanResponse:          "TL_NO_SCAN_RESPONSE",
+	CommissioningTLNotPermitted:            "TL_NOT_PERMITTED",
+	CommissioningTCLKExchangeFailure:       "TCLK_EX_FAILURE",
+	CommissioningFormationFailure:          "FORMATION_FAILURE",
+	CommissioningFBTargetInProgress:        "FB_TARGET_IN_PROGRESS",
+	CommissioningFBInitiatorInProgress:     "FB_INITIATOR_IN_PROGRESS",
+	CommissioningFBNoIdentifyQueryResponse: "FB_NO_IDENTIFY_QUERY_RESPONSE",
+	CommissioningFBBindingTableFull:        "FB_BINDING_TABLE_FULL",
+	CommissioningNetworkRestored:           "NETWORK_RESTORED",
+	CommissioningFailure:                   "FAILURE",
+}
+
+func (s CommissioningStatus) String() string {
+	if name, found := commissioningStatusNames[s]; found {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN_COMMISSIONING_STATUS_0x%02x", uint8(s))
+}
@@ -0,0 +1,20 @@
+package znp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	t.Run("known statuses are named", func(t *testing.T) {
+		assert.Equal(t, "SUCCESS", StatusSuccess.String())
+		assert.Equal(t, "DEV_ZB_COORD", DeviceStateCoordinator.String())
+		assert.Equal(t, "NETWORK_RESTORED", CommissioningNetworkRestored.String())
+	})
+
+	t.Run("unknown statuses include their value", func(t *testing.T) {
+		assert.Equal(t, "UNKNOWN_STATUS_0xfe", Status(0xfe).String())
+		assert.Equal(t, "UNKNOWN_STATE_0x7f", DeviceState(0x7f).String())
+		assert.Equal(t, "UNKNOWN_COMMISSIONING_STATUS_0x7f", CommissioningStatus(0x7f).String())
+	})
+}
@@ -0,0 +1,365 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/library"
+)
+
+// Command IDs of the SYS commands which the broker sends and decodes itself to manage the adapter.
+const (
+	SysResetReqCommandID byte = 0x00
+	SysPingCommandID     byte = 0x01
+	SysVersionCommandID  byte = 0x02
+	SysResetIndCommandID byte = 0x80
+)
+
+type ResetType uint8
+
+const (
+	ResetHard ResetType = 0x00
+	ResetSoft ResetType = 0x01
+)
+
+type SysResetReq struct {
+	ResetType ResetType
+}
+
+type SysPing struct{}
+
+type SysPingReply struct {
+	Capabilities Capabilities
+}
+
+type SysVersion struct{}
+
+// SysVersionRevisionReply is the SYS_VERSION reply, released Z-Stack Home 1.2, 3.0.x and 3.x.0 builds all
+// append the firmware build date as a revision.
+type SysVersionRevisionReply struct {
+	TransportRev       uint8
+	Product            uint8
+	MajorRelease       uint8
+	MinorRelease       uint8
+	MaintenanceRelease uint8
+	Revision           uint32
+}
+
+type SysSetExtAddr struct {
+	ExtAddress uint64
+}
+
+type SysSetExtAddrReply struct {
+	Status Status
+}
+
+type SysGetExtAddr struct{}
+
+type SysGetExtAddrReply struct {
+	ExtAddress uint64
+}
+
+type SysRamRead struct {
+	Address uint16
+	Length  uint8
+}
+
+type SysRamReadReply struct {
+	Status Status
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+type SysRamWrite struct {
+	Address uint16
+	Value   []byte `bcsliceprefix:"8"`
+}
+
+type SysRamWriteReply struct {
+	Status Status
+}
+
+type SysOSALNVItemInit struct {
+	NVItemID uint16
+	ItemLen  uint16
+	InitData []byte `bcsliceprefix:"8"`
+}
+
+type SysOSALNVItemInitReply struct {
+	Status Status
+}
+
+type SysOSALNVRead struct {
+	NVItemID uint16
+	Offset   uint8
+}
+
+type SysOSALNVReadReply struct {
+	Status Status
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+type SysOSALNVWrite struct {
+	NVItemID uint16
+	Offset   uint8
+	Value    []byte `bcsliceprefix:"8"`
+}
+
+type SysOSALNVWriteReply struct {
+	Status Status
+}
+
+type SysRandom struct{}
+
+type SysRandomReply struct {
+	Value uint16
+}
+
+type SysADCRead struct {
+	Channel    uint8
+	Resolution uint8
+}
+
+type SysADCReadReply struct {
+	Value uint16
+}
+
+type SysGPIO struct {
+	Operation uint8
+	Value     uint8
+}
+
+type SysGPIOReply struct {
+	Value uint8
+}
+
+type SysStackTune struct {
+	Operation uint8
+	Value     uint8
+}
+
+type SysStackTuneReply struct {
+	Value uint8
+}
+
+type SysSetTime struct {
+	UTCTime uint32
+	Hour    uint8
+	Minute  uint8
+	Second  uint8
+	Month   uint8
+	Day     uint8
+	Year    uint16
+}
+
+type SysSetTimeReply struct {
+	Status Status
+}
+
+type SysGetTime struct{}
+
+type SysGetTimeReply struct {
+	UTCTime uint32
+	Hour    uint8
+	Minute  uint8
+	Second  uint8
+	Month   uint8
+	Day     uint8
+	Year    uint16
+}
+
+type SysOSALNVDelete struct {
+	NVItemID uint16
+	ItemLen  uint16
+}
+
+type SysOSALNVDeleteReply struct {
+	Status Status
+}
+
+type SysOSALNVLength struct {
+	NVItemID uint16
+}
+
+type SysOSALNVLengthReply struct {
+	Length uint16
+}
+
+type SysSetTXPower struct {
+	TXPower uint8
+}
+
+type SysSetTXPowerReply struct {
+	TXPower uint8
+}
+
+type SysOSALNVReadExt struct {
+	NVItemID uint16
+	Offset   uint16
+}
+
+type SysOSALNVReadExtReply struct {
+	Status Status
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+type SysOSALNVWriteExt struct {
+	NVItemID uint16
+	Offset   uint16
+	Value    []byte `bcsliceprefix:"16"`
+}
+
+type SysOSALNVWriteExtReply struct {
+	Status Status
+}
+
+type SysNVCreate struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Length uint32
+}
+
+type SysNVCreateReply struct {
+	Status Status
+}
+
+type SysNVDelete struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+}
+
+type SysNVDeleteReply struct {
+	Status Status
+}
+
+type SysNVLength struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+}
+
+type SysNVLengthReply struct {
+	Length uint32
+}
+
+type SysNVRead struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Offset uint16
+	Length uint8
+}
+
+type SysNVReadReply struct {
+	Status Status
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+type SysNVWrite struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Offset uint16
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+type SysNVWriteReply struct {
+	Status Status
+}
+
+type ResetReason uint8
+
+const (
+	ResetReasonPowerUp  ResetReason = 0x00
+	ResetReasonExternal ResetReason = 0x01
+	ResetReasonWatchdog ResetReason = 0x02
+)
+
+func (r ResetReason) String() string {
+	switch r {
+	case ResetReasonPowerUp:
+		return "power up"
+	case ResetReasonExternal:
+		return "external"
+	case ResetReasonWatchdog:
+		return "watchdog"
+	default:
+		return "unknown"
+	}
+}
+
+type SysResetInd struct {
+	Reason           ResetReason
+	TransportRev     uint8
+	ProductID        uint8
+	MajorRelease     uint8
+	MinorRelease     uint8
+	HardwareRevision uint8
+}
+
+type SysOSALTimerExpired struct {
+	ID uint8
+}
+
+var sysMessages = []message{
+	{AREQ, SYS, SysResetReqCommandID, SysResetReq{}, nil},
+	{SREQ, SYS, SysPingCommandID, SysPing{}, []library.Option{library.WithPriority(library.PriorityHigh)}},
+	{SRSP, SYS, SysPingCommandID, SysPingReply{}, nil},
+	{SREQ, SYS, SysVersionCommandID, SysVersion{}, nil},
+	{SRSP, SYS, SysVersionCommandID, SysVersionRevisionReply{}, nil},
+	{SREQ, SYS, 0x03, SysSetExtAddr{}, nil},
+	{SRSP, SYS, 0x03, SysSetExtAddrReply{}, nil},
+	{SREQ, SYS, 0x04, SysGetExtAddr{}, nil},
+	{SRSP, SYS, 0x04, SysGetExtAddrReply{}, nil},
+	{SREQ, SYS, 0x05, SysRamRead{}, nil},
+	{SRSP, SYS, 0x05, SysRamReadReply{}, nil},
+	{SREQ, SYS, 0x06, SysRamWrite{}, nil},
+	{SRSP, SYS, 0x06, SysRamWriteReply{}, nil},
+	{SREQ, SYS, 0x07, SysOSALNVItemInit{}, nil},
+	{SRSP, SYS, 0x07, SysOSALNVItemInitReply{}, nil},
+	{SREQ, SYS, 0x08, SysOSALNVRead{}, nil},
+	{SRSP, SYS, 0x08, SysOSALNVReadReply{}, nil},
+	{SREQ, SYS, 0x09, SysOSALNVWrite{}, nil},
+	{SRSP, SYS, 0x09, SysOSALNVWriteReply{}, nil},
+	{SREQ, SYS, 0x0c, SysRandom{}, nil},
+	{SRSP, SYS, 0x0c, SysRandomReply{}, nil},
+	{SREQ, SYS, 0x0d, SysADCRead{}, nil},
+	{SRSP, SYS, 0x0d, SysADCReadReply{}, nil},
+	{SREQ, SYS, 0x0e, SysGPIO{}, nil},
+	{SRSP, SYS, 0x0e, SysGPIOReply{}, nil},
+	{SREQ, SYS, 0x0f, SysStackTune{}, nil},
+	{SRSP, SYS, 0x0f, SysStackTuneReply{}, nil},
+	{SREQ, SYS, 0x10, SysSetTime{}, nil},
+	{SRSP, SYS, 0x10, SysSetTimeReply{}, nil},
+	{SREQ, SYS, 0x11, SysGetTime{}, nil},
+	{SRSP, SYS, 0x11, SysGetTimeReply{}, nil},
+	{SREQ, SYS, 0x12, SysOSALNVDelete{}, nil},
+	{SRSP, SYS, 0x12, SysOSALNVDeleteReply{}, nil},
+	{SREQ, SYS, 0x13, SysOSALNVLength{}, nil},
+	{SRSP, SYS, 0x13, SysOSALNVLengthReply{}, nil},
+	{SREQ, SYS, 0x14, SysSetTXPower{}, nil},
+	{SRSP, SYS, 0x14, SysSetTXPowerReply{}, nil},
+	{AREQ, SYS, SysResetIndCommandID, SysResetInd{}, nil},
+	{AREQ, SYS, 0x81, SysOSALTimerExpired{}, nil},
+}
+
+// sysOSALNVExtMessages are the extended OSAL NV commands, absent from Z-Stack Home 1.2.
+var sysOSALNVExtMessages = []message{
+	{SREQ, SYS, 0x1c, SysOSALNVReadExt{}, nil},
+	{SRSP, SYS, 0x1c, SysOSALNVReadExtReply{}, nil},
+	{SREQ, SYS, 0x1d, SysOSALNVWriteExt{}, nil},
+	{SRSP, SYS, 0x1d, SysOSALNVWriteExtReply{}, nil},
+}
+
+// sysNVMessages are the NV driver commands of Z-Stack 3.x.0, which stores items by system, item and sub ID.
+var sysNVMessages = []message{
+	{SREQ, SYS, 0x30, SysNVCreate{}, nil},
+	{SRSP, SYS, 0x30, SysNVCreateReply{}, nil},
+	{SREQ, SYS, 0x31, SysNVDelete{}, nil},
+	{SRSP, SYS, 0x31, SysNVDeleteReply{}, nil},
+	{SREQ, SYS, 0x32, SysNVLength{}, nil},
+	{SRSP, SYS, 0x32, SysNVLengthReply{}, nil},
+	{SREQ, SYS, 0x33, SysNVRead{}, nil},
+	{SRSP, SYS, 0x33, SysNVReadReply{}, nil},
+	{SREQ, SYS, 0x34, SysNVWrite{}, nil},
+	{SRSP, SYS, 0x34, SysNVWriteReply{}, nil},
+}
@@ -0,0 +1,203 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+)
+
+type UtilGetDeviceInfo struct{}
+
+type UtilGetDeviceInfoReply struct {
+	Status       Status
+	IEEEAddress  uint64
+	NetworkAddr  uint16
+	DeviceType   uint8
+	DeviceState  DeviceState
+	AssocDevices []uint16 `bcsliceprefix:"8"`
+}
+
+type UtilGetNVInfo struct{}
+
+type UtilGetNVInfoReply struct {
+	Status        Status
+	IEEEAddress   uint64
+	ScanChannels  uint32
+	PanID         uint16
+	SecurityLevel uint8
+	PreConfigKey  [16]byte
+}
+
+type UtilSetPanID struct {
+	PanID uint16
+}
+
+type UtilSetPanIDReply struct {
+	Status Status
+}
+
+type UtilSetChannels struct {
+	Channels uint32
+}
+
+type UtilSetChannelsReply struct {
+	Status Status
+}
+
+type UtilSetSecurityLevel struct {
+	SecurityLevel uint8
+}
+
+type UtilSetSecurityLevelReply struct {
+	Status Status
+}
+
+type UtilSetPreConfigKey struct {
+	PreConfigKey [16]byte
+}
+
+type UtilSetPreConfigKeyReply struct {
+	Status Status
+}
+
+type UtilCallbackSubCmd struct {
+	SubsystemID uint16
+	Action      uint8
+}
+
+type UtilCallbackSubCmdReply struct {
+	Status Status
+}
+
+type UtilKeyEvent struct {
+	Keys  uint8
+	Shift uint8
+}
+
+type UtilKeyEventReply struct {
+	Status Status
+}
+
+type UtilTimeAlive struct{}
+
+type UtilTimeAliveReply struct {
+	Seconds uint32
+}
+
+type UtilLEDControl struct {
+	LEDID uint8
+	Mode  uint8
+}
+
+type UtilLEDControlReply struct {
+	Status Status
+}
+
+type UtilLoopback struct {
+	Data []byte
+}
+
+type UtilLoopbackReply struct {
+	Data []byte
+}
+
+type UtilDataReq struct {
+	SecurityUse uint8
+}
+
+type UtilDataReqReply struct {
+	Status Status
+}
+
+type UtilAddrMgrExtAddrLookup struct {
+	ExtAddress uint64
+}
+
+type UtilAddrMgrExtAddrLookupReply struct {
+	NetworkAddress uint16
+}
+
+type UtilAddrMgrNwkAddrLookup struct {
+	NetworkAddress uint16
+}
+
+type UtilAddrMgrNwkAddrLookupReply struct {
+	ExtAddress uint64
+}
+
+type UtilAPSMELinkKeyDataGet struct {
+	ExtAddress uint64
+}
+
+type UtilAPSMELinkKeyDataGetReply struct {
+	Status         Status
+	SecurityKey    [16]byte
+	TxFrameCounter uint32
+	RxFrameCounter uint32
+}
+
+type UtilAPSMELinkKeyNVIDGet struct {
+	ExtAddress uint64
+}
+
+type UtilAPSMELinkKeyNVIDGetReply struct {
+	Status        Status
+	LinkKeyNVItem uint16
+}
+
+type UtilAssocCount struct {
+	StartRelation uint8
+	EndRelation   uint8
+}
+
+type UtilAssocCountReply struct {
+	Count uint16
+}
+
+type UtilAPSMERequestKeyCmd struct {
+	PartnerAddress uint64
+}
+
+type UtilAPSMERequestKeyCmdReply struct {
+	Status Status
+}
+
+type UtilSyncReq struct{}
+
+var utilMessages = []message{
+	{SREQ, UTIL, 0x00, UtilGetDeviceInfo{}, nil},
+	{SRSP, UTIL, 0x00, UtilGetDeviceInfoReply{}, nil},
+	{SREQ, UTIL, 0x01, UtilGetNVInfo{}, nil},
+	{SRSP, UTIL, 0x01, UtilGetNVInfoReply{}, nil},
+	{SREQ, UTIL, 0x02, UtilSetPanID{}, nil},
+	{SRSP, UTIL, 0x02, UtilSetPanIDReply{}, nil},
+	{SREQ, UTIL, 0x03, UtilSetChannels{}, nil},
+	{SRSP, UTIL, 0x03, UtilSetChannelsReply{}, nil},
+	{SREQ, UTIL, 0x04, UtilSetSecurityLevel{}, nil},
+	{SRSP, UTIL, 0x04, UtilSetSecurityLevelReply{}, nil},
+	{SREQ, UTIL, 0x05, UtilSetPreConfigKey{}, nil},
+	{SRSP, UTIL, 0x05, UtilSetPreConfigKeyReply{}, nil},
+	{SREQ, UTIL, 0x06, UtilCallbackSubCmd{}, nil},
+	{SRSP, UTIL, 0x06, UtilCallbackSubCmdReply{}, nil},
+	{SREQ, UTIL, 0x07, UtilKeyEvent{}, nil},
+	{SRSP, UTIL, 0x07, UtilKeyEventReply{}, nil},
+	{SREQ, UTIL, 0x09, UtilTimeAlive{}, nil},
+	{SRSP, UTIL, 0x09, UtilTimeAliveReply{}, nil},
+	{SREQ, UTIL, 0x0a, UtilLEDControl{}, nil},
+	{SRSP, UTIL, 0x0a, UtilLEDControlReply{}, nil},
+	{SREQ, UTIL, 0x10, UtilLoopback{}, nil},
+	{SRSP, UTIL, 0x10, UtilLoopbackReply{}, nil},
+	{SREQ, UTIL, 0x11, UtilDataReq{}, nil},
+	{SRSP, UTIL, 0x11, UtilDataReqReply{}, nil},
+	{SREQ, UTIL, 0x40, UtilAddrMgrExtAddrLookup{}, nil},
+	{SRSP, UTIL, 0x40, UtilAddrMgrExtAddrLookupReply{}, nil},
+	{SREQ, UTIL, 0x41, UtilAddrMgrNwkAddrLookup{}, nil},
+	{SRSP, UTIL, 0x41, UtilAddrMgrNwkAddrLookupReply{}, nil},
+	{SREQ, UTIL, 0x44, UtilAPSMELinkKeyDataGet{}, nil},
+	{SRSP, UTIL, 0x44, UtilAPSMELinkKeyDataGetReply{}, nil},
+	{SREQ, UTIL, 0x45, UtilAPSMELinkKeyNVIDGet{}, nil},
+	{SRSP, UTIL, 0x45, UtilAPSMELinkKeyNVIDGetReply{}, nil},
+	{SREQ, UTIL, 0x48, UtilAssocCount{}, nil},
+	{SRSP, UTIL, 0x48, UtilAssocCountReply{}, nil},
+	{SREQ, UTIL, 0x4b, UtilAPSMERequestKeyCmd{}, nil},
+	{SRSP, UTIL, 0x4b, UtilAPSMERequestKeyCmdReply{}, nil},
+	{AREQ, UTIL, 0xe0, UtilSyncReq{}, nil},
+}
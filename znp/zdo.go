@@ -0,0 +1,531 @@
+package znp
+
+import (
+	. "github.com/shimmeringbee/unpi"
+)
+
+// Address modes used by ZDO and AF messages which carry a destination address mode field.
+const (
+	AddressModeNone      uint8 = 0x00
+	AddressModeGroup     uint8 = 0x01
+	AddressModeShort     uint8 = 0x02
+	AddressModeIEEE      uint8 = 0x03
+	AddressModeBroadcast uint8 = 0x0f
+)
+
+type ZdoNwkAddrReq struct {
+	IEEEAddress uint64
+	RequestType uint8
+	StartIndex  uint8
+}
+
+type ZdoNwkAddrReqReply struct {
+	Status Status
+}
+
+type ZdoIEEEAddrReq struct {
+	NetworkAddress uint16
+	RequestType    uint8
+	StartIndex     uint8
+}
+
+type ZdoIEEEAddrReqReply struct {
+	Status Status
+}
+
+type ZdoNodeDescReq struct {
+	DestinationAddress uint16
+	OfInterestAddress  uint16
+}
+
+type ZdoNodeDescReqReply struct {
+	Status Status
+}
+
+type ZdoPowerDescReq struct {
+	DestinationAddress uint16
+	OfInterestAddress  uint16
+}
+
+type ZdoPowerDescReqReply struct {
+	Status Status
+}
+
+type ZdoSimpleDescReq struct {
+	DestinationAddress uint16
+	OfInterestAddress  uint16
+	Endpoint           uint8
+}
+
+type ZdoSimpleDescReqReply struct {
+	Status Status
+}
+
+type ZdoActiveEPReq struct {
+	DestinationAddress uint16
+	OfInterestAddress  uint16
+}
+
+type ZdoActiveEPReqReply struct {
+	Status Status
+}
+
+type ZdoMatchDescReq struct {
+	DestinationAddress uint16
+	OfInterestAddress  uint16
+	ProfileID          uint16
+	InClusterList      []uint16 `bcsliceprefix:"8"`
+	OutClusterList     []uint16 `bcsliceprefix:"8"`
+}
+
+type ZdoMatchDescReqReply struct {
+	Status Status
+}
+
+// ZdoBindReq requests a binding be created on the target device. The destination address is always eight
+// bytes on the wire, group addresses occupy the two least significant bytes.
+type ZdoBindReq struct {
+	TargetAddress          uint16
+	SourceAddress          uint64
+	SourceEndpoint         uint8
+	ClusterID              uint16
+	DestinationAddressMode uint8
+	DestinationAddress     uint64
+	DestinationEndpoint    uint8
+}
+
+type ZdoBindReqReply struct {
+	Status Status
+}
+
+type ZdoUnbindReq struct {
+	TargetAddress          uint16
+	SourceAddress          uint64
+	SourceEndpoint         uint8
+	ClusterID              uint16
+	DestinationAddressMode uint8
+	DestinationAddress     uint64
+	DestinationEndpoint    uint8
+}
+
+type ZdoUnbindReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtLqiReq struct {
+	DestinationAddress uint16
+	StartIndex         uint8
+}
+
+type ZdoMgmtLqiReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtRtgReq struct {
+	DestinationAddress uint16
+	StartIndex         uint8
+}
+
+type ZdoMgmtRtgReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtBindReq struct {
+	DestinationAddress uint16
+	StartIndex         uint8
+}
+
+type ZdoMgmtBindReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtLeaveReq struct {
+	DestinationAddress uint16
+	IEEEAddress        uint64
+	RemoveChildren     uint8
+}
+
+type ZdoMgmtLeaveReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtPermitJoinReq struct {
+	AddressMode        uint8
+	DestinationAddress uint16
+	Duration           uint8
+	TCSignificance     uint8
+}
+
+type ZdoMgmtPermitJoinReqReply struct {
+	Status Status
+}
+
+type ZdoMgmtNwkUpdateReq struct {
+	DestinationAddress     uint16
+	DestinationAddressMode uint8
+	ChannelMask            uint32
+	ScanDuration           uint8
+	ScanCount              uint8
+	NetworkManagerAddress  uint16
+}
+
+type ZdoMgmtNwkUpdateReqReply struct {
+	Status Status
+}
+
+type ZdoMsgCbRegister struct {
+	ClusterID uint16
+}
+
+type ZdoMsgCbRegisterReply struct {
+	Status Status
+}
+
+type ZdoMsgCbRemove struct {
+	ClusterID uint16
+}
+
+type ZdoMsgCbRemoveReply struct {
+	Status Status
+}
+
+// StartupFromAppStatus is the result of ZDO_STARTUP_FROM_APP, it is not a Status as non zero values do not
+// indicate failure.
+type StartupFromAppStatus uint8
+
+const (
+	StartupRestoredNetworkState StartupFromAppStatus = 0x00
+	StartupNewNetworkState      StartupFromAppStatus = 0x01
+	StartupLeaveAndNotStarted   StartupFromAppStatus = 0x02
+)
+
+type ZdoStartupFromApp struct {
+	StartDelay uint16
+}
+
+type ZdoStartupFromAppReply struct {
+	StartupStatus StartupFromAppStatus
+}
+
+type ZdoExtNwkInfo struct{}
+
+type ZdoExtNwkInfoReply struct {
+	NetworkAddress    uint16
+	DeviceState       DeviceState
+	PanID             uint16
+	ParentAddress     uint16
+	ExtendedPanID     uint64
+	ParentIEEEAddress uint64
+	LogicalChannel    uint8
+}
+
+type ZdoNwkAddrRsp struct {
+	Status            Status
+	IEEEAddress       uint64
+	NetworkAddress    uint16
+	StartIndex        uint8
+	AssociatedDevices []uint16 `bcsliceprefix:"8"`
+}
+
+type ZdoIEEEAddrRsp struct {
+	Status            Status
+	IEEEAddress       uint64
+	NetworkAddress    uint16
+	StartIndex        uint8
+	AssociatedDevices []uint16 `bcsliceprefix:"8"`
+}
+
+type ZdoNodeDescRsp struct {
+	SourceAddress              uint16
+	Status                     Status
+	OfInterestAddress          uint16
+	LogicalTypeDescriptorFlags uint8
+	APSFlagsFrequencyBand      uint8
+	MACCapabilityFlags         uint8
+	ManufacturerCode           uint16
+	MaxBufferSize              uint8
+	MaxInTransferSize          uint16
+	ServerMask                 uint16
+	MaxOutTransferSize         uint16
+	DescriptorCapabilities     uint8
+}
+
+type ZdoPowerDescRsp struct {
+	SourceAddress           uint16
+	Status                  Status
+	OfInterestAddress       uint16
+	PowerModeAndSources     uint8
+	CurrentPowerSourceLevel uint8
+}
+
+type ZdoSimpleDescRsp struct {
+	SourceAddress     uint16
+	Status            Status
+	OfInterestAddress uint16
+	Length            uint8
+	Endpoint          uint8
+	ProfileID         uint16
+	DeviceID          uint16
+	DeviceVersion     uint8
+	InClusterList     []uint16 `bcsliceprefix:"8"`
+	OutClusterList    []uint16 `bcsliceprefix:"8"`
+}
+
+type ZdoActiveEPRsp struct {
+	SourceAddress     uint16
+	Status            Status
+	OfInterestAddress uint16
+	ActiveEndpoints   []uint8 `bcsliceprefix:"8"`
+}
+
+type ZdoMatchDescRsp struct {
+	SourceAddress     uint16
+	Status            Status
+	OfInterestAddress uint16
+	MatchList         []uint8 `bcsliceprefix:"8"`
+}
+
+type ZdoBindRsp struct {
+	SourceAddress uint16
+	Status        Status
+}
+
+type ZdoUnbindRsp struct {
+	SourceAddress uint16
+	Status        Status
+}
+
+// ZdoNeighbourLqi is a single neighbour table entry in ZDO_MGMT_LQI_RSP.
+type ZdoNeighbourLqi struct {
+	ExtendedPanID  uint64
+	IEEEAddress    uint64
+	NetworkAddress uint16
+	DeviceFlags    uint8
+	PermitJoining  uint8
+	Depth          uint8
+	LinkQuality    uint8
+}
+
+type ZdoMgmtLqiRsp struct {
+	SourceAddress      uint16
+	Status             Status
+	NeighbourTableSize uint8
+	StartIndex         uint8
+	Neighbours         []ZdoNeighbourLqi `bcsliceprefix:"8"`
+}
+
+// ZdoRoute is a single routing table entry in ZDO_MGMT_RTG_RSP.
+type ZdoRoute struct {
+	DestinationAddress uint16
+	RouteStatus        uint8
+	NextHop            uint16
+}
+
+type ZdoMgmtRtgRsp struct {
+	SourceAddress    uint16
+	Status           Status
+	RoutingTableSize uint8
+	StartIndex       uint8
+	Routes           []ZdoRoute `bcsliceprefix:"8"`
+}
+
+// ZdoBinding is a single binding table entry in ZDO_MGMT_BIND_RSP. Group bindings carry a two byte
+// destination address and no endpoint, IEEE bindings carry an eight byte address and an endpoint.
+type ZdoBinding struct {
+	SourceAddress          uint64
+	SourceEndpoint         uint8
+	ClusterID              uint16
+	DestinationAddressMode uint8
+	DestinationGroup       uint16 `bcincludeif:"DestinationAddressMode==1"`
+	DestinationAddress     uint64 `bcincludeif:"DestinationAddressMode==3"`
+	DestinationEndpoint    uint8  `bcincludeif:"DestinationAddressMode==3"`
+}
+
+type ZdoMgmtBindRsp struct {
+	SourceAddress    uint16
+	Status           Status
+	BindingTableSize uint8
+	StartIndex       uint8
+	Bindings         []ZdoBinding `bcsliceprefix:"8"`
+}
+
+type ZdoMgmtLeaveRsp struct {
+	SourceAddress uint16
+	Status        Status
+}
+
+type ZdoMgmtPermitJoinRsp struct {
+	SourceAddress uint16
+	Status        Status
+}
+
+type ZdoMgmtNwkUpdateNotify struct {
+	SourceAddress        uint16
+	Status               Status
+	ScannedChannels      uint32
+	TotalTransmissions   uint16
+	TransmissionFailures uint16
+	EnergyValues         []uint8 `bcsliceprefix:"8"`
+}
+
+type ZdoStateChangeInd struct {
+	State DeviceState
+}
+
+type ZdoEndDeviceAnnceInd struct {
+	SourceAddress  uint16
+	NetworkAddress uint16
+	IEEEAddress    uint64
+	Capabilities   uint8
+}
+
+type ZdoSrcRtgInd struct {
+	DestinationAddress uint16
+	RelayList          []uint16 `bcsliceprefix:"8"`
+}
+
+type ZdoLeaveInd struct {
+	SourceAddress uint16
+	IEEEAddress   uint64
+	Request       uint8
+	Remove        uint8
+	Rejoin        uint8
+}
+
+type ZdoTCDevInd struct {
+	NetworkAddress uint16
+	IEEEAddress    uint64
+	ParentAddress  uint16
+}
+
+type ZdoPermitJoinInd struct {
+	Duration uint8
+}
+
+type ZdoMsgCbIncoming struct {
+	SourceAddress         uint16
+	WasBroadcast          uint8
+	ClusterID             uint16
+	SecurityUse           uint8
+	SequenceNumber        uint8
+	MACDestinationAddress uint16
+	Data                  []byte
+}
+
+// ZDO callbacks which lead with the address of the responding device report their status through
+// library.StatusCarrier.
+
+func (r ZdoNodeDescRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoPowerDescRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoSimpleDescRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoActiveEPRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMatchDescRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoBindRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoUnbindRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtLqiRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtRtgRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtBindRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtLeaveRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtPermitJoinRsp) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+func (r ZdoMgmtNwkUpdateNotify) ResponseStatus() (uint8, string) {
+	return uint8(r.Status), r.Status.String()
+}
+
+var zdoMessages = []message{
+	{SREQ, ZDO, 0x00, ZdoNwkAddrReq{}, nil},
+	{SRSP, ZDO, 0x00, ZdoNwkAddrReqReply{}, nil},
+	{SREQ, ZDO, 0x01, ZdoIEEEAddrReq{}, nil},
+	{SRSP, ZDO, 0x01, ZdoIEEEAddrReqReply{}, nil},
+	{SREQ, ZDO, 0x02, ZdoNodeDescReq{}, nil},
+	{SRSP, ZDO, 0x02, ZdoNodeDescReqReply{}, nil},
+	{SREQ, ZDO, 0x03, ZdoPowerDescReq{}, nil},
+	{SRSP, ZDO, 0x03, ZdoPowerDescReqReply{}, nil},
+	{SREQ, ZDO, 0x04, ZdoSimpleDescReq{}, nil},
+	{SRSP, ZDO, 0x04, ZdoSimpleDescReqReply{}, nil},
+	{SREQ, ZDO, 0x05, ZdoActiveEPReq{}, nil},
+	{SRSP, ZDO, 0x05, ZdoActiveEPReqReply{}, nil},
+	{SREQ, ZDO, 0x06, ZdoMatchDescReq{}, nil},
+	{SRSP, ZDO, 0x06, ZdoMatchDescReqReply{}, nil},
+	{SREQ, ZDO, 0x21, ZdoBindReq{}, nil},
+	{SRSP, ZDO, 0x21, ZdoBindReqReply{}, nil},
+	{SREQ, ZDO, 0x22, ZdoUnbindReq{}, nil},
+	{SRSP, ZDO, 0x22, ZdoUnbindReqReply{}, nil},
+	{SREQ, ZDO, 0x31, ZdoMgmtLqiReq{}, nil},
+	{SRSP, ZDO, 0x31, ZdoMgmtLqiReqReply{}, nil},
+	{SREQ, ZDO, 0x32, ZdoMgmtRtgReq{}, nil},
+	{SRSP, ZDO, 0x32, ZdoMgmtRtgReqReply{}, nil},
+	{SREQ, ZDO, 0x33, ZdoMgmtBindReq{}, nil},
+	{SRSP, ZDO, 0x33, ZdoMgmtBindReqReply{}, nil},
+	{SREQ, ZDO, 0x34, ZdoMgmtLeaveReq{}, nil},
+	{SRSP, ZDO, 0x34, ZdoMgmtLeaveReqReply{}, nil},
+	{SREQ, ZDO, 0x36, ZdoMgmtPermitJoinReq{}, nil},
+	{SRSP, ZDO, 0x36, ZdoMgmtPermitJoinReqReply{}, nil},
+	{SREQ, ZDO, 0x37, ZdoMgmtNwkUpdateReq{}, nil},
+	{SRSP, ZDO, 0x37, ZdoMgmtNwkUpdateReqReply{}, nil},
+	{SREQ, ZDO, 0x3e, ZdoMsgCbRegister{}, nil},
+	{SRSP, ZDO, 0x3e, ZdoMsgCbRegisterReply{}, nil},
+	{SREQ, ZDO, 0x3f, ZdoMsgCbRemove{}, nil},
+	{SRSP, ZDO, 0x3f, ZdoMsgCbRemoveReply{}, nil},
+	{SREQ, ZDO, 0x40, ZdoStartupFromApp{}, nil},
+	{SRSP, ZDO, 0x40, ZdoStartupFromAppReply{}, nil},
+	{SREQ, ZDO, 0x50, ZdoExtNwkInfo{}, nil},
+	{SRSP, ZDO, 0x50, ZdoExtNwkInfoReply{}, nil},
+	{AREQ, ZDO, 0x80, ZdoNwkAddrRsp{}, nil},
+	{AREQ, ZDO, 0x81, ZdoIEEEAddrRsp{}, nil},
+	{AREQ, ZDO, 0x82, ZdoNodeDescRsp{}, nil},
+	{AREQ, ZDO, 0x83, ZdoPowerDescRsp{}, nil},
+	{AREQ, ZDO, 0x84, ZdoSimpleDescRsp{}, nil},
+	{AREQ, ZDO, 0x85, ZdoActiveEPRsp{}, nil},
+	{AREQ, ZDO, 0x86, ZdoMatchDescRsp{}, nil},
+	{AREQ, ZDO, 0xa1, ZdoBindRsp{}, nil},
+	{AREQ, ZDO, 0xa2, ZdoUnbindRsp{}, nil},
+	{AREQ, ZDO, 0xb1, ZdoMgmtLqiRsp{}, nil},
+	{AREQ, ZDO, 0xb2, ZdoMgmtRtgRsp{}, nil},
+	{AREQ, ZDO, 0xb3, ZdoMgmtBindRsp{}, nil},
+	{AREQ, ZDO, 0xb4, ZdoMgmtLeaveRsp{}, nil},
+	{AREQ, ZDO, 0xb6, ZdoMgmtPermitJoinRsp{}, nil},
+	{AREQ, ZDO, 0xb8, ZdoMgmtNwkUpdateNotify{}, nil},
+	{AREQ, ZDO, 0xc0, ZdoStateChangeInd{}, nil},
+	{AREQ, ZDO, 0xc1, ZdoEndDeviceAnnceInd{}, nil},
+	{AREQ, ZDO, 0xc4, ZdoSrcRtgInd{}, nil},
+	{AREQ, ZDO, 0xc9, ZdoLeaveInd{}, nil},
+	{AREQ, ZDO, 0xca, ZdoTCDevInd{}, nil},
+	{AREQ, ZDO, 0xcb, ZdoPermitJoinInd{}, nil},
+	{AREQ, ZDO, 0xff, ZdoMsgCbIncoming{}, nil},
+}
@@ -0,0 +1,26 @@
+// Package znpbroker wires the znp message catalogue into the broker, which is otherwise unaware of the
+// messages of Z-Stack adapters.
+package znpbroker
+
+import (
+	"context"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/library"
+	"github.com/shimmeringbee/unpi/znp"
+	"io"
+)
+
+// LibraryForVersion returns the znp message library for the version reported during broker.Connect.
+func LibraryForVersion(v broker.Version) *library.Library {
+	return znp.LibraryForProduct(v.Product)
+}
+
+// Connect runs broker.Connect, selecting the znp message library for the adapters firmware unless opts
+// provides a Library or LibraryForVersion.
+func Connect(ctx context.Context, transport io.ReadWriter, opts broker.ConnectOptions) (*broker.Broker, broker.ConnectResult, error) {
+	if opts.Library == nil && opts.LibraryForVersion == nil {
+		opts.LibraryForVersion = LibraryForVersion
+	}
+
+	return broker.Connect(ctx, transport, opts)
+}
@@ -0,0 +1,107 @@
+package znpbroker
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	. "github.com/shimmeringbee/unpi"
+	"github.com/shimmeringbee/unpi/broker"
+	"github.com/shimmeringbee/unpi/library"
+	testunpi "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/unpi/znp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func quietConnectOptions() broker.ConnectOptions {
+	return broker.ConnectOptions{
+		DrainPeriod:  time.Millisecond,
+		PingAttempts: 2,
+		StepTimeout:  20 * time.Millisecond,
+		Logf:         func(string, ...interface{}) {},
+	}
+}
+
+func TestConnect(t *testing.T) {
+	t.Run("selects the znp message library for the adapters version", func(t *testing.T) {
+		version := znp.SysVersionRevisionReply{TransportRev: 2, Product: uint8(znp.ZStack3x0), MajorRelease: 2, MinorRelease: 7, MaintenanceRelease: 1, Revision: 20210120}
+		payload, err := bytecodec.Marshal(version)
+		assert.NoError(t, err)
+
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, broker.SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: broker.SysPingCommandID, Payload: []byte{0x79, 0x0f}})
+		m.On(SREQ, SYS, broker.SysVersionCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: broker.SysVersionCommandID, Payload: payload})
+		m.On(SREQ, APP_CNF, 0x05).Return(Frame{MessageType: SRSP, Subsystem: APP_CNF, CommandID: 0x05, Payload: []byte{0x00}})
+
+		b, result, err := Connect(context.Background(), m, quietConnectOptions())
+
+		assert.NoError(t, err)
+		assert.Equal(t, broker.Version(version), result.Version)
+
+		if assert.NotNil(t, b) {
+			defer b.Stop()
+
+			err := b.RequestResponse(context.Background(), znp.AppCnfBdbStartCommissioning{}, &znp.AppCnfBdbStartCommissioningReply{})
+			assert.NoError(t, err)
+		}
+
+		m.AssertCalls(t)
+	})
+
+	t.Run("leaves a provided library in place", func(t *testing.T) {
+		m := testunpi.NewMockAdapter()
+		defer m.Stop()
+
+		m.On(SREQ, SYS, broker.SysPingCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: broker.SysPingCommandID, Payload: []byte{0x79, 0x07}})
+		m.On(SREQ, SYS, broker.SysVersionCommandID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: broker.SysVersionCommandID, Payload: []byte{0x02, 0x01, 0x02, 0x07, 0x01}})
+
+		opts := quietConnectOptions()
+		opts.Library = library.NewLibrary()
+
+		b, _, err := Connect(context.Background(), m, opts)
+
+		assert.NoError(t, err)
+
+		if assert.NotNil(t, b) {
+			defer b.Stop()
+
+			err := b.RequestResponse(context.Background(), znp.AppCnfBdbStartCommissioning{}, &znp.AppCnfBdbStartCommissioningReply{})
+			assert.Equal(t, broker.RequestMessageNotInLibrary, err)
+		}
+
+		m.AssertCalls(t)
+	})
+}
+
+func TestBrokerFrames(t *testing.T) {
+	t.Run("command IDs used by the broker match the znp messages", func(t *testing.T) {
+		ml := znp.Library()
+
+		expected := map[interface{}]library.Identity{
+			znp.SysResetReq{}: {MessageType: AREQ, Subsystem: SYS, CommandID: broker.SysResetReqCommandID},
+			znp.SysPing{}:     {MessageType: SREQ, Subsystem: SYS, CommandID: broker.SysPingCommandID},
+			znp.SysVersion{}:  {MessageType: SREQ, Subsystem: SYS, CommandID: broker.SysVersionCommandID},
+			znp.SysResetInd{}: {MessageType: AREQ, Subsystem: SYS, CommandID: broker.SysResetIndCommandID},
+		}
+
+		for message, identity := range expected {
+			actual, found := ml.GetByObject(message)
+			assert.True(t, found)
+			assert.Equal(t, identity, actual, "%T", message)
+		}
+	})
+
+	t.Run("reset indications are laid out as SYS_RESET_IND", func(t *testing.T) {
+		ind := znp.SysResetInd{Reason: znp.ResetReasonWatchdog, TransportRev: 2, ProductID: 1, MajorRelease: 2, MinorRelease: 7, HardwareRevision: 3}
+
+		payload, err := bytecodec.Marshal(ind)
+		assert.NoError(t, err)
+
+		actual := broker.ResetIndication{}
+		assert.NoError(t, bytecodec.Unmarshal(payload, &actual))
+
+		assert.Equal(t, broker.ResetIndication{Reason: broker.ResetWatchdog, TransportRev: 2, ProductID: 1, MajorRelease: 2, MinorRelease: 7, HardwareRevision: 3}, actual)
+	})
+}